@@ -1,22 +1,24 @@
 package captcha
 
 import (
-	"os"
 	"time"
 
+	"github.com/VolticFroogo/Animal-Pictures/config"
 	"github.com/VolticFroogo/Animal-Pictures/models"
 	recaptcha "github.com/dpapathanasiou/go-recaptcha"
 )
 
 var (
-	// Get our reCAPTCHA secret keys.
-	v2Secret   = os.Getenv("CAPTCHA_V2_SECRET")
-	v3Secret   = os.Getenv("CAPTCHA_V3_SECRET")
-	cautiousIP map[string]int64
+	// Our reCAPTCHA secret keys.
+	v2Secret, v3Secret string
+	cautiousIP         map[string]int64
 )
 
-// Init is called to setup the reCAPTCHA script.
-func Init() {
+// Init is called to setup the reCAPTCHA script with our secret keys.
+func Init(config config.Captcha) {
+	v2Secret = config.V2Secret
+	v3Secret = config.V3Secret
+
 	// Initialise the cautiousIP map.
 	cautiousIP = make(map[string]int64)
 	go garbageCollector()
@@ -38,7 +40,10 @@ func garbageCollector() {
 }
 
 // V3 returns whether a user should be allowed to continue by checking their v2 or v3 captcha results.
-func V3(v2, v3, ip, action string) bool {
+// It is a variable so tests can replace it instead of asking Google.
+var V3 = check
+
+func check(v2, v3, ip, action string) bool {
 	if v3 != "" {
 		// User is completing login with a v3 reCAPTCHA.
 
@@ -0,0 +1,510 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of the whole website.
+// Values are loaded from defaults, then a JSON file, then environment variables and finally flags.
+type Config struct {
+	HTTP    HTTP
+	DB      DB
+	Storage Storage
+	Uploads Uploads
+	Posts   Posts
+	Email   Email
+	Codes   Codes
+	JWT     JWT
+	Captcha Captcha
+}
+
+// HTTP is the configuration of the web server.
+type HTTP struct {
+	// Address is the address the web server listens on.
+	Address string `env:"HTTP_ADDRESS" flag:"http-address"`
+	// BaseURL is the public URL of the website used in links, without a trailing slash.
+	BaseURL string `env:"BASE_URL" flag:"base-url"`
+	// TrustedProxies are the comma separated CIDR ranges of proxies, such as Cloudflare's, trusted to set the CF-Connecting-IP header.
+	// Without them the IP of a request is the address it was connected from.
+	TrustedProxies string `env:"HTTP_TRUSTED_PROXIES" flag:"http-trusted-proxies"`
+}
+
+// Proxies parses the ranges of the trusted proxies.
+func (h HTTP) Proxies() (proxies []*net.IPNet, err error) {
+	for _, cidr := range strings.Split(h.TrustedProxies, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		var proxy *net.IPNet
+		_, proxy, err = net.ParseCIDR(cidr)
+		if err != nil {
+			return
+		}
+
+		proxies = append(proxies, proxy)
+	}
+
+	return
+}
+
+// DB is the configuration of the database.
+type DB struct {
+	// Type of database, either "mysql" or "sqlite3".
+	Type string `env:"DB_TYPE" flag:"db-type"`
+	// Username to access the MySQL database.
+	Username string `env:"DB_USERNAME" flag:"db-username"`
+	// Password to access the MySQL database.
+	Password string `env:"DB_PASSWORD"`
+	// Protocol used to connect to MySQL, such as "unix" or "tcp".
+	Protocol string `env:"DB_PROTOCOL" flag:"db-protocol"`
+	// Address of MySQL, the socket file when using the unix protocol.
+	Address string `env:"DB_ADDRESS" flag:"db-address"`
+	// Database name in MySQL.
+	Database string `env:"DB_DATABASE" flag:"db-database"`
+	// Path of the database file when using SQLite, ":memory:" keeps the database in memory.
+	Path string `env:"DB_PATH" flag:"db-path"`
+}
+
+// Storage is the configuration of where uploads are stored.
+type Storage struct {
+	// Driver is the storage backend: "s3", "local" or "memory".
+	Driver string `env:"STORAGE_DRIVER" flag:"storage-driver"`
+	// Path is the directory uploads are written to by the local driver.
+	Path string `env:"STORAGE_PATH" flag:"storage-path"`
+	// Prefix is the URL path uploads are served from by the local and memory drivers.
+	Prefix string `env:"STORAGE_PREFIX" flag:"storage-prefix"`
+	// Bucket is the S3 bucket uploads are stored in.
+	Bucket string `env:"STORAGE_BUCKET" flag:"storage-bucket"`
+	// Region is the AWS region of the S3 bucket.
+	Region string `env:"STORAGE_REGION" flag:"storage-region"`
+}
+
+// Uploads is the configuration of the limits of uploaded images.
+type Uploads struct {
+	// MaxBytes is the largest size of an image file.
+	MaxBytes int64 `env:"UPLOADS_MAX_BYTES" flag:"uploads-max-bytes"`
+	// MaxWidth is the largest width of an image in pixels.
+	MaxWidth int `env:"UPLOADS_MAX_WIDTH" flag:"uploads-max-width"`
+	// MaxHeight is the largest height of an image in pixels.
+	MaxHeight int `env:"UPLOADS_MAX_HEIGHT" flag:"uploads-max-height"`
+	// MaxPixels is the most pixels of an image, and of all the images uploaded by a request together.
+	// Decoded images take 4 bytes a pixel, so it bounds the memory a request can use.
+	MaxPixels int `env:"UPLOADS_MAX_PIXELS" flag:"uploads-max-pixels"`
+}
+
+// Posts is the configuration of creating posts.
+type Posts struct {
+	// MaxImages is the most images a post can have.
+	MaxImages int `env:"POSTS_MAX_IMAGES" flag:"posts-max-images"`
+	// MaxTags is the most tags a post can have.
+	MaxTags int `env:"POSTS_MAX_TAGS" flag:"posts-max-tags"`
+	// DuplicateWarnDistance is the most bits an image's hash can differ by from another post's to warn it may be a repost.
+	DuplicateWarnDistance int `env:"POSTS_DUPLICATE_WARN_DISTANCE" flag:"posts-duplicate-warn-distance"`
+	// DuplicateRejectDistance is the most bits an image's hash can differ by from another post's to reject it, -1 never rejects.
+	DuplicateRejectDistance int `env:"POSTS_DUPLICATE_REJECT_DISTANCE" flag:"posts-duplicate-reject-distance"`
+	// HotCachePages is how many pages of hot posts are kept in memory, 0 disables the cache.
+	HotCachePages int `env:"POSTS_HOT_CACHE_PAGES" flag:"posts-hot-cache-pages"`
+	// HotCacheVoteSwing is how much a post's score can change before the cached hot posts are rebuilt early.
+	HotCacheVoteSwing int `env:"POSTS_HOT_CACHE_VOTE_SWING" flag:"posts-hot-cache-vote-swing"`
+	// Ranker is the algorithm rating the hot posts: reddit, wilson or gravity.
+	// Run the rerank command after changing it so existing posts are rated the same way.
+	Ranker string `env:"POSTS_RANKER" flag:"posts-ranker"`
+	// Gravity is how quickly posts fall with the gravity ranker.
+	Gravity float64 `env:"POSTS_GRAVITY" flag:"posts-gravity"`
+}
+
+// Email is the configuration of outgoing emails.
+type Email struct {
+	// Driver is the mail backend: "ses", "smtp" or "file".
+	Driver string `env:"EMAIL_DRIVER" flag:"email-driver"`
+	// Sender is the address emails are sent from.
+	Sender string `env:"EMAIL_SENDER" flag:"email-sender"`
+	// Region is the AWS region of SES.
+	Region string `env:"EMAIL_REGION" flag:"email-region"`
+	// SMTPAddress is the host:port of the SMTP server.
+	SMTPAddress string `env:"EMAIL_SMTP_ADDRESS" flag:"email-smtp-address"`
+	// SMTPUsername is the username to log in to the SMTP server with, it isn't logged in to if empty.
+	SMTPUsername string `env:"EMAIL_SMTP_USERNAME" flag:"email-smtp-username"`
+	// SMTPPassword is the password to log in to the SMTP server with.
+	SMTPPassword string `env:"EMAIL_SMTP_PASSWORD"`
+	// Path is the directory emails are written to by the file driver.
+	Path string `env:"EMAIL_PATH" flag:"email-path"`
+	// MaxAttempts is how many times sending a queued email can fail before it is given up on.
+	MaxAttempts int `env:"EMAIL_MAX_ATTEMPTS" flag:"email-max-attempts"`
+	// Backoff is how long a queued email waits after failing the first time, it doubles every attempt.
+	Backoff Duration `env:"EMAIL_BACKOFF" flag:"email-backoff"`
+}
+
+// Codes is the configuration of email verification and password recovery codes.
+type Codes struct {
+	// TTL is how long a code can be used for after it is sent.
+	TTL Duration `env:"CODES_TTL" flag:"codes-ttl"`
+	// MaxAttempts is how many codes can be requested by a user, or wrong codes tried by an IP, every AttemptPeriod.
+	MaxAttempts int `env:"CODES_MAX_ATTEMPTS" flag:"codes-max-attempts"`
+	// AttemptPeriod is how long attempts are counted for.
+	AttemptPeriod Duration `env:"CODES_ATTEMPT_PERIOD" flag:"codes-attempt-period"`
+	// UnverifiedAge is how long an account can go without verifying its email before it is deleted.
+	// It is 0 by default, which never deletes them, so upgrading doesn't delete accounts which were never verified.
+	UnverifiedAge Duration `env:"CODES_UNVERIFIED_AGE" flag:"codes-unverified-age"`
+}
+
+// JWT is the configuration of authentication tokens.
+type JWT struct {
+	// PrivateKey is the path of the RSA key tokens are signed with.
+	PrivateKey string `env:"JWT_PRIVATE_KEY" flag:"jwt-private-key"`
+	// PublicKey is the path of the RSA key tokens are verified with.
+	PublicKey string `env:"JWT_PUBLIC_KEY" flag:"jwt-public-key"`
+}
+
+// Captcha is the configuration of reCAPTCHA.
+type Captcha struct {
+	// V2Secret is the secret key of reCAPTCHA v2.
+	V2Secret string `env:"CAPTCHA_V2_SECRET"`
+	// V3Secret is the secret key of reCAPTCHA v3.
+	V3Secret string `env:"CAPTCHA_V3_SECRET"`
+}
+
+// Default returns the configuration used in production.
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			Address: ":87",
+			BaseURL: "https://ap.froogo.co.uk",
+		},
+		DB: DB{
+			Type:     "mysql",
+			Username: "ap",
+			Protocol: "unix",
+			Address:  "/var/run/mysqld/mysqld.sock",
+			Database: "ap",
+			Path:     "ap.db",
+		},
+		Storage: Storage{
+			Driver: "s3",
+			Path:   "uploads",
+			Prefix: "/uploads/",
+			Bucket: "froogo-ap",
+			Region: "eu-west-2",
+		},
+		Uploads: Uploads{
+			MaxBytes:  5 * 1024 * 1024, // 5MB.
+			MaxWidth:  4096,
+			MaxHeight: 4096,
+			MaxPixels: 24000000, // 24 megapixels.
+		},
+		Posts: Posts{
+			MaxImages:               10,
+			MaxTags:                 10,
+			DuplicateWarnDistance:   10,
+			DuplicateRejectDistance: 2,
+			HotCachePages:           5,
+			HotCacheVoteSwing:       10,
+			Ranker:                  "reddit",
+			Gravity:                 1.8,
+		},
+		Email: Email{
+			Driver:      "ses",
+			Sender:      "\"Animal Pictures\" <noreply@froogo.co.uk>",
+			Region:      "eu-west-1",
+			Path:        "emails",
+			MaxAttempts: 8,
+			Backoff:     Duration{time.Minute},
+		},
+		Codes: Codes{
+			TTL:           Duration{time.Hour * 24},
+			MaxAttempts:   5,
+			AttemptPeriod: Duration{time.Hour},
+		},
+		JWT: JWT{
+			PrivateKey: "keys/app.rsa",
+			PublicKey:  "keys/app.rsa.pub",
+		},
+	}
+}
+
+// Load loads the configuration from the command line arguments, returning the arguments left after the flags.
+// The JSON file is read from the -config flag or the CONFIG environment variable.
+func Load(args []string) (config Config, rest []string, err error) {
+	config = Default()
+
+	flags := flag.NewFlagSet("Animal-Pictures", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG"), "path of the JSON configuration file")
+
+	fields := make(map[string]reflect.Value)
+	walk(reflect.ValueOf(&config).Elem(), func(field reflect.StructField, value reflect.Value) {
+		if name := field.Tag.Get("flag"); name != "" {
+			fields[name] = value
+			flags.String(name, "", field.Name)
+		}
+	})
+
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	if *path != "" {
+		err = loadFile(&config, *path)
+		if err != nil {
+			return
+		}
+	}
+
+	walk(reflect.ValueOf(&config).Elem(), func(field reflect.StructField, value reflect.Value) {
+		if err != nil {
+			return
+		}
+
+		if name := field.Tag.Get("env"); name != "" {
+			if env, ok := os.LookupEnv(name); ok {
+				err = set(value, env)
+				if err != nil {
+					err = fmt.Errorf("environment variable %v: %v", name, err)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return
+	}
+
+	// Only flags which were passed override the other sources.
+	flags.Visit(func(f *flag.Flag) {
+		if value, ok := fields[f.Name]; ok && err == nil {
+			err = set(value, f.Value.String())
+			if err != nil {
+				err = fmt.Errorf("flag -%v: %v", f.Name, err)
+			}
+		}
+	})
+	if err != nil {
+		return
+	}
+
+	rest = flags.Args()
+	err = config.Validate()
+	return
+}
+
+func loadFile(config *Config, path string) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(config)
+	if err != nil {
+		err = fmt.Errorf("config file %v: %v", path, err)
+	}
+
+	return
+}
+
+// walk calls fn with every field which isn't a struct, descending into nested structs.
+func walk(value reflect.Value, fn func(field reflect.StructField, value reflect.Value)) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(Duration{}) {
+			walk(value.Field(i), fn)
+			continue
+		}
+
+		fn(field, value.Field(i))
+	}
+}
+
+// set parses a string into a field.
+func set(value reflect.Value, s string) (err error) {
+	if value.Type() == reflect.TypeOf(Duration{}) {
+		var d time.Duration
+		d, err = time.ParseDuration(s)
+		value.Set(reflect.ValueOf(Duration{d}))
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(s, 10, 64)
+		value.SetInt(i)
+	case reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(s, 64)
+		value.SetFloat(f)
+	default:
+		err = fmt.Errorf("unsupported type %v", value.Type())
+	}
+
+	return
+}
+
+// Duration is a time.Duration written as a string such as "24h" in JSON.
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON reads the duration from a string.
+func (d *Duration) UnmarshalJSON(data []byte) (err error) {
+	var s string
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return
+	}
+
+	d.Duration, err = time.ParseDuration(s)
+	return
+}
+
+// Validate checks the configuration is usable.
+func (config Config) Validate() error {
+	var problems []string
+
+	if config.HTTP.Address == "" {
+		problems = append(problems, "HTTP.Address is required")
+	}
+
+	if base, err := url.Parse(config.HTTP.BaseURL); err != nil || !base.IsAbs() || strings.HasSuffix(config.HTTP.BaseURL, "/") {
+		problems = append(problems, "HTTP.BaseURL must be an absolute URL without a trailing slash")
+	}
+
+	if _, err := config.HTTP.Proxies(); err != nil {
+		problems = append(problems, "HTTP.TrustedProxies must be comma separated CIDR ranges")
+	}
+
+	switch config.DB.Type {
+	case "mysql":
+		if config.DB.Address == "" || config.DB.Database == "" {
+			problems = append(problems, "DB.Address and DB.Database are required with MySQL")
+		}
+	case "sqlite3":
+		if config.DB.Path == "" {
+			problems = append(problems, "DB.Path is required with SQLite")
+		}
+	default:
+		problems = append(problems, "DB.Type must be mysql or sqlite3")
+	}
+
+	switch config.Storage.Driver {
+	case "s3":
+		if config.Storage.Bucket == "" || config.Storage.Region == "" {
+			problems = append(problems, "Storage.Bucket and Storage.Region are required with S3")
+		}
+	case "local":
+		if config.Storage.Path == "" {
+			problems = append(problems, "Storage.Path is required with local storage")
+		}
+		fallthrough
+	case "memory":
+		if !strings.HasPrefix(config.Storage.Prefix, "/") || !strings.HasSuffix(config.Storage.Prefix, "/") {
+			problems = append(problems, "Storage.Prefix must start and end with a slash")
+		}
+	default:
+		problems = append(problems, "Storage.Driver must be s3, local or memory")
+	}
+
+	if config.Uploads.MaxBytes < 1 || config.Uploads.MaxWidth < 1 || config.Uploads.MaxHeight < 1 || config.Uploads.MaxPixels < 1 {
+		problems = append(problems, "Uploads.MaxBytes, Uploads.MaxWidth, Uploads.MaxHeight and Uploads.MaxPixels must be at least 1")
+	}
+
+	if config.Posts.MaxImages < 1 {
+		problems = append(problems, "Posts.MaxImages must be at least 1")
+	}
+
+	if config.Posts.MaxTags < 0 {
+		problems = append(problems, "Posts.MaxTags can't be negative")
+	}
+
+	if config.Posts.DuplicateWarnDistance < 0 || config.Posts.DuplicateWarnDistance > 64 || config.Posts.DuplicateRejectDistance < -1 || config.Posts.DuplicateRejectDistance > config.Posts.DuplicateWarnDistance {
+		problems = append(problems, "Posts.DuplicateWarnDistance must be between 0 and 64 and Posts.DuplicateRejectDistance between -1 and it")
+	}
+
+	if config.Posts.HotCachePages < 0 {
+		problems = append(problems, "Posts.HotCachePages can't be negative")
+	}
+
+	if config.Posts.HotCacheVoteSwing < 1 {
+		problems = append(problems, "Posts.HotCacheVoteSwing must be at least 1")
+	}
+
+	switch config.Posts.Ranker {
+	case "reddit", "wilson", "gravity":
+	default:
+		problems = append(problems, "Posts.Ranker must be reddit, wilson or gravity")
+	}
+
+	if config.Posts.Gravity <= 0 {
+		problems = append(problems, "Posts.Gravity must be positive")
+	}
+
+	if _, err := mail.ParseAddress(config.Email.Sender); err != nil {
+		problems = append(problems, "Email.Sender must be an email address")
+	}
+
+	switch config.Email.Driver {
+	case "ses":
+		if config.Email.Region == "" {
+			problems = append(problems, "Email.Region is required with SES")
+		}
+	case "smtp":
+		if _, _, err := net.SplitHostPort(config.Email.SMTPAddress); err != nil {
+			problems = append(problems, "Email.SMTPAddress must be a host:port")
+		}
+	case "file":
+		if config.Email.Path == "" {
+			problems = append(problems, "Email.Path is required with the file driver")
+		}
+	default:
+		problems = append(problems, "Email.Driver must be ses, smtp or file")
+	}
+
+	if config.Email.MaxAttempts < 1 || config.Email.Backoff.Duration <= 0 {
+		problems = append(problems, "Email.MaxAttempts must be at least 1 and Email.Backoff positive")
+	}
+
+	if config.Codes.TTL.Duration <= 0 || config.Codes.MaxAttempts < 1 || config.Codes.AttemptPeriod.Duration <= 0 {
+		problems = append(problems, "Codes.TTL and Codes.AttemptPeriod must be positive and Codes.MaxAttempts at least 1")
+	}
+
+	if config.Codes.UnverifiedAge.Duration < 0 {
+		problems = append(problems, "Codes.UnverifiedAge can't be negative")
+	}
+
+	if config.JWT.PrivateKey == "" || config.JWT.PublicKey == "" {
+		problems = append(problems, "JWT.PrivateKey and JWT.PublicKey are required")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
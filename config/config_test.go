@@ -0,0 +1,193 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a JSON configuration file for a test and returns its path.
+func writeFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `{
+		"HTTP": {"Address": ":1", "BaseURL": "https://file.example.com"},
+		"Posts": {"MaxImages": 3, "MaxTags": 4},
+		"Codes": {"TTL": "2h", "AttemptPeriod": "2h", "UnverifiedAge": "2h"}
+	}`)
+
+	t.Setenv("HTTP_ADDRESS", ":2")
+	t.Setenv("POSTS_MAX_TAGS", "5")
+	t.Setenv("CODES_ATTEMPT_PERIOD", "3h")
+	t.Setenv("CODES_UNVERIFIED_AGE", "3h")
+
+	config, rest, err := Load([]string{"-config", path, "-http-address", ":3", "-codes-unverified-age", "90m", "migrate", "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each value comes from the last source which sets it.
+	cases := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"default", config.DB.Type, Default().DB.Type},
+		{"file", config.HTTP.BaseURL, "https://file.example.com"},
+		{"file over default", config.Posts.MaxImages, 3},
+		{"environment over file", config.Posts.MaxTags, 5},
+		{"flag over environment", config.HTTP.Address, ":3"},
+		{"duration from file", config.Codes.TTL.Duration, 2 * time.Hour},
+		{"duration from environment", config.Codes.AttemptPeriod.Duration, 3 * time.Hour},
+		{"duration from flag", config.Codes.UnverifiedAge.Duration, 90 * time.Minute},
+	}
+
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("%v: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	if strings.Join(rest, " ") != "migrate up" {
+		t.Errorf("arguments left after the flags are %q, want migrate up", rest)
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	t.Setenv("CONFIG", writeFile(t, `{"Posts": {"MaxImages": 3}}`))
+
+	config, _, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Posts.MaxImages != 3 {
+		t.Errorf("file from CONFIG wasn't loaded, Posts.MaxImages is %v", config.Posts.MaxImages)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"unknown field", `{"HTTP": {"Port": 80}}`, nil, nil, `unknown field "Port"`},
+		{"duration in file", `{"Codes": {"TTL": "a day"}}`, nil, nil, "config file"},
+		{"duration without a unit in file", `{"Codes": {"TTL": 24}}`, nil, nil, "config file"},
+		{"duration in environment", `{}`, map[string]string{"CODES_TTL": "a day"}, nil, "environment variable CODES_TTL"},
+		{"number in environment", `{}`, map[string]string{"POSTS_MAX_IMAGES": "ten"}, nil, "environment variable POSTS_MAX_IMAGES"},
+		{"duration in flag", `{}`, nil, []string{"-codes-ttl", "a day"}, "flag -codes-ttl"},
+		{"unknown flag", `{}`, nil, []string{"-port", "80"}, "flag provided but not defined"},
+		{"invalid", `{"Posts": {"MaxImages": 0}}`, nil, nil, "Posts.MaxImages must be at least 1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for name, value := range c.env {
+				t.Setenv(name, value)
+			}
+
+			_, _, err := Load(append([]string{"-config", writeFile(t, c.file)}, c.args...))
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("got error %v, want one containing %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestProxies(t *testing.T) {
+	proxies, err := HTTP{TrustedProxies: " 173.245.48.0/20, ,2400:cb00::/32 "}.Proxies()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(proxies) != 2 || proxies[0].String() != "173.245.48.0/20" || proxies[1].String() != "2400:cb00::/32" {
+		t.Errorf("got proxies %v", proxies)
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	d := Duration{90 * time.Minute}
+
+	data, err := d.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `"1h30m0s"` {
+		t.Errorf("marshalled to %s", data)
+	}
+
+	var decoded Duration
+	if err := decoded.UnmarshalJSON(data); err != nil || decoded != d {
+		t.Errorf("unmarshalled %s to %v: %v", data, decoded, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default configuration is invalid: %v", err)
+	}
+
+	// Each case breaks the default configuration in one way, which must be the only problem reported.
+	cases := []struct {
+		change func(c *Config)
+		want   string
+	}{
+		{func(c *Config) { c.HTTP.Address = "" }, "HTTP.Address is required"},
+		{func(c *Config) { c.HTTP.BaseURL = "https://example.com/" }, "HTTP.BaseURL must be an absolute URL without a trailing slash"},
+		{func(c *Config) { c.HTTP.BaseURL = "example.com" }, "HTTP.BaseURL must be an absolute URL without a trailing slash"},
+		{func(c *Config) { c.HTTP.TrustedProxies = "10.0.0.0/8, 10.0.0.1" }, "HTTP.TrustedProxies must be comma separated CIDR ranges"},
+		{func(c *Config) { c.DB.Database = "" }, "DB.Address and DB.Database are required with MySQL"},
+		{func(c *Config) { c.DB.Type, c.DB.Path = "sqlite3", "" }, "DB.Path is required with SQLite"},
+		{func(c *Config) { c.DB.Type = "postgres" }, "DB.Type must be mysql or sqlite3"},
+		{func(c *Config) { c.Storage.Bucket = "" }, "Storage.Bucket and Storage.Region are required with S3"},
+		{func(c *Config) { c.Storage.Driver, c.Storage.Path = "local", "" }, "Storage.Path is required with local storage"},
+		{func(c *Config) { c.Storage.Driver, c.Storage.Prefix = "memory", "uploads" }, "Storage.Prefix must start and end with a slash"},
+		{func(c *Config) { c.Storage.Driver = "disk" }, "Storage.Driver must be s3, local or memory"},
+		{func(c *Config) { c.Uploads.MaxPixels = 0 }, "Uploads.MaxBytes, Uploads.MaxWidth, Uploads.MaxHeight and Uploads.MaxPixels must be at least 1"},
+		{func(c *Config) { c.Posts.MaxImages = 0 }, "Posts.MaxImages must be at least 1"},
+		{func(c *Config) { c.Posts.MaxTags = -1 }, "Posts.MaxTags can't be negative"},
+		{func(c *Config) { c.Posts.DuplicateRejectDistance = c.Posts.DuplicateWarnDistance + 1 }, "Posts.DuplicateWarnDistance must be between 0 and 64 and Posts.DuplicateRejectDistance between -1 and it"},
+		{func(c *Config) { c.Posts.HotCachePages = -1 }, "Posts.HotCachePages can't be negative"},
+		{func(c *Config) { c.Posts.HotCacheVoteSwing = 0 }, "Posts.HotCacheVoteSwing must be at least 1"},
+		{func(c *Config) { c.Posts.Ranker = "random" }, "Posts.Ranker must be reddit, wilson or gravity"},
+		{func(c *Config) { c.Posts.Gravity = 0 }, "Posts.Gravity must be positive"},
+		{func(c *Config) { c.Email.Sender = "Animal Pictures" }, "Email.Sender must be an email address"},
+		{func(c *Config) { c.Email.Region = "" }, "Email.Region is required with SES"},
+		{func(c *Config) { c.Email.Driver, c.Email.SMTPAddress = "smtp", "localhost" }, "Email.SMTPAddress must be a host:port"},
+		{func(c *Config) { c.Email.Driver, c.Email.Path = "file", "" }, "Email.Path is required with the file driver"},
+		{func(c *Config) { c.Email.Driver = "sendmail" }, "Email.Driver must be ses, smtp or file"},
+		{func(c *Config) { c.Email.Backoff.Duration = 0 }, "Email.MaxAttempts must be at least 1 and Email.Backoff positive"},
+		{func(c *Config) { c.Codes.MaxAttempts = 0 }, "Codes.TTL and Codes.AttemptPeriod must be positive and Codes.MaxAttempts at least 1"},
+		{func(c *Config) { c.Codes.UnverifiedAge.Duration = -time.Hour }, "Codes.UnverifiedAge can't be negative"},
+		{func(c *Config) { c.JWT.PublicKey = "" }, "JWT.PrivateKey and JWT.PublicKey are required"},
+	}
+
+	for _, c := range cases {
+		config := Default()
+		c.change(&config)
+
+		if err := config.Validate(); err == nil || err.Error() != "invalid config: "+c.want {
+			t.Errorf("got error %v, want %q", err, c.want)
+		}
+	}
+
+	// Every problem is reported at once.
+	config := Default()
+	config.HTTP.Address, config.Posts.MaxImages = "", 0
+	if err := config.Validate(); err == nil || err.Error() != "invalid config: HTTP.Address is required; Posts.MaxImages must be at least 1" {
+		t.Errorf("got error %v, want both problems", err)
+	}
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// Counters of hot posts pages served from the cache and the store, published by expvar.
+var (
+	hotCacheHits   = expvar.NewInt("hot_cache_hits")
+	hotCacheMisses = expvar.NewInt("hot_cache_misses")
+)
+
+// HotCache is a PostStore which keeps the first pages of hot posts in memory.
+// It is rebuilt every HotPostsTickRate, when a post is made and when a post's score swings by enough.
+type HotCache struct {
+	PostStore
+
+	pages, swing int
+
+	// rebuilding is held while the pages are loaded from the store, so only one rebuild runs at a time.
+	rebuilding sync.Mutex
+
+	// mutex is only held to read and swap the cached pages, never while they are loaded.
+	mutex sync.Mutex
+	// posts are the first pages of hot posts and more is whether there are posts after them.
+	posts []models.Post
+	more  bool
+	valid bool
+	// version counts the times the cache was invalidated, a rebuild which started before the last one isn't valid.
+	version int
+	// swings are how much each post's score has changed since the cache was built.
+	swings map[string]int
+}
+
+// NewHotCache returns a cache of the given number of pages of hot posts from a store.
+// Swing is how much a post's score can change before the cache is rebuilt.
+func NewHotCache(store PostStore, pages, swing int) *HotCache {
+	return &HotCache{
+		PostStore: store,
+		pages:     pages,
+		swing:     swing,
+		swings:    make(map[string]int),
+	}
+}
+
+// Start rebuilds the cache every HotPostsTickRate in the background.
+func (cache *HotCache) Start() {
+	go func() {
+		for range time.Tick(models.HotPostsTickRate) {
+			cache.rebuilding.Lock()
+			err := cache.rebuild()
+			cache.rebuilding.Unlock()
+
+			if err != nil {
+				log.Printf("Error rebuilding hot posts cache: %v", err)
+			}
+		}
+	}()
+}
+
+// rebuild loads the cached pages from the store and then swaps them in, the rebuilding mutex must be held.
+// The old pages are served while the new ones load. Votes during the load count towards the swing of the new pages.
+func (cache *HotCache) rebuild() (err error) {
+	cache.mutex.Lock()
+	version := cache.version
+	cache.swings = make(map[string]int)
+	cache.mutex.Unlock()
+
+	var posts []models.Post
+	more := true
+	for page := 0; page < cache.pages && more; page++ {
+		var pagePosts []models.Post
+		pagePosts, more, err = cache.PostStore.GetHotPosts(page)
+		if err != nil {
+			cache.invalidate()
+			return
+		}
+
+		posts = append(posts, pagePosts...)
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.posts, cache.more = posts, more
+	cache.valid = version == cache.version
+	return
+}
+
+// isValid returns if the cache doesn't need to be rebuilt.
+func (cache *HotCache) isValid() bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return cache.valid
+}
+
+// invalidate makes the next request rebuild the cache.
+func (cache *HotCache) invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.valid = false
+	cache.version++
+}
+
+// GetHotPosts returns a page of the hot posts from the cache, pages after the cached ones come from the store.
+func (cache *HotCache) GetHotPosts(page int) (posts []models.Post, more bool, err error) {
+	if page < 0 || page >= cache.pages {
+		hotCacheMisses.Add(1)
+		return cache.PostStore.GetHotPosts(page)
+	}
+
+	if cache.isValid() {
+		hotCacheHits.Add(1)
+	} else {
+		hotCacheMisses.Add(1)
+
+		// Requests which waited for another rebuild use its pages instead of loading them again.
+		cache.rebuilding.Lock()
+		if !cache.isValid() {
+			err = cache.rebuild()
+		}
+		cache.rebuilding.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	start := page * models.PostsPerPage
+	if start >= len(cache.posts) {
+		return
+	}
+
+	end := start + models.PostsPerPage
+	if end < len(cache.posts) {
+		more = true
+	} else {
+		end = len(cache.posts)
+		more = cache.more
+	}
+
+	// Copy the page so callers can't change the cache.
+	posts = append([]models.Post(nil), cache.posts[start:end]...)
+	return
+}
+
+// NewPost creates a new post and rebuilds the cache so it appears.
+func (cache *HotCache) NewPost(title, description, userUUID string, images []models.Image, tags []models.Tag) (post models.Post, err error) {
+	post, err = cache.PostStore.NewPost(title, description, userUUID, images, tags)
+	if err == nil {
+		cache.invalidate()
+	}
+
+	return
+}
+
+// SetVote sets a vote on a post, rebuilding the cache if the post's score has swung since it was built.
+func (cache *HotCache) SetVote(post models.Post, uuid string, vote bool) (score int, err error) {
+	score, err = cache.PostStore.SetVote(post, uuid, vote)
+	if err != nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.swings[post.UUID] += score - post.Score()
+	if swing := cache.swings[post.UUID]; swing >= cache.swing || swing <= -cache.swing {
+		cache.valid = false
+		cache.version++
+	}
+
+	return
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// gatedPosts is a PostStore which sends on loading when a page of hot posts is asked for and waits for the gate to load it.
+type gatedPosts struct {
+	PostStore
+	loading, gate chan struct{}
+}
+
+func (g gatedPosts) GetHotPosts(page int) ([]models.Post, bool, error) {
+	g.loading <- struct{}{}
+	<-g.gate
+	return g.PostStore.GetHotPosts(page)
+}
+
+// open lets the next page be loaded.
+func (g gatedPosts) open() {
+	<-g.loading
+	g.gate <- struct{}{}
+}
+
+func TestHotCacheRebuild(t *testing.T) {
+	stores := NewMemoryStores()
+	author, err := stores.Users.NewUser("author@example.com", "hash", "author", models.PrivUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := gatedPosts{PostStore: stores.Posts, loading: make(chan struct{}), gate: make(chan struct{})}
+	cache := NewHotCache(store, 1, 10)
+
+	if _, err := store.NewPost("Cat", "A cat.", author, []models.Image{{Key: "cat.jpg"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	go store.open()
+	if posts, _, err := cache.GetHotPosts(0); err != nil || len(posts) != 1 {
+		t.Fatalf("got %v posts building the cache: %v", len(posts), err)
+	}
+
+	// The cached pages are served while a rebuild waits for the store.
+	rebuilt := make(chan error)
+	go func() {
+		cache.rebuilding.Lock()
+		defer cache.rebuilding.Unlock()
+
+		rebuilt <- cache.rebuild()
+	}()
+
+	<-store.loading
+
+	served := make(chan int)
+	go func() {
+		posts, _, _ := cache.GetHotPosts(0)
+		served <- len(posts)
+	}()
+
+	select {
+	case posts := <-served:
+		if posts != 1 {
+			t.Errorf("got %v posts during the rebuild, want the cached one", posts)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cached pages weren't served during the rebuild")
+	}
+
+	// A post made during the rebuild may be missing from it, so the rebuilt cache isn't valid.
+	if _, err := store.NewPost("Dog", "A dog.", author, []models.Image{{Key: "dog.jpg"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.invalidate()
+	store.gate <- struct{}{}
+	if err := <-rebuilt; err != nil {
+		t.Fatal(err)
+	}
+
+	if cache.isValid() {
+		t.Error("cache invalidated during a rebuild is valid")
+	}
+
+	go store.open()
+	if posts, _, err := cache.GetHotPosts(0); err != nil || len(posts) != 2 {
+		t.Errorf("got %v posts after rebuilding again, want 2: %v", len(posts), err)
+	}
+}
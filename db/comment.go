@@ -0,0 +1,217 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// selectComments selects comments with their owner and the vote of the user given as the first parameter.
+// Owners are left joined so comments of deleted users stay in their threads.
+const selectComments = "SELECT C.id, C.parent_id, C.post_uuid, C.body, C.created, C.edited, C.deleted, C.upvotes, C.downvotes, COALESCE(CV.value, 0), C.user_uuid, COALESCE(U.username, ''), COALESCE(U.privilege, 0), COALESCE(U.creation, 0), COALESCE(U.imageExtension, '') FROM comments AS C LEFT JOIN users AS U ON C.user_uuid = U.uuid LEFT JOIN comment_votes AS CV ON CV.comment_id = C.id AND CV.user_uuid = ?"
+
+// scanComments scans every row selected by selectComments.
+func scanComments(rows *sql.Rows) (comments []models.Comment, err error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		var comment models.Comment
+		var vote int
+
+		err = rows.Scan(&comment.ID, &comment.ParentID, &comment.PostUUID, &comment.Body, &comment.Creation, &comment.Edited, &comment.Deleted, &comment.Upvotes, &comment.Downvotes, &vote, &comment.Owner.UUID, &comment.Owner.Username, &comment.Owner.Privilege, &comment.Owner.Creation, &comment.Owner.ImageExtension) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		comment.Vote = voteStatus(vote)
+		comments = append(comments, comment)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// GetComments returns a page of the top level comments of a post, best first, with all of their replies nested under them.
+// The votes of a user are filled in, more is whether there is another page.
+func GetComments(postUUID, userUUID string, page int) (comments []models.Comment, more bool, err error) {
+	if !models.ValidPage(page) {
+		return
+	}
+
+	rows, err := db.Query(selectComments+" WHERE C.post_uuid=? AND C.root_id=0 ORDER BY C.upvotes - C.downvotes DESC, C.created ASC LIMIT ? OFFSET ?", userUUID, postUUID, models.CommentsPerPage+1, page*models.CommentsPerPage)
+	if err != nil {
+		return
+	}
+
+	roots, err := scanComments(rows)
+	if err != nil || len(roots) == 0 {
+		return
+	}
+
+	// One more comment than a page is selected to know if there is another page.
+	if len(roots) > models.CommentsPerPage {
+		roots = roots[:models.CommentsPerPage]
+		more = true
+	}
+
+	placeholders := make([]string, len(roots))
+	args := []interface{}{userUUID}
+	for i, root := range roots {
+		placeholders[i] = "?"
+		args = append(args, root.ID)
+	}
+
+	rows, err = db.Query(selectComments+" WHERE C.root_id IN ("+strings.Join(placeholders, ", ")+") ORDER BY C.created ASC, C.id ASC", args...)
+	if err != nil {
+		return
+	}
+
+	replies, err := scanComments(rows)
+	if err != nil {
+		return
+	}
+
+	comments = commentTree(roots, replies)
+	return
+}
+
+// commentTree nests replies under the comments they reply to.
+func commentTree(roots, replies []models.Comment) []models.Comment {
+	children := make(map[int64][]models.Comment)
+	for _, reply := range replies {
+		children[reply.ParentID] = append(children[reply.ParentID], reply)
+	}
+
+	var nest func(comments []models.Comment) []models.Comment
+	nest = func(comments []models.Comment) []models.Comment {
+		for i := range comments {
+			comments[i].Replies = nest(children[comments[i].ID])
+		}
+
+		return comments
+	}
+
+	return nest(roots)
+}
+
+// GetComment returns a comment given its ID, the ID is 0 if it doesn't exist.
+func GetComment(id int64) (comment models.Comment, err error) {
+	rows, err := db.Query(selectComments+" WHERE C.id=?", "", id)
+	if err != nil {
+		return
+	}
+
+	comments, err := scanComments(rows)
+	if err != nil || len(comments) == 0 {
+		return
+	}
+
+	comment = comments[0]
+	return
+}
+
+// NewComment creates a new comment on a post, parentID is the comment it replies to or 0.
+func NewComment(postUUID string, parentID int64, userUUID, body string) (comment models.Comment, err error) {
+	var rootID int64
+	if parentID != 0 {
+		err = db.QueryRow("SELECT root_id FROM comments WHERE id=?", parentID).Scan(&rootID)
+		if err != nil {
+			return
+		}
+
+		// Replies to top level comments have them as their root.
+		if rootID == 0 {
+			rootID = parentID
+		}
+	}
+
+	comment = models.Comment{
+		ParentID: parentID,
+		PostUUID: postUUID,
+		Body:     body,
+		Creation: time.Now().Unix(),
+	}
+
+	result, err := db.Exec("INSERT INTO comments (post_uuid, parent_id, root_id, user_uuid, body, created) VALUES (?, ?, ?, ?, ?, ?)", postUUID, parentID, rootID, userUUID, body, comment.Creation)
+	if err != nil {
+		return
+	}
+
+	comment.ID, err = result.LastInsertId()
+	if err != nil {
+		return
+	}
+
+	comment.Owner, err = GetUserFromUUID(userUUID)
+	return
+}
+
+// EditComment replaces the body of a comment.
+func EditComment(id int64, body string) (err error) {
+	_, err = db.Exec("UPDATE comments SET body=?, edited=? WHERE id=?", body, time.Now().Unix(), id)
+	return
+}
+
+// DeleteComment deletes the body of a comment, the comment stays so its replies keep their place in the thread.
+func DeleteComment(id int64) (err error) {
+	_, err = db.Exec("UPDATE comments SET body='', deleted=1 WHERE id=?", id)
+	return
+}
+
+// SetCommentVote sets a vote on a comment, voting the same way twice removes the vote.
+func SetCommentVote(comment models.Comment, uuid string, vote bool) (score int, err error) {
+	value := voteDown
+	if vote {
+		value = voteUp
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	// Lock the comment so votes on it are applied one at a time.
+	err = tx.QueryRow("SELECT upvotes, downvotes FROM comments WHERE id=?"+current.forUpdate, comment.ID).Scan(&comment.Upvotes, &comment.Downvotes)
+	if err != nil {
+		return
+	}
+
+	var oldValue int
+	err = tx.QueryRow("SELECT value FROM comment_votes WHERE comment_id=? AND user_uuid=?", comment.ID, uuid).Scan(&oldValue)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+
+	if oldValue == value {
+		// Voting the same way again removes the vote.
+		_, err = tx.Exec("DELETE FROM comment_votes WHERE comment_id=? AND user_uuid=?", comment.ID, uuid)
+		value = 0
+	} else {
+		_, err = tx.Exec("INSERT INTO comment_votes (comment_id, user_uuid, value, created) VALUES (?, ?, ?, ?)"+current.upsert([]string{"comment_id", "user_uuid"}, []string{"value", "created"}), comment.ID, uuid, value, time.Now().Unix())
+	}
+
+	if err != nil {
+		return
+	}
+
+	upvotes, downvotes := voteCounts(value)
+	oldUpvotes, oldDownvotes := voteCounts(oldValue)
+	comment.Upvotes += upvotes - oldUpvotes
+	comment.Downvotes += downvotes - oldDownvotes
+
+	score = comment.Score()
+
+	_, err = tx.Exec("UPDATE comments SET upvotes=?, downvotes=? WHERE id=?", comment.Upvotes, comment.Downvotes, comment.ID)
+	return
+}
@@ -3,49 +3,71 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"os"
+	"time"
 
+	"github.com/VolticFroogo/Animal-Pictures/config"
 	_ "github.com/go-sql-driver/mysql" // Necessary for connecting to MySQL.
+	_ "github.com/mattn/go-sqlite3"    // Necessary for connecting to SQLite.
 )
 
 /*
 	Structs and variables
 */
 
-// Database connection information.
 var (
-	// Type of database.
-	Type = "mysql"
-	// Username to access database.
-	Username = "ap"
-	// Password to access database.
-	Password = os.Getenv("DB_PASSWORD")
-	// Protocol of database.
-	Protocol = "unix"
-	// FileLocation of database socket.
-	FileLocation = "/var/run/mysqld/mysqld.sock"
-	// Database location.
-	Database = "ap"
-	// ConnString to connect to database.
-	ConnString = Username + ":" + Password + "@" + Protocol + "(" + FileLocation + ")/" + Database
+	db      *sql.DB
+	current dialect
 )
 
-var (
-	db *sql.DB
-)
+// Open opens the Database without checking its schema, it is used by the migrate command.
+func Open(config config.DB) (err error) {
+	var ok bool
+	current, ok = dialects[config.Type]
+	if !ok {
+		return fmt.Errorf("unknown database type %q", config.Type)
+	}
+
+	connString := config.Username + ":" + config.Password + "@" + config.Protocol + "(" + config.Address + ")/" + config.Database
+	if config.Type == SQLite {
+		// Writing transactions take the lock immediately so they can't deadlock upgrading from a read.
+		connString = "file:" + config.Path + "?_busy_timeout=5000&_txlock=immediate"
+	}
 
-// InitDB initializes the Database.
-func InitDB() (err error) {
-	db, err = sql.Open(Type, ConnString)
+	db, err = sql.Open(config.Type, connString)
+	if err == nil && config.Type == SQLite && config.Path == ":memory:" {
+		// Every connection to an in-memory database opens a new empty one, so only one is used.
+		db.SetMaxOpenConns(1)
+	}
+
+	// The search index was loaded from the previous Database.
+	indexMutex.Lock()
+	indexLoaded = time.Time{}
+	indexMutex.Unlock()
 	return
 }
 
+// Close closes the Database.
+func Close() error {
+	return db.Close()
+}
+
+// InitDB initializes the Database and refuses to continue if its schema is out of date.
+func InitDB(config config.DB) (err error) {
+	err = Open(config)
+	if err != nil {
+		return
+	}
+
+	return checkSchema()
+}
+
 /*
 	Helper functions
 */
 
+// rowExists checks if a query returns any rows, EXISTS is supported by both MySQL and SQLite.
 func rowExists(query string, args ...interface{}) (exists bool, err error) {
-	query = fmt.Sprintf("SELECT exists (%s)", query)
+	query = fmt.Sprintf("SELECT EXISTS (%s)", query)
 	err = db.QueryRow(query, args...).Scan(&exists)
 	return
 }
@@ -0,0 +1,392 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/mattn/go-sqlite3"
+)
+
+// openMigrated opens a new SQLite database in memory with every migration applied.
+func openMigrated(t *testing.T) {
+	openMemory(t)
+
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialects(t *testing.T) {
+	cases := []struct {
+		name      string
+		upsert    string
+		forUpdate string
+		hamming   bool
+		applied   bool
+	}{
+		{MySQL, " ON DUPLICATE KEY UPDATE value=VALUES(value), created=VALUES(created)", " FOR UPDATE", true, true},
+		{SQLite, " ON CONFLICT (post_uuid, user_uuid) DO UPDATE SET value=excluded.value, created=excluded.created", "", false, false},
+	}
+
+	for _, c := range cases {
+		d := dialects[c.name]
+
+		if upsert := d.upsert([]string{"post_uuid", "user_uuid"}, []string{"value", "created"}); upsert != c.upsert {
+			t.Errorf("%v: upsert is %q, want %q", c.name, upsert, c.upsert)
+		}
+
+		if d.forUpdate != c.forUpdate {
+			t.Errorf("%v: forUpdate is %q, want %q", c.name, d.forUpdate, c.forUpdate)
+		}
+
+		if (d.hammingDistance != "") != c.hamming {
+			t.Errorf("%v: hammingDistance is %q", c.name, d.hammingDistance)
+		}
+
+		if (d.applied != nil) != c.applied || d.implicitCommit != c.applied {
+			t.Errorf("%v: schema changes must be checked exactly when they commit implicitly", c.name)
+		}
+	}
+}
+
+// openInformationSchema opens an SQLite database with the tables of information_schema used by mysqlApplied.
+// The posts table has a score column and a posts_top index.
+func openInformationSchema(t *testing.T) *sql.DB {
+	const driver = "sqlite3_information_schema"
+	if !driverRegistered(driver) {
+		sql.Register(driver, &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				return conn.RegisterFunc("DATABASE", func() string { return "ap" }, true)
+			},
+		})
+	}
+
+	schema, err := sql.Open(driver, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		schema.Close()
+	})
+
+	for _, stmt := range []string{
+		"ATTACH DATABASE ':memory:' AS information_schema",
+		"CREATE TABLE information_schema.COLUMNS (TABLE_SCHEMA TEXT, TABLE_NAME TEXT, COLUMN_NAME TEXT, DATA_TYPE TEXT)",
+		"CREATE TABLE information_schema.STATISTICS (TABLE_SCHEMA TEXT, TABLE_NAME TEXT, INDEX_NAME TEXT)",
+		"INSERT INTO information_schema.COLUMNS VALUES ('ap', 'posts', 'score', 'int'), ('other', 'posts', 'rating', 'double')",
+		"INSERT INTO information_schema.STATISTICS VALUES ('ap', 'posts', 'posts_top')",
+	} {
+		if _, err := schema.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return schema
+}
+
+// driverRegistered returns if a database driver has been registered.
+func driverRegistered(name string) bool {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestMySQLApplied(t *testing.T) {
+	schema := openInformationSchema(t)
+
+	cases := []struct {
+		stmt    string
+		applied bool
+		err     bool
+	}{
+		{"ALTER TABLE posts ADD COLUMN score INT NOT NULL DEFAULT 0;", true, false},
+		{"ALTER TABLE posts ADD COLUMN score BIGINT NOT NULL DEFAULT 0;", false, true},
+		{"ALTER TABLE posts DROP COLUMN score;", false, false},
+		// Columns of other databases on the same server don't count.
+		{"ALTER TABLE posts ADD COLUMN rating DOUBLE;", false, false},
+		{"ALTER TABLE posts DROP COLUMN rating;", true, false},
+		{"CREATE INDEX posts_top ON posts (score);", true, false},
+		{"ALTER TABLE posts DROP KEY posts_top;", false, false},
+		{"ALTER TABLE posts ADD INDEX posts_new (creation);", false, false},
+		{"DROP INDEX posts_new ON posts;", true, false},
+		{"UPDATE posts SET score = 1;", false, false},
+	}
+
+	for _, c := range cases {
+		applied, err := mysqlApplied(schema, c.stmt)
+		if applied != c.applied || (err != nil) != c.err {
+			t.Errorf("%q: got %v and error %v, want %v and error %v", c.stmt, applied, err, c.applied, c.err)
+		}
+	}
+}
+
+func TestFindSimilarImages(t *testing.T) {
+	openMigrated(t)
+
+	hashes := map[string]uint64{"same": 0xff00, "close": 0xff03, "far": 0x00ff}
+	for key, hash := range hashes {
+		if err := SetImageHash("post", key, hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Setting the hash of an image again replaces it.
+	if err := SetImageHash("post", "far", 0xffff); err != nil {
+		t.Fatal(err)
+	}
+
+	similar, err := FindSimilarImages(0xff00, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.SimilarImage{{PostUUID: "post", Key: "same", Distance: 0}, {PostUUID: "post", Key: "close", Distance: 2}, {PostUUID: "post", Key: "far", Distance: 8}}
+	if !reflect.DeepEqual(similar, want) {
+		t.Errorf("similar images are %+v, want %+v", similar, want)
+	}
+}
+
+func TestCoreQueries(t *testing.T) {
+	openMigrated(t)
+
+	author, err := NewUser("author@example.com", "hash", "author", models.PrivUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	voter, err := NewUser("voter@example.com", "hash", "voter", models.PrivUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user, err := GetUserFromEmail("author@example.com"); err != nil || user.UUID != author {
+		t.Errorf("user from email is %q, want %q: %v", user.UUID, author, err)
+	}
+
+	if err := EditPassword(author, "new hash"); err != nil {
+		t.Fatal(err)
+	}
+
+	if user, err := GetUserFromUUID(author); err != nil || user.Password != "new hash" {
+		t.Errorf("password is %q after editing it: %v", user.Password, err)
+	}
+
+	// One more post than a page makes a second page.
+	var posts []models.Post
+	for i := 0; i <= models.PostsPerPage; i++ {
+		post, err := NewPost("Cat", "A cat.", author, []models.Image{{Key: "cat.jpg"}}, []models.Tag{{Name: "cat", Kind: models.TagSpecies}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		posts = append(posts, post)
+	}
+
+	for page, want := range []struct {
+		posts int
+		more  bool
+	}{{models.PostsPerPage, true}, {1, false}, {0, false}} {
+		got, more, err := GetNewPosts(page)
+		if err != nil || len(got) != want.posts || more != want.more {
+			t.Errorf("page %v has %v posts and more %v, want %v and %v: %v", page, len(got), more, want.posts, want.more, err)
+		}
+	}
+
+	// Voting again changes the vote instead of adding one.
+	post := posts[0]
+	for _, c := range []struct {
+		upvote bool
+		score  int
+	}{{true, 1}, {false, -1}} {
+		if score, err := SetVote(post, voter, c.upvote); err != nil || score != c.score {
+			t.Errorf("voting %v made the score %v, want %v: %v", c.upvote, score, c.score, err)
+		}
+	}
+
+	comment, err := NewComment(post.UUID, 0, voter, "Good cat.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Voting the same way on a comment again removes the vote.
+	for _, c := range []struct {
+		upvote bool
+		score  int
+	}{{true, 1}, {true, 0}, {false, -1}} {
+		if score, err := SetCommentVote(comment, author, c.upvote); err != nil || score != c.score {
+			t.Errorf("voting %v on a comment made the score %v, want %v: %v", c.upvote, score, c.score, err)
+		}
+	}
+
+	if _, err := NewPost("Dog", "A dog.", author, []models.Image{{Key: "dog.jpg"}}, []models.Tag{{Name: "kitty", Kind: models.TagSpecies}, {Name: "cat", Kind: models.TagSpecies}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Merging moves posts which have both tags without duplicating them.
+	if err := MergeTags("kitty", "cat"); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := SearchTags("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tags) != 1 || tags[0].Name != "cat" || tags[0].Posts != len(posts)+1 {
+		t.Errorf("tags after merging are %+v, want only cat on %v posts", tags, len(posts)+1)
+	}
+
+	id, err := QueueMail(models.Mail{To: "author@example.com", Subject: "Hi", Text: "Hello."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := GetDueMail(time.Now().Unix(), 10)
+	if err != nil || len(due) != 1 || due[0].ID != id {
+		t.Fatalf("due mail is %+v, want the queued email: %v", due, err)
+	}
+
+	if err := SetMailAttempt(models.Mail{ID: id, State: models.MailSent, Attempts: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if due, err := GetDueMail(time.Now().Unix(), 10); err != nil || len(due) != 0 {
+		t.Errorf("sent email is still due: %+v %v", due, err)
+	}
+
+	// A code can only be used once.
+	code, err := AddEmailVerification(author, "new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userUUID, address, err := GetEmailVerification(code, time.Hour); err != nil || userUUID != author || address != "new@example.com" {
+		t.Errorf("code is for %q and %q, want %q and new@example.com: %v", userUUID, address, author, err)
+	}
+
+	if userUUID, _, err := GetEmailVerification(code, time.Hour); err != nil || userUUID != "" {
+		t.Errorf("code could be used twice by %q: %v", userUUID, err)
+	}
+}
+
+func TestPagesOutOfRange(t *testing.T) {
+	openMigrated(t)
+
+	for name, stores := range map[string]Stores{"memory": NewMemoryStores(), "sqlite": SQLStores()} {
+		author, err := stores.Users.NewUser("author@example.com", "hash", "author", models.PrivUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		post, err := stores.Posts.NewPost("Cat", "A cat.", author, []models.Image{{Key: "cat.jpg"}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := stores.Comments.NewComment(post.UUID, 0, author, "Good cat."); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := stores.Mail.QueueMail(models.Mail{To: "author@example.com", Subject: "Hi", Text: "Hello."}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Pages whose offset would overflow are empty instead of wrapping around to the start.
+		for _, page := range []int{-1, models.MaxPage + 1, math.MaxInt64 / 2} {
+			posts, more, err := stores.Posts.GetNewPosts(page)
+			if err != nil || len(posts) != 0 || more {
+				t.Errorf("%v: page %v has %v posts and more %v: %v", name, page, len(posts), more, err)
+			}
+
+			comments, more, err := stores.Comments.GetComments(post.UUID, author, page)
+			if err != nil || len(comments) != 0 || more {
+				t.Errorf("%v: page %v has %v comments and more %v: %v", name, page, len(comments), more, err)
+			}
+
+			mail, more, err := stores.Mail.GetMail(models.MailPending, page)
+			if err != nil || len(mail) != 0 || more {
+				t.Errorf("%v: page %v has %v emails and more %v: %v", name, page, len(mail), more, err)
+			}
+		}
+	}
+}
+
+func TestRerank(t *testing.T) {
+	openMigrated(t)
+
+	old := models.Ranking
+	models.Ranking = models.Gravity{Gravity: 1.8}
+	t.Cleanup(func() {
+		models.Ranking = old
+	})
+
+	// More posts than a batch, each of them old and rated as if it were new.
+	posts := rerankBatch + 1
+	creation := time.Now().Add(-time.Hour * 24 * 30).Unix()
+	for i := 0; i < posts; i++ {
+		_, err := db.Exec("INSERT INTO posts (uuid, useruuid, title, description, images, upvotes, rating, creation) VALUES (?, 'author', 'Cat', '', '[]', 10, 100, ?)", fmt.Sprintf("post-%04d", i), creation)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reranked, err := Rerank()
+	if err != nil || reranked != posts {
+		t.Fatalf("reranked %v posts, want %v: %v", reranked, posts, err)
+	}
+
+	want := models.Post{Upvotes: 10, Creation: creation}.GetRating()
+	var stale int
+	if err := db.QueryRow("SELECT COUNT(*) FROM posts WHERE rating > ?", want+0.001).Scan(&stale); err != nil || stale != 0 {
+		t.Errorf("%v posts still have their old rating: %v", stale, err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	openMigrated(t)
+
+	for name, stores := range map[string]Stores{"memory": NewMemoryStores(), "sqlite": SQLStores()} {
+		user, err := stores.Users.NewUser("user@example.com", "hash", "user", models.PrivUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, err := stores.Verifications.AddRecovery(user, "user@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// An expired code is used up without changing the password.
+		if userUUID, err := stores.Verifications.ResetPassword(code, -time.Second, "expired hash"); err != nil || userUUID != "" {
+			t.Errorf("%v: expired code reset the password of %q: %v", name, userUUID, err)
+		}
+
+		code, err = stores.Verifications.AddRecovery(user, "user@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if userUUID, err := stores.Verifications.ResetPassword(code, time.Hour, "new hash"); err != nil || userUUID != user {
+			t.Errorf("%v: code reset the password of %q, want %q: %v", name, userUUID, user, err)
+		}
+
+		if userUUID, err := stores.Verifications.ResetPassword(code, time.Hour, "other hash"); err != nil || userUUID != "" {
+			t.Errorf("%v: code could be used twice by %q: %v", name, userUUID, err)
+		}
+
+		if got, err := stores.Users.GetUserFromUUID(user); err != nil || got.Password != "new hash" {
+			t.Errorf("%v: password is %q, want new hash: %v", name, got.Password, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"strings"
+)
+
+// Database types.
+const (
+	MySQL  = "mysql"
+	SQLite = "sqlite3"
+)
+
+// dialect holds the parts of queries which differ between database types.
+type dialect struct {
+	// migrations is the directory of the embedded migrations written for the database.
+	migrations string
+	// forUpdate is appended to a SELECT to lock its rows until the end of the transaction.
+	forUpdate string
+	// upsert returns the clause appended to an INSERT so it updates the given columns on a conflicting key.
+	upsert func(key, columns []string) string
+	// hammingDistance is an expression of the number of bits which differ between the hash column and a parameter.
+	// It is empty if the database can't count bits so hashes are compared in Go instead.
+	hammingDistance string
+	// fullText is whether the database has FULLTEXT indexes, otherwise searches use an in-memory index.
+	fullText bool
+	// implicitCommit is whether schema changes commit the transaction they run in.
+	implicitCommit bool
+	// applied returns if the change of a migration statement is already in the schema, so running a migration again skips it.
+	// It is nil for databases which roll back schema changes with their transaction.
+	applied func(q querier, stmt string) (bool, error)
+}
+
+var dialects = map[string]dialect{
+	MySQL: {
+		migrations: "migrations/mysql",
+		forUpdate:  " FOR UPDATE",
+		upsert: func(key, columns []string) string {
+			set := make([]string, len(columns))
+			for i, column := range columns {
+				set[i] = column + "=VALUES(" + column + ")"
+			}
+
+			return " ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+		},
+		hammingDistance: "BIT_COUNT(hash ^ ?)",
+		fullText:        true,
+		implicitCommit:  true,
+		applied:         mysqlApplied,
+	},
+	SQLite: {
+		migrations: "migrations/sqlite",
+		// SQLite locks the whole database for writing transactions instead.
+		forUpdate: "",
+		upsert: func(key, columns []string) string {
+			set := make([]string, len(columns))
+			for i, column := range columns {
+				set[i] = column + "=excluded." + column
+			}
+
+			return " ON CONFLICT (" + strings.Join(key, ", ") + ") DO UPDATE SET " + strings.Join(set, ", ")
+		},
+	},
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math/bits"
+	"sort"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// similarImagesLimit is the most similar images returned for a hash.
+const similarImagesLimit = 10
+
+// PostImage is the key of an image of a post.
+type PostImage struct {
+	PostUUID, Key string
+}
+
+// FindSimilarImages returns the images whose hash differs from a hash by at most a distance, closest first.
+func FindSimilarImages(hash uint64, distance int) (similar []models.SimilarImage, err error) {
+	if current.hammingDistance == "" {
+		return findSimilarImages(hash, distance)
+	}
+
+	rows, err := db.Query("SELECT post_uuid, image_key, "+current.hammingDistance+" AS distance FROM image_hashes WHERE "+current.hammingDistance+" <= ? ORDER BY distance LIMIT ?", int64(hash), int64(hash), distance, similarImagesLimit)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var image models.SimilarImage
+
+		err = rows.Scan(&image.PostUUID, &image.Key, &image.Distance)
+		if err != nil {
+			return
+		}
+
+		similar = append(similar, image)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// findSimilarImages compares every hash in Go for databases which can't count bits.
+func findSimilarImages(hash uint64, distance int) (similar []models.SimilarImage, err error) {
+	rows, err := db.Query("SELECT post_uuid, image_key, hash FROM image_hashes")
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var image models.SimilarImage
+		var stored int64
+
+		err = rows.Scan(&image.PostUUID, &image.Key, &stored)
+		if err != nil {
+			return
+		}
+
+		image.Distance = bits.OnesCount64(hash ^ uint64(stored))
+		if image.Distance <= distance {
+			similar = append(similar, image)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+
+	similar = sortSimilarImages(similar)
+	return
+}
+
+// sortSimilarImages sorts similar images closest first and keeps at most similarImagesLimit.
+func sortSimilarImages(similar []models.SimilarImage) []models.SimilarImage {
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similar[i].Distance < similar[j].Distance
+	})
+
+	if len(similar) > similarImagesLimit {
+		similar = similar[:similarImagesLimit]
+	}
+
+	return similar
+}
+
+// SetImageHash stores the hash of an image of a post.
+func SetImageHash(postUUID, key string, hash uint64) (err error) {
+	_, err = db.Exec("INSERT INTO image_hashes (post_uuid, image_key, hash) VALUES (?, ?, ?)"+current.upsert([]string{"post_uuid", "image_key"}, []string{"hash"}), postUUID, key, int64(hash))
+	return
+}
+
+// setImageHashes stores the hashes of every image of a new post in a transaction.
+func setImageHashes(tx *sql.Tx, postUUID string, images []models.Image) (err error) {
+	for _, image := range images {
+		_, err = tx.Exec("INSERT INTO image_hashes (post_uuid, image_key, hash) VALUES (?, ?, ?)", postUUID, image.Key, int64(image.Hash))
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// GetUnhashedImages returns every image of every post which doesn't have a hash stored.
+func GetUnhashedImages() (images []PostImage, err error) {
+	hashed := make(map[PostImage]bool)
+
+	rows, err := db.Query("SELECT post_uuid, image_key FROM image_hashes")
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var image PostImage
+
+		err = rows.Scan(&image.PostUUID, &image.Key)
+		if err != nil {
+			return
+		}
+
+		hashed[image] = true
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+
+	posts, err := db.Query("SELECT uuid, images FROM posts")
+	if err != nil {
+		return
+	}
+
+	defer posts.Close()
+
+	for posts.Next() {
+		var uuid, imagesJSON string
+
+		err = posts.Scan(&uuid, &imagesJSON)
+		if err != nil {
+			return
+		}
+
+		var postImages []models.Image
+		err = json.Unmarshal([]byte(imagesJSON), &postImages)
+		if err != nil {
+			return
+		}
+
+		for _, image := range postImages {
+			if key := (PostImage{PostUUID: uuid, Key: image.Key}); !hashed[key] {
+				images = append(images, key)
+			}
+		}
+	}
+
+	err = posts.Err()
+	return
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// selectMail selects queued emails.
+const selectMail = "SELECT id, recipient, subject, html, text, state, attempts, next_attempt, last_error, created FROM mail"
+
+// QueueMail adds an email to the queue to be sent straight away.
+func QueueMail(mail models.Mail) (id int64, err error) {
+	now := time.Now().Unix()
+
+	result, err := db.Exec("INSERT INTO mail (recipient, subject, html, text, state, attempts, next_attempt, last_error, created) VALUES (?, ?, ?, ?, ?, 0, ?, '', ?)", mail.To, mail.Subject, mail.HTML, mail.Text, models.MailPending, now, now)
+	if err != nil {
+		return
+	}
+
+	return result.LastInsertId()
+}
+
+// GetDueMail returns up to a limit of the pending emails which are due to be sent by a unix time, oldest first.
+func GetDueMail(now int64, limit int) (mail []models.Mail, err error) {
+	rows, err := db.Query(selectMail+" WHERE state=? AND next_attempt<=? ORDER BY next_attempt, id LIMIT ?", models.MailPending, now, limit)
+	if err != nil {
+		return
+	}
+
+	return scanMail(rows)
+}
+
+// GetMail returns a page of the emails in a state, newest first, more is whether there is another page.
+func GetMail(state string, page int) (mail []models.Mail, more bool, err error) {
+	if !models.ValidPage(page) {
+		return
+	}
+
+	rows, err := db.Query(selectMail+" WHERE state=? ORDER BY id DESC LIMIT ? OFFSET ?", state, models.MailPerPage+1, page*models.MailPerPage)
+	if err != nil {
+		return
+	}
+
+	mail, err = scanMail(rows)
+
+	// One more email than a page is selected to know if there is another page.
+	if len(mail) > models.MailPerPage {
+		mail = mail[:models.MailPerPage]
+		more = true
+	}
+
+	return
+}
+
+// scanMail scans every row selected by selectMail.
+func scanMail(rows *sql.Rows) (mail []models.Mail, err error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		var queued models.Mail
+
+		err = rows.Scan(&queued.ID, &queued.To, &queued.Subject, &queued.HTML, &queued.Text, &queued.State, &queued.Attempts, &queued.NextAttempt, &queued.LastError, &queued.Creation) // Scan data from query.
+		if err != nil {
+			return
+		}
+
+		mail = append(mail, queued)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// SetMailAttempt stores the outcome of trying to send an email: its state, attempts, next attempt and last error.
+// The body of a sent email is cleared as it contains links which could be used by anyone who reads the database.
+func SetMailAttempt(mail models.Mail) (err error) {
+	if mail.State == models.MailSent {
+		_, err = db.Exec("UPDATE mail SET state=?, attempts=?, next_attempt=?, last_error=?, html='', text='' WHERE id=?", mail.State, mail.Attempts, mail.NextAttempt, mail.LastError, mail.ID)
+		return
+	}
+
+	_, err = db.Exec("UPDATE mail SET state=?, attempts=?, next_attempt=?, last_error=? WHERE id=?", mail.State, mail.Attempts, mail.NextAttempt, mail.LastError, mail.ID)
+	return
+}
+
+// RetryMail puts a dead email back in the queue to be sent straight away with no attempts, unless its body has been cleared.
+func RetryMail(id int64) (err error) {
+	_, err = db.Exec("UPDATE mail SET state=?, attempts=0, next_attempt=? WHERE id=? AND state=? AND text<>''", models.MailPending, time.Now().Unix(), id, models.MailDead)
+	return
+}
+
+// PurgeMail clears the bodies of dead emails queued before redactBefore, once their links have expired and they are no longer worth retrying.
+// Sent and dead emails queued before deleteBefore are deleted, returning how many were.
+func PurgeMail(redactBefore, deleteBefore int64) (purged int64, err error) {
+	_, err = db.Exec("UPDATE mail SET html='', text='' WHERE state=? AND created<? AND text<>''", models.MailDead, redactBefore)
+	if err != nil {
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM mail WHERE state IN (?, ?) AND created<?", models.MailSent, models.MailDead, deleteBefore)
+	if err != nil {
+		return
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,1173 @@
+package db
+
+import (
+	"database/sql"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/VolticFroogo/Animal-Pictures/search"
+	"github.com/zemirco/uid"
+)
+
+type memoryPost struct {
+	post     models.Post
+	userUUID string
+}
+
+type memoryComment struct {
+	comment models.Comment
+	rootID  int64
+}
+
+type memoryCode struct {
+	userUUID, email string
+	creation        int64
+}
+
+// Memory implements every store in memory, it is intended for tests and development.
+type Memory struct {
+	mutex sync.Mutex
+
+	users         map[string]models.User
+	posts         map[string]memoryPost
+	votes         map[string]map[string]int
+	comments      map[int64]memoryComment
+	commentVotes  map[int64]map[string]int
+	nextComment   int64
+	tags          map[string]models.Tag
+	postTags      map[string]map[int64]bool
+	nextTag       int64
+	jtis          map[string]models.JTI
+	nextJTI       int
+	verifications map[string]memoryCode
+	recoveries    map[string]memoryCode
+	mail          []models.Mail
+	nextMail      int64
+}
+
+// NewMemory creates a new empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		users:         make(map[string]models.User),
+		posts:         make(map[string]memoryPost),
+		votes:         make(map[string]map[string]int),
+		comments:      make(map[int64]memoryComment),
+		commentVotes:  make(map[int64]map[string]int),
+		tags:          make(map[string]models.Tag),
+		postTags:      make(map[string]map[int64]bool),
+		jtis:          make(map[string]models.JTI),
+		verifications: make(map[string]memoryCode),
+		recoveries:    make(map[string]memoryCode),
+	}
+}
+
+/*
+	Users
+*/
+
+// GetUserFromUUID retrieves a user from memory.
+func (m *Memory) GetUserFromUUID(uuid string) (user models.User, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, ok := m.users[uuid]
+	if !ok {
+		user.UUID = uuid
+	}
+
+	return
+}
+
+// GetUserFromEmail retrieves a user from memory.
+func (m *Memory) GetUserFromEmail(email string) (user models.User, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user.Email = email
+	for _, u := range m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+
+	return
+}
+
+// UserExistsFromEmail checks if a user exists from an email.
+func (m *Memory) UserExistsFromEmail(email string) (bool, error) {
+	user, err := m.GetUserFromEmail(email)
+	return user.UUID != "", err
+}
+
+// NewUser creates a new user.
+func (m *Memory) NewUser(email, password, username string, privilege int) (uuid string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for {
+		uuid = uid.New(8)
+		if _, exists := m.users[uuid]; !exists {
+			break
+		}
+	}
+
+	m.users[uuid] = models.User{
+		UUID:      uuid,
+		Email:     email,
+		Password:  password,
+		Username:  username,
+		Privilege: privilege,
+		Creation:  time.Now().Unix(),
+	}
+	return
+}
+
+// editUser applies an edit to a user if they exist.
+func (m *Memory) editUser(uuid string, edit func(user *models.User)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if user, ok := m.users[uuid]; ok {
+		edit(&user)
+		m.users[uuid] = user
+	}
+
+	return nil
+}
+
+// EditSelf updates a user's profile from settings.
+func (m *Memory) EditSelf(uuid, username, fname, lname, description string) error {
+	return m.editUser(uuid, func(user *models.User) {
+		user.Username = username
+		user.Fname = fname
+		user.Lname = lname
+		user.Description = description
+	})
+}
+
+// EditProfilePicture updates the file extension of a user's profile picture, empty if they have none.
+func (m *Memory) EditProfilePicture(uuid, extension string) error {
+	return m.editUser(uuid, func(user *models.User) {
+		user.ImageExtension = extension
+	})
+}
+
+// EditSelfEmail updates a user's email after verification.
+func (m *Memory) EditSelfEmail(uuid, email string) error {
+	return m.editUser(uuid, func(user *models.User) {
+		user.Email = email
+	})
+}
+
+// EditPassword updates a user's password.
+func (m *Memory) EditPassword(uuid, password string) error {
+	return m.editUser(uuid, func(user *models.User) {
+		user.Password = password
+	})
+}
+
+// EditPrivilege updates a user's privilege.
+func (m *Memory) EditPrivilege(uuid string, privilege int) error {
+	return m.editUser(uuid, func(user *models.User) {
+		user.Privilege = privilege
+	})
+}
+
+// DeleteUser deletes a user.
+func (m *Memory) DeleteUser(uuid string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.users, uuid)
+	return nil
+}
+
+// GetUserStats returns how many posts a user has made and the total score of their posts and comments.
+func (m *Memory) GetUserStats(uuid string) (stats models.UserStats, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, stored := range m.posts {
+		if stored.userUUID == uuid {
+			stats.Posts++
+			stats.Karma += stored.post.Score()
+		}
+	}
+
+	for _, stored := range m.comments {
+		if stored.comment.Owner.UUID == uuid {
+			stats.Karma += stored.comment.Score()
+		}
+	}
+
+	return
+}
+
+/*
+	Posts
+*/
+
+// withOwner returns a post with its owner filled in, the mutex must be held.
+func (m *Memory) withOwner(stored memoryPost) models.Post {
+	post := stored.post
+	post.Owner = m.users[stored.userUUID]
+	post.Owner.UUID = stored.userUUID
+	return post
+}
+
+// pagePosts returns a page of the posts included by a filter sorted by less, more is whether there is another page.
+// Posts which are otherwise equal are ordered by UUID, like the database.
+func (m *Memory) pagePosts(page int, include func(post models.Post) bool, less func(a, b models.Post) bool) (posts []models.Post, more bool, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var all []models.Post
+	for _, stored := range m.posts {
+		if post := m.withOwner(stored); include == nil || include(post) {
+			all = append(all, post)
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if less(all[i], all[j]) {
+			return true
+		} else if less(all[j], all[i]) {
+			return false
+		}
+
+		return all[i].UUID < all[j].UUID
+	})
+
+	start := page * models.PostsPerPage
+	if !models.ValidPage(page) || start >= len(all) {
+		return
+	}
+
+	end := start + models.PostsPerPage
+	if end < len(all) {
+		more = true
+	} else {
+		end = len(all)
+	}
+
+	posts = all[start:end]
+	return
+}
+
+// hotter returns if a post is before another in the hot posts.
+func hotter(a, b models.Post) bool {
+	if a.Rating != b.Rating {
+		return a.Rating > b.Rating
+	}
+
+	return a.Creation > b.Creation
+}
+
+// newer returns if a post was made after another.
+func newer(a, b models.Post) bool {
+	return a.Creation > b.Creation
+}
+
+// higher returns if a post has a higher score than another.
+func higher(a, b models.Post) bool {
+	if a.Score() != b.Score() {
+		return a.Score() > b.Score()
+	}
+
+	return newer(a, b)
+}
+
+// GetHotPosts returns a page of the hot posts, more is whether there is another page.
+func (m *Memory) GetHotPosts(page int) ([]models.Post, bool, error) {
+	return m.pagePosts(page, nil, hotter)
+}
+
+// GetNewPosts returns a page of the newest posts, more is whether there is another page.
+func (m *Memory) GetNewPosts(page int) ([]models.Post, bool, error) {
+	return m.pagePosts(page, nil, newer)
+}
+
+// GetUserPosts returns a page of a user's posts in an ordering (hot, new or top), more is whether there is another page.
+func (m *Memory) GetUserPosts(userUUID, sort string, page int) ([]models.Post, bool, error) {
+	less := newer
+	switch sort {
+	case models.SortHot:
+		less = hotter
+	case models.SortTop:
+		less = higher
+	}
+
+	return m.pagePosts(page, func(post models.Post) bool {
+		return post.Owner.UUID == userUUID
+	}, less)
+}
+
+// GetTopPosts returns a page of the highest scoring posts made since a unix time, more is whether there is another page.
+func (m *Memory) GetTopPosts(since int64, page int) ([]models.Post, bool, error) {
+	return m.pagePosts(page, func(post models.Post) bool {
+		return post.Creation >= since
+	}, higher)
+}
+
+// GetRisingPosts returns a page of the posts made within RisingPostsTime gaining score the fastest, more is whether there is another page.
+func (m *Memory) GetRisingPosts(page int) ([]models.Post, bool, error) {
+	now := time.Now().Unix()
+	rise := func(post models.Post) float64 {
+		return float64(post.Score()) / float64(now-post.Creation+3600)
+	}
+
+	return m.pagePosts(page, func(post models.Post) bool {
+		return post.Creation >= now-int64(models.RisingPostsTime/time.Second)
+	}, func(a, b models.Post) bool {
+		if rise(a) != rise(b) {
+			return rise(a) > rise(b)
+		}
+
+		return newer(a, b)
+	})
+}
+
+// GetControversialPosts returns a page of the posts with the most evenly split votes, more is whether there is another page.
+func (m *Memory) GetControversialPosts(page int) ([]models.Post, bool, error) {
+	return m.pagePosts(page, nil, func(a, b models.Post) bool {
+		if a.GetControversy() != b.GetControversy() {
+			return a.GetControversy() > b.GetControversy()
+		}
+
+		return newer(a, b)
+	})
+}
+
+// GetPost returns a post given a UUID.
+func (m *Memory) GetPost(uuid string) (post models.Post, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.posts[uuid]
+	if !ok {
+		post.UUID = uuid
+		return
+	}
+
+	post = m.withOwner(stored)
+	return
+}
+
+// NewPost creates a new post with its tags.
+func (m *Memory) NewPost(title, description, userUUID string, images []models.Image, tags []models.Tag) (post models.Post, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for {
+		post.UUID = uid.New(8)
+		if _, exists := m.posts[post.UUID]; !exists {
+			break
+		}
+	}
+
+	post = models.Post{
+		UUID:        post.UUID,
+		Title:       title,
+		Description: description,
+		Images:      images,
+		Creation:    time.Now().Unix(),
+	}
+
+	post.Rating = post.GetRating()
+
+	m.posts[post.UUID] = memoryPost{
+		post:     post,
+		userUUID: userUUID,
+	}
+
+	m.tagPost(post.UUID, tags)
+	return
+}
+
+// GetVote returns a user's vote on a post.
+func (m *Memory) GetVote(postUUID, userUUID string) (vote int, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return voteStatus(m.votes[postUUID][userUUID]), nil
+}
+
+// SetVote sets a vote on a post, voting the same way twice removes the vote.
+func (m *Memory) SetVote(post models.Post, uuid string, vote bool) (score int, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.posts[post.UUID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	value := voteDown
+	if vote {
+		value = voteUp
+	}
+
+	if _, ok := m.votes[post.UUID]; !ok {
+		m.votes[post.UUID] = make(map[string]int)
+	}
+
+	oldValue := m.votes[post.UUID][uuid]
+	if oldValue == value {
+		delete(m.votes[post.UUID], uuid)
+		value = 0
+	} else {
+		m.votes[post.UUID][uuid] = value
+	}
+
+	upvotes, downvotes := voteCounts(value)
+	oldUpvotes, oldDownvotes := voteCounts(oldValue)
+	stored.post.Upvotes += upvotes - oldUpvotes
+	stored.post.Downvotes += downvotes - oldDownvotes
+	stored.post.Rating = stored.post.GetRating()
+	m.posts[post.UUID] = stored
+
+	score = stored.post.Score()
+	return
+}
+
+// FindSimilarImages returns the images whose hash differs from a hash by at most a distance, closest first.
+func (m *Memory) FindSimilarImages(hash uint64, distance int) (similar []models.SimilarImage, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, stored := range m.posts {
+		for _, image := range stored.post.Images {
+			image := models.SimilarImage{
+				PostUUID: stored.post.UUID,
+				Key:      image.Key,
+				Distance: bits.OnesCount64(hash ^ image.Hash),
+			}
+
+			if image.Distance <= distance {
+				similar = append(similar, image)
+			}
+		}
+	}
+
+	similar = sortSimilarImages(similar)
+	return
+}
+
+/*
+	Comments
+*/
+
+// withVote returns a comment with its owner and the vote of a user filled in, the mutex must be held.
+func (m *Memory) withVote(stored memoryComment, userUUID string) models.Comment {
+	comment := stored.comment
+	comment.Owner = m.users[comment.Owner.UUID]
+	comment.Owner.UUID = stored.comment.Owner.UUID
+	comment.Vote = voteStatus(m.commentVotes[comment.ID][userUUID])
+	return comment
+}
+
+// GetComments returns a page of the top level comments of a post, best first, with all of their replies nested under them.
+func (m *Memory) GetComments(postUUID, userUUID string, page int) (comments []models.Comment, more bool, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var roots, replies []models.Comment
+	for _, stored := range m.comments {
+		if stored.comment.PostUUID != postUUID {
+			continue
+		}
+
+		if stored.rootID == 0 {
+			roots = append(roots, m.withVote(stored, userUUID))
+		} else {
+			replies = append(replies, m.withVote(stored, userUUID))
+		}
+	}
+
+	sort.Slice(roots, func(i, j int) bool {
+		if roots[i].Score() != roots[j].Score() {
+			return roots[i].Score() > roots[j].Score()
+		}
+
+		return roots[i].ID < roots[j].ID
+	})
+
+	sort.Slice(replies, func(i, j int) bool {
+		return replies[i].ID < replies[j].ID
+	})
+
+	start := page * models.CommentsPerPage
+	if !models.ValidPage(page) || start >= len(roots) {
+		return
+	}
+
+	end := start + models.CommentsPerPage
+	if end < len(roots) {
+		more = true
+	} else {
+		end = len(roots)
+	}
+
+	comments = commentTree(roots[start:end], replies)
+	return
+}
+
+// GetComment returns a comment given its ID, the ID is 0 if it doesn't exist.
+func (m *Memory) GetComment(id int64) (comment models.Comment, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if stored, ok := m.comments[id]; ok {
+		comment = m.withVote(stored, "")
+	}
+
+	return
+}
+
+// NewComment creates a new comment on a post, parentID is the comment it replies to or 0.
+func (m *Memory) NewComment(postUUID string, parentID int64, userUUID, body string) (comment models.Comment, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var rootID int64
+	if parentID != 0 {
+		parent, ok := m.comments[parentID]
+		if !ok {
+			return comment, sql.ErrNoRows
+		}
+
+		rootID = parent.rootID
+		if rootID == 0 {
+			rootID = parentID
+		}
+	}
+
+	m.nextComment++
+	comment = models.Comment{
+		ID:       m.nextComment,
+		ParentID: parentID,
+		PostUUID: postUUID,
+		Owner:    models.User{UUID: userUUID},
+		Body:     body,
+		Creation: time.Now().Unix(),
+	}
+
+	m.comments[comment.ID] = memoryComment{
+		comment: comment,
+		rootID:  rootID,
+	}
+
+	comment = m.withVote(m.comments[comment.ID], "")
+	return
+}
+
+// editComment applies an edit to a comment if it exists.
+func (m *Memory) editComment(id int64, edit func(comment *models.Comment)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if stored, ok := m.comments[id]; ok {
+		edit(&stored.comment)
+		m.comments[id] = stored
+	}
+
+	return nil
+}
+
+// EditComment replaces the body of a comment.
+func (m *Memory) EditComment(id int64, body string) error {
+	return m.editComment(id, func(comment *models.Comment) {
+		comment.Body = body
+		comment.Edited = time.Now().Unix()
+	})
+}
+
+// DeleteComment deletes the body of a comment, the comment stays so its replies keep their place in the thread.
+func (m *Memory) DeleteComment(id int64) error {
+	return m.editComment(id, func(comment *models.Comment) {
+		comment.Body = ""
+		comment.Deleted = true
+	})
+}
+
+// SetCommentVote sets a vote on a comment, voting the same way twice removes the vote.
+func (m *Memory) SetCommentVote(comment models.Comment, uuid string, vote bool) (score int, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.comments[comment.ID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	value := voteDown
+	if vote {
+		value = voteUp
+	}
+
+	if _, ok := m.commentVotes[comment.ID]; !ok {
+		m.commentVotes[comment.ID] = make(map[string]int)
+	}
+
+	oldValue := m.commentVotes[comment.ID][uuid]
+	if oldValue == value {
+		delete(m.commentVotes[comment.ID], uuid)
+		value = 0
+	} else {
+		m.commentVotes[comment.ID][uuid] = value
+	}
+
+	upvotes, downvotes := voteCounts(value)
+	oldUpvotes, oldDownvotes := voteCounts(oldValue)
+	stored.comment.Upvotes += upvotes - oldUpvotes
+	stored.comment.Downvotes += downvotes - oldDownvotes
+	m.comments[comment.ID] = stored
+
+	score = stored.comment.Score()
+	return
+}
+
+/*
+	Tags
+*/
+
+// canonicalTag returns a tag given its name following aliases, the mutex must be held.
+func (m *Memory) canonicalTag(name string) models.Tag {
+	tag, ok := m.tags[name]
+	if !ok {
+		return models.Tag{Name: name}
+	}
+
+	if tag.AliasOf != 0 {
+		for _, canonical := range m.tags {
+			if canonical.ID == tag.AliasOf {
+				return canonical
+			}
+		}
+	}
+
+	return tag
+}
+
+// tagPosts counts the posts with a tag, the mutex must be held.
+func (m *Memory) tagPosts(id int64) (posts int) {
+	for _, tags := range m.postTags {
+		if tags[id] {
+			posts++
+		}
+	}
+
+	return
+}
+
+// GetTag returns a tag given its name, aliases return the tag they are another name for.
+func (m *Memory) GetTag(name string) (models.Tag, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.canonicalTag(name), nil
+}
+
+// TagPost adds tags to a post, creating the tags which don't exist yet.
+func (m *Memory) TagPost(postUUID string, tags []models.Tag) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.tagPost(postUUID, tags)
+	return nil
+}
+
+// tagPost adds tags to a post, the caller must hold the mutex.
+func (m *Memory) tagPost(postUUID string, tags []models.Tag) {
+	if _, ok := m.postTags[postUUID]; !ok {
+		m.postTags[postUUID] = make(map[int64]bool)
+	}
+
+	for _, tag := range tags {
+		if _, ok := m.tags[tag.Name]; !ok {
+			m.nextTag++
+			m.tags[tag.Name] = models.Tag{
+				ID:   m.nextTag,
+				Name: tag.Name,
+				Kind: tag.Kind,
+			}
+		}
+
+		m.postTags[postUUID][m.canonicalTag(tag.Name).ID] = true
+	}
+}
+
+// GetPostTags returns the tags of a post.
+func (m *Memory) GetPostTags(postUUID string) (tags []models.Tag, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, tag := range m.tags {
+		if m.postTags[postUUID][tag.ID] {
+			tags = append(tags, tag)
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return
+}
+
+// GetTagPosts returns a page of the hot posts with a tag, more is whether there is another page.
+func (m *Memory) GetTagPosts(tagID int64, page int) ([]models.Post, bool, error) {
+	return m.pagePosts(page, func(post models.Post) bool {
+		return m.postTags[post.UUID][tagID]
+	}, hotter)
+}
+
+// SearchTags returns the most used tags starting with a prefix, aliases which match return the tag they are another name for.
+func (m *Memory) SearchTags(prefix string) (tags []models.Tag, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	found := make(map[int64]bool)
+	for name := range m.tags {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		tag := m.canonicalTag(name)
+		if !found[tag.ID] {
+			found[tag.ID] = true
+			tag.Posts = m.tagPosts(tag.ID)
+			tags = append(tags, tag)
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Posts != tags[j].Posts {
+			return tags[i].Posts > tags[j].Posts
+		}
+
+		return tags[i].Name < tags[j].Name
+	})
+
+	if len(tags) > tagSearchLimit {
+		tags = tags[:tagSearchLimit]
+	}
+
+	return
+}
+
+// MergeTags makes a tag an alias of another, moving its posts and aliases over.
+func (m *Memory) MergeTags(from, into string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	target := m.canonicalTag(into)
+	if target.ID == 0 {
+		return ErrTagNotFound
+	}
+
+	tag, ok := m.tags[from]
+	switch {
+	case !ok:
+		m.nextTag++
+		m.tags[from] = models.Tag{
+			ID:      m.nextTag,
+			Name:    from,
+			Kind:    target.Kind,
+			AliasOf: target.ID,
+		}
+		return nil
+	case tag.ID == target.ID || tag.AliasOf == target.ID:
+		return ErrSameTag
+	}
+
+	for _, tags := range m.postTags {
+		if tags[tag.ID] {
+			delete(tags, tag.ID)
+			tags[target.ID] = true
+		}
+	}
+
+	for name, alias := range m.tags {
+		if alias.ID == tag.ID || alias.AliasOf == tag.ID {
+			alias.AliasOf = target.ID
+			m.tags[name] = alias
+		}
+	}
+
+	return nil
+}
+
+/*
+	Search
+*/
+
+// Search returns the posts, users and tags matching a query using an index of everything in memory.
+func (m *Memory) Search(query search.Query) (search.Results, error) {
+	m.mutex.Lock()
+
+	var posts []models.Post
+	for uuid, stored := range m.posts {
+		post := m.withOwner(stored)
+		for _, tag := range m.tags {
+			if m.postTags[uuid][tag.ID] {
+				post.Tags = append(post.Tags, tag)
+			}
+		}
+
+		sort.Slice(post.Tags, func(i, j int) bool {
+			return post.Tags[i].Name < post.Tags[j].Name
+		})
+
+		posts = append(posts, post)
+	}
+
+	var users []models.User
+	for _, user := range m.users {
+		// Only the public details of users are searched, like the database.
+		user.Email, user.Password = "", ""
+		users = append(users, user)
+	}
+
+	var tags []models.Tag
+	for _, tag := range m.tags {
+		if tag.AliasOf == 0 {
+			tag.Posts = m.tagPosts(tag.ID)
+			tags = append(tags, tag)
+		}
+	}
+
+	m.mutex.Unlock()
+
+	index := search.NewIndex()
+	index.Load(posts, users, tags)
+	return index.Search(query)
+}
+
+/*
+	Tokens
+*/
+
+// StoreRefreshToken generates, stores and then returns a JTI.
+func (m *Memory) StoreRefreshToken(uuid string) (jti models.JTI, err error) {
+	jti.JTI, err = helpers.GenerateRandomString(32)
+	if err != nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.nextJTI++
+	jti.ID = m.nextJTI
+	jti.UserUUID = uuid
+	jti.Expiry = time.Now().Add(models.RefreshTokenValidTime).Unix()
+
+	m.jtis[jti.JTI] = jti
+	return
+}
+
+// GetJTI takes a JTI string and returns the JTI struct.
+func (m *Memory) GetJTI(jti string) (jtiStruct models.JTI, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	jtiStruct, ok := m.jtis[jti]
+	if !ok {
+		jtiStruct.JTI = jti
+		err = sql.ErrNoRows
+	}
+
+	return
+}
+
+// CheckJTI returns the validity of a JTI.
+func (m *Memory) CheckJTI(jti models.JTI) (valid bool, err error) {
+	if jti.Expiry > time.Now().Unix() {
+		return true, nil
+	}
+
+	return false, m.DeleteJTI(jti.JTI)
+}
+
+// DeleteJTI deletes a JTI based on a jti key.
+func (m *Memory) DeleteJTI(jti string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.jtis, jti)
+	return nil
+}
+
+// DeAuthUser removes all of a user's JTIs.
+func (m *Memory) DeAuthUser(uuid string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, jti := range m.jtis {
+		if jti.UserUUID == uuid {
+			delete(m.jtis, key)
+		}
+	}
+
+	return nil
+}
+
+/*
+	Verification and recovery codes
+*/
+
+// addMemoryCode replaces any code a user has with a new one stored by its hash, the mutex must be held.
+func addMemoryCode(codes map[string]memoryCode, userUUID, email string) (code string, err error) {
+	code, err = helpers.GenerateCode()
+	if err != nil {
+		return
+	}
+
+	for hash, stored := range codes {
+		if stored.userUUID == userUUID {
+			delete(codes, hash)
+		}
+	}
+
+	codes[helpers.HashCode(code)] = memoryCode{
+		userUUID: userUUID,
+		email:    email,
+		creation: time.Now().Unix(),
+	}
+	return
+}
+
+// takeMemoryCode retrieves and removes a code, returning nothing if it has expired, the mutex must be held.
+func takeMemoryCode(codes map[string]memoryCode, code string, ttl time.Duration) (userUUID, email string) {
+	hash := helpers.HashCode(code)
+
+	stored, ok := codes[hash]
+	delete(codes, hash)
+	if !ok || time.Unix(stored.creation, 0).Add(ttl).Before(time.Now()) {
+		return
+	}
+
+	return stored.userUUID, stored.email
+}
+
+// AddEmailVerification adds an email verification code.
+func (m *Memory) AddEmailVerification(userUUID, email string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return addMemoryCode(m.verifications, userUUID, email)
+}
+
+// GetEmailVerification retrieves and removes an email verification, codes older than the TTL are treated as if they don't exist.
+func (m *Memory) GetEmailVerification(code string, ttl time.Duration) (userUUID, email string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	userUUID, email = takeMemoryCode(m.verifications, code, ttl)
+	return
+}
+
+// GetEmailVerificationFromUser gets the email verification of a given user (if one exists).
+func (m *Memory) GetEmailVerificationFromUser(userUUID string) (uuid, email string, creation int64, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for code, stored := range m.verifications {
+		if stored.userUUID == userUUID {
+			return code, stored.email, stored.creation, nil
+		}
+	}
+
+	return
+}
+
+// AddRecovery adds a password recovery code.
+func (m *Memory) AddRecovery(userUUID, email string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return addMemoryCode(m.recoveries, userUUID, email)
+}
+
+// GetRecovery retrieves and removes a password recovery code, codes older than the TTL are treated as if they don't exist.
+func (m *Memory) GetRecovery(code string, ttl time.Duration) (userUUID, email string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	userUUID, email = takeMemoryCode(m.recoveries, code, ttl)
+	return
+}
+
+// GetRecoveryFromUser gets the recovery of a given user (if one exists).
+func (m *Memory) GetRecoveryFromUser(userUUID string) (uuid, email string, creation int64, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for code, stored := range m.recoveries {
+		if stored.userUUID == userUUID {
+			return code, stored.email, stored.creation, nil
+		}
+	}
+
+	return
+}
+
+// ResetPassword sets the password of the user a recovery code is for and removes the code, returning the user's UUID.
+// Codes older than the TTL are treated as if they don't exist and give an empty UUID.
+func (m *Memory) ResetPassword(code string, ttl time.Duration, password string) (userUUID string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	userUUID, _ = takeMemoryCode(m.recoveries, code, ttl)
+	if user, ok := m.users[userUUID]; ok {
+		user.Password = password
+		m.users[userUUID] = user
+	}
+
+	return
+}
+
+/*
+	Mail
+*/
+
+// QueueMail adds an email to the queue to be sent straight away.
+func (m *Memory) QueueMail(mail models.Mail) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now().Unix()
+
+	m.nextMail++
+	mail.ID = m.nextMail
+	mail.State = models.MailPending
+	mail.Attempts = 0
+	mail.NextAttempt = now
+	mail.LastError = ""
+	mail.Creation = now
+
+	m.mail = append(m.mail, mail)
+	return mail.ID, nil
+}
+
+// GetDueMail returns up to a limit of the pending emails which are due to be sent by a unix time, oldest first.
+func (m *Memory) GetDueMail(now int64, limit int) (mail []models.Mail, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, queued := range m.mail {
+		if queued.State == models.MailPending && queued.NextAttempt <= now {
+			mail = append(mail, queued)
+		}
+	}
+
+	sort.SliceStable(mail, func(i, j int) bool {
+		return mail[i].NextAttempt < mail[j].NextAttempt
+	})
+
+	if len(mail) > limit {
+		mail = mail[:limit]
+	}
+
+	return
+}
+
+// GetMail returns a page of the emails in a state, newest first, more is whether there is another page.
+func (m *Memory) GetMail(state string, page int) (mail []models.Mail, more bool, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i := len(m.mail) - 1; i >= 0; i-- {
+		if m.mail[i].State == state {
+			mail = append(mail, m.mail[i])
+		}
+	}
+
+	start := page * models.MailPerPage
+	if !models.ValidPage(page) || start >= len(mail) {
+		return nil, false, nil
+	}
+
+	mail = mail[start:]
+	if len(mail) > models.MailPerPage {
+		mail = mail[:models.MailPerPage]
+		more = true
+	}
+
+	return
+}
+
+// findMail returns a queued email given its ID, it is nil if it doesn't exist.
+// The caller must hold the mutex.
+func (m *Memory) findMail(id int64) *models.Mail {
+	for i := range m.mail {
+		if m.mail[i].ID == id {
+			return &m.mail[i]
+		}
+	}
+
+	return nil
+}
+
+// SetMailAttempt stores the outcome of trying to send an email: its state, attempts, next attempt and last error.
+// The body of a sent email is cleared as it contains links which could be used by anyone who reads the database.
+func (m *Memory) SetMailAttempt(mail models.Mail) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored := m.findMail(mail.ID)
+	if stored == nil {
+		return nil
+	}
+
+	stored.State, stored.Attempts, stored.NextAttempt, stored.LastError = mail.State, mail.Attempts, mail.NextAttempt, mail.LastError
+	if stored.State == models.MailSent {
+		stored.HTML, stored.Text = "", ""
+	}
+
+	return nil
+}
+
+// RetryMail puts a dead email back in the queue to be sent straight away with no attempts, unless its body has been cleared.
+func (m *Memory) RetryMail(id int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored := m.findMail(id)
+	if stored == nil || stored.State != models.MailDead || stored.Text == "" {
+		return nil
+	}
+
+	stored.State, stored.Attempts, stored.NextAttempt = models.MailPending, 0, time.Now().Unix()
+	return nil
+}
+
+// PurgeMail clears the bodies of dead emails queued before redactBefore, once their links have expired and they are no longer worth retrying.
+// Sent and dead emails queued before deleteBefore are deleted, returning how many were.
+func (m *Memory) PurgeMail(redactBefore, deleteBefore int64) (purged int64, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	kept := m.mail[:0]
+	for _, mail := range m.mail {
+		if mail.State != models.MailPending && mail.Creation < deleteBefore {
+			purged++
+			continue
+		}
+
+		if mail.State == models.MailDead && mail.Creation < redactBefore {
+			mail.HTML, mail.Text = "", ""
+		}
+
+		kept = append(kept, mail)
+	}
+
+	m.mail = kept
+	return
+}
@@ -0,0 +1,307 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Define migration errors.
+var (
+	ErrSchemaOutdated = errors.New("database schema is out of date, run the migrate command")
+	ErrSchemaTooNew   = errors.New("database schema is newer than this build")
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	version  int
+	name     string
+	up, down string
+}
+
+// hook is Go code run after the SQL of a migration, for data changes SQL alone can't express.
+type hook func(tx *sql.Tx) error
+
+var (
+	upHooks = map[int]hook{
+		2:  convertJSONVotes,
+		8:  setControversy,
+		10: hashCodes,
+		11: rerankAll,
+	}
+	downHooks = map[int]hook{
+		3: restoreJSONVotes,
+	}
+)
+
+// loadMigrations reads the embedded migrations of the current dialect ordered by version.
+// Files are named "<version>_<name>.up.sql" or "<version>_<name>.down.sql".
+func loadMigrations() (migrations []migration, err error) {
+	entries, err := migrationFiles.ReadDir(current.migrations)
+	if err != nil {
+		return
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		split := strings.SplitN(strings.TrimSuffix(name, "."+direction+".sql"), "_", 2)
+		if len(split) != 2 {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+
+		version, err := strconv.Atoi(split[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q", name)
+		}
+
+		contents, err := migrationFiles.ReadFile(path.Join(current.migrations, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: split[1]}
+			byVersion[version] = m
+		}
+
+		if direction == "up" {
+			m.up = string(contents)
+		} else {
+			m.down = string(contents)
+		}
+	}
+
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return
+}
+
+// statements splits a migration into the individual statements it contains.
+func statements(contents string) (stmts []string) {
+	var statement strings.Builder
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		statement.WriteString(line)
+		statement.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(statement.String()))
+			statement.Reset()
+		}
+	}
+
+	if strings.TrimSpace(statement.String()) != "" {
+		stmts = append(stmts, strings.TrimSpace(statement.String()))
+	}
+
+	return
+}
+
+func createMigrationsTable() (err error) {
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INT NOT NULL, name VARCHAR(255) NOT NULL, applied BIGINT NOT NULL, PRIMARY KEY (version))")
+	return
+}
+
+// SchemaVersion returns the version of the latest migration applied to the database.
+func SchemaVersion() (version int, err error) {
+	err = createMigrationsTable()
+	if err != nil {
+		return
+	}
+
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return
+}
+
+// LatestVersion returns the version of the newest migration in this build.
+func LatestVersion() (version int, err error) {
+	migrations, err := loadMigrations()
+	if err != nil || len(migrations) == 0 {
+		return
+	}
+
+	version = migrations[len(migrations)-1].version
+	return
+}
+
+// checkSchema makes sure the database schema matches this build.
+func checkSchema() (err error) {
+	version, err := SchemaVersion()
+	if err != nil {
+		return
+	}
+
+	latest, err := LatestVersion()
+	if err != nil {
+		return
+	}
+
+	if version < latest {
+		return ErrSchemaOutdated
+	} else if version > latest {
+		return ErrSchemaTooNew
+	}
+
+	return
+}
+
+// runMigration executes every statement of a migration and records the change in a transaction.
+// MySQL commits schema changes as soon as they run so a failed migration can leave some of them behind without its version being recorded.
+// Migrating again runs it from the start, so statements whose change is already in the schema are skipped.
+// The hook and the version are then recorded in a transaction of their own, so a hook is never kept without its version and can't run twice.
+func runMigration(m migration, up bool) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	contents := m.down
+	if up {
+		contents = m.up
+	}
+
+	for _, stmt := range statements(contents) {
+		applied := false
+		if current.applied != nil {
+			applied, err = current.applied(tx, stmt)
+		}
+
+		if err == nil && !applied {
+			_, err = tx.Exec(stmt)
+		}
+
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d_%s: %v", m.version, m.name, err)
+		}
+	}
+
+	if current.implicitCommit {
+		err = tx.Commit()
+		if err != nil {
+			return
+		}
+
+		tx, err = db.Begin()
+		if err != nil {
+			return
+		}
+	}
+
+	hooks := downHooks
+	if up {
+		hooks = upHooks
+	}
+
+	if hook, ok := hooks[m.version]; ok {
+		err = hook(tx)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d_%s: %v", m.version, m.name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)", m.version, m.name, time.Now().Unix())
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version=?", m.version)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	return tx.Commit()
+}
+
+// Migrate applies every migration newer than the database's schema version.
+func Migrate() (applied int, err error) {
+	version, err := SchemaVersion()
+	if err != nil {
+		return
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		err = runMigration(m, true)
+		if err != nil {
+			return
+		}
+
+		applied++
+	}
+
+	return
+}
+
+// Rollback reverts the given number of the most recently applied migrations.
+func Rollback(steps int) (reverted int, err error) {
+	version, err := SchemaVersion()
+	if err != nil {
+		return
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return
+	}
+
+	for i := len(migrations) - 1; i >= 0 && reverted < steps; i-- {
+		m := migrations[i]
+		if m.version > version {
+			continue
+		}
+
+		if m.down == "" {
+			return reverted, fmt.Errorf("migration %d_%s can't be reverted", m.version, m.name)
+		}
+
+		err = runMigration(m, false)
+		if err != nil {
+			return
+		}
+
+		reverted++
+	}
+
+	return
+}
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
+)
+
+// openMemory opens a new empty SQLite database in memory for a test.
+func openMemory(t *testing.T) {
+	err := Open(config.DB{Type: SQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+}
+
+// migrateTo applies the migrations up to and including a version, failing the test if one can't be.
+func migrateTo(t *testing.T, version int) {
+	if err := createMigrationsTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range migrations[:version] {
+		if err := runMigration(m, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// schemaVersion returns the schema version, failing the test if it can't be read.
+func schemaVersion(t *testing.T) int {
+	version, err := SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return version
+}
+
+func TestMigrateUpDownUp(t *testing.T) {
+	openMemory(t)
+
+	latest, err := LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []int{latest, 0, latest} {
+		var changed int
+		if want == 0 {
+			changed, err = Rollback(latest)
+		} else {
+			changed, err = Migrate()
+		}
+
+		if err != nil {
+			t.Fatalf("step %v: %v", i, err)
+		}
+
+		if changed != latest {
+			t.Errorf("step %v: changed %v migrations, want %v", i, changed, latest)
+		}
+
+		if version := schemaVersion(t); version != want {
+			t.Errorf("step %v: schema is at version %v, want %v", i, version, want)
+		}
+	}
+
+	if err := checkSchema(); err != nil {
+		t.Error(err)
+	}
+
+	// Migrating an up to date database does nothing.
+	if applied, err := Migrate(); err != nil || applied != 0 {
+		t.Errorf("migrating again applied %v migrations: %v", applied, err)
+	}
+}
+
+func TestRollbackDropsTables(t *testing.T) {
+	openMemory(t)
+
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	latest := schemaVersion(t)
+	if _, err := Rollback(latest); err != nil {
+		t.Fatal(err)
+	}
+
+	var tables []string
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+
+		tables = append(tables, name)
+	}
+
+	if !reflect.DeepEqual(tables, []string{"schema_migrations"}) {
+		t.Errorf("tables left after rolling back every migration: %v", tables)
+	}
+}
+
+func TestVoteHooks(t *testing.T) {
+	openMemory(t)
+	migrateTo(t, 1)
+
+	votes := map[string]bool{"a": true, "b": false, "c": true}
+	votesJSON, err := json.Marshal(votes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second post is from before votes were stored.
+	for _, post := range []struct{ uuid, votes string }{{"voted", string(votesJSON)}, {"old", ""}} {
+		_, err = db.Exec("INSERT INTO posts (uuid, useruuid, title, description, images, votes, rating, creation) VALUES (?, 'user', 'Cat', '', '[]', ?, 0, 1)", post.uuid, post.votes)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var upvotes, downvotes, count int
+	err = db.QueryRow("SELECT upvotes, downvotes FROM posts WHERE uuid='voted'").Scan(&upvotes, &downvotes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if upvotes != 2 || downvotes != 1 {
+		t.Errorf("converted post has %v upvotes and %v downvotes, want 2 and 1", upvotes, downvotes)
+	}
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM votes").Scan(&count); err != nil || count != 3 {
+		t.Errorf("votes table has %v votes, want 3: %v", count, err)
+	}
+
+	// Rolling back to before the JSON column was dropped restores it from the votes table.
+	if _, err := Rollback(schemaVersion(t) - 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var restoredJSON string
+	if err := db.QueryRow("SELECT votes FROM posts WHERE uuid='voted'").Scan(&restoredJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var restored map[string]bool
+	if err := json.Unmarshal([]byte(restoredJSON), &restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(restored, votes) {
+		t.Errorf("restored votes %v, want %v", restored, votes)
+	}
+}
+
+func TestFailedHookRollsBack(t *testing.T) {
+	openMemory(t)
+	migrateTo(t, 9)
+
+	_, err := db.Exec("INSERT INTO email (uuid, useruuid, email) VALUES ('abcd1234', 'user', 'user@example.com')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hook hashes every code and then fails, so nothing it did may be kept.
+	hashCodes := upHooks[10]
+	upHooks[10] = func(tx *sql.Tx) error {
+		if err := hashCodes(tx); err != nil {
+			return err
+		}
+
+		return errors.New("hook failed")
+	}
+
+	_, err = Migrate()
+	upHooks[10] = hashCodes
+
+	if err == nil || !strings.Contains(err.Error(), "hook failed") {
+		t.Fatalf("migrating with a failing hook returned %v", err)
+	}
+
+	if version := schemaVersion(t); version != 9 {
+		t.Errorf("schema is at version %v after the hook failed, want 9", version)
+	}
+
+	var code string
+	if err := db.QueryRow("SELECT uuid FROM email").Scan(&code); err != nil || code != "abcd1234" {
+		t.Errorf("code is %q after the hook failed, want it unchanged: %v", code, err)
+	}
+
+	// Migrating again hashes the code exactly once.
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow("SELECT uuid FROM email").Scan(&code); err != nil || code != helpers.HashCode("abcd1234") {
+		t.Errorf("code is %q after migrating again, want it hashed once: %v", code, err)
+	}
+}
+
+func TestParseSchemaChange(t *testing.T) {
+	cases := []struct {
+		stmt   string
+		change schemaChange
+		ok     bool
+	}{
+		{"ALTER TABLE posts ADD COLUMN score INT NOT NULL DEFAULT 0;", schemaChange{addColumn, "posts", "score", "int"}, true},
+		{"ALTER TABLE email DROP COLUMN creation;", schemaChange{dropColumn, "email", "creation", ""}, true},
+		{"ALTER TABLE posts ADD FULLTEXT KEY posts_title_search (title);", schemaChange{addIndex, "posts", "posts_title_search", ""}, true},
+		{"CREATE INDEX posts_new ON posts (creation);", schemaChange{addIndex, "posts", "posts_new", ""}, true},
+		{"ALTER TABLE tags DROP KEY tags_name_search;", schemaChange{dropIndex, "tags", "tags_name_search", ""}, true},
+		{"DROP INDEX posts_top ON posts;", schemaChange{dropIndex, "posts", "posts_top", ""}, true},
+		{"ALTER TABLE email MODIFY uuid VARCHAR(64) NOT NULL;", schemaChange{}, false},
+		{"CREATE TABLE IF NOT EXISTS votes (", schemaChange{}, false},
+		{"UPDATE posts SET score = upvotes - downvotes;", schemaChange{}, false},
+	}
+
+	for _, c := range cases {
+		change, ok := parseSchemaChange(c.stmt)
+		if ok != c.ok || change != c.change {
+			t.Errorf("%q: got %+v %v, want %+v %v", c.stmt, change, ok, c.change, c.ok)
+		}
+	}
+}
+
+func TestMySQLMigrationsCanBeRepeated(t *testing.T) {
+	entries, err := migrationFiles.ReadDir("migrations/mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every schema change must either be conditional or be checked in information_schema, except MODIFY which can always be repeated.
+	for _, entry := range entries {
+		contents, err := migrationFiles.ReadFile("migrations/mysql/" + entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, stmt := range statements(string(contents)) {
+			upper := strings.ToUpper(stmt)
+			switch {
+			case strings.HasPrefix(upper, "CREATE TABLE") && !strings.HasPrefix(upper, "CREATE TABLE IF NOT EXISTS"),
+				strings.HasPrefix(upper, "DROP TABLE") && !strings.HasPrefix(upper, "DROP TABLE IF EXISTS"):
+				t.Errorf("%v: %q isn't conditional", entry.Name(), stmt)
+			case strings.HasPrefix(upper, "ALTER TABLE") && !strings.Contains(upper, " MODIFY "),
+				strings.HasPrefix(upper, "CREATE INDEX"),
+				strings.HasPrefix(upper, "DROP INDEX"):
+				if _, ok := parseSchemaChange(stmt); !ok {
+					t.Errorf("%v: %q can't be checked in information_schema", entry.Name(), stmt)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS recovery;
+DROP TABLE IF EXISTS email;
+DROP TABLE IF EXISTS jti;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS users;
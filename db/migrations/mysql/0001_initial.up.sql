@@ -0,0 +1,56 @@
+-- Tables are only created if they don't exist so databases which predate migrations can adopt them.
+CREATE TABLE IF NOT EXISTS users (
+	uuid VARCHAR(8) NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	password VARCHAR(60) NOT NULL,
+	username VARCHAR(64) NOT NULL,
+	privilege TINYINT NOT NULL DEFAULT 0,
+	creation BIGINT NOT NULL,
+	fname VARCHAR(64) NOT NULL DEFAULT '',
+	lname VARCHAR(64) NOT NULL DEFAULT '',
+	description TEXT NOT NULL,
+	imageExtension VARCHAR(16) NOT NULL DEFAULT '',
+	PRIMARY KEY (uuid),
+	UNIQUE KEY users_email (email)
+);
+
+CREATE TABLE IF NOT EXISTS posts (
+	uuid VARCHAR(8) NOT NULL,
+	useruuid VARCHAR(8) NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	description TEXT NOT NULL,
+	images TEXT NOT NULL,
+	votes MEDIUMTEXT NOT NULL,
+	rating DOUBLE NOT NULL DEFAULT 0,
+	creation BIGINT NOT NULL,
+	PRIMARY KEY (uuid),
+	KEY posts_useruuid (useruuid),
+	KEY posts_hot (rating, creation)
+);
+
+CREATE TABLE IF NOT EXISTS jti (
+	id INT NOT NULL AUTO_INCREMENT,
+	jti VARCHAR(64) NOT NULL,
+	useruuid VARCHAR(8) NOT NULL,
+	expiry BIGINT NOT NULL,
+	PRIMARY KEY (id),
+	KEY jti_jti (jti),
+	KEY jti_useruuid (useruuid)
+);
+
+CREATE TABLE IF NOT EXISTS email (
+	uuid VARCHAR(8) NOT NULL,
+	useruuid VARCHAR(8) NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	PRIMARY KEY (uuid),
+	KEY email_useruuid (useruuid)
+);
+
+CREATE TABLE IF NOT EXISTS recovery (
+	uuid VARCHAR(8) NOT NULL,
+	useruuid VARCHAR(8) NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	creation BIGINT NOT NULL,
+	PRIMARY KEY (uuid),
+	KEY recovery_useruuid (useruuid)
+);
@@ -0,0 +1,12 @@
+-- Existing JSON votes are copied into the votes table by a Go hook once this has run.
+CREATE TABLE IF NOT EXISTS votes (
+	post_uuid VARCHAR(8) NOT NULL,
+	user_uuid VARCHAR(8) NOT NULL,
+	value TINYINT NOT NULL,
+	created BIGINT NOT NULL,
+	PRIMARY KEY (post_uuid, user_uuid),
+	KEY votes_user_uuid (user_uuid)
+);
+
+ALTER TABLE posts ADD COLUMN upvotes INT NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN downvotes INT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- The JSON votes are rebuilt from the votes table by a Go hook once this has run.
+ALTER TABLE posts ADD COLUMN votes MEDIUMTEXT NOT NULL;
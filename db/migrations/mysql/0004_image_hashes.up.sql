@@ -0,0 +1,8 @@
+-- Hashes of existing images are added by the backfill-hashes command.
+CREATE TABLE IF NOT EXISTS image_hashes (
+	post_uuid VARCHAR(8) NOT NULL,
+	image_key VARCHAR(64) NOT NULL,
+	hash BIGINT NOT NULL,
+	PRIMARY KEY (post_uuid, image_key),
+	KEY image_hashes_hash (hash)
+);
@@ -0,0 +1,26 @@
+-- Top level comments have a parent_id and root_id of 0, replies have the id of the top level comment as their root_id.
+CREATE TABLE IF NOT EXISTS comments (
+	id BIGINT NOT NULL AUTO_INCREMENT,
+	post_uuid VARCHAR(8) NOT NULL,
+	parent_id BIGINT NOT NULL DEFAULT 0,
+	root_id BIGINT NOT NULL DEFAULT 0,
+	user_uuid VARCHAR(8) NOT NULL,
+	body TEXT NOT NULL,
+	upvotes INT NOT NULL DEFAULT 0,
+	downvotes INT NOT NULL DEFAULT 0,
+	deleted TINYINT NOT NULL DEFAULT 0,
+	created BIGINT NOT NULL,
+	edited BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (id),
+	KEY comments_post (post_uuid, root_id),
+	KEY comments_root (root_id)
+);
+
+CREATE TABLE IF NOT EXISTS comment_votes (
+	comment_id BIGINT NOT NULL,
+	user_uuid VARCHAR(8) NOT NULL,
+	value TINYINT NOT NULL,
+	created BIGINT NOT NULL,
+	PRIMARY KEY (comment_id, user_uuid),
+	KEY comment_votes_user_uuid (user_uuid)
+);
@@ -0,0 +1,18 @@
+-- Aliases have the id of the tag they are another name for as their alias_of, other tags have 0.
+CREATE TABLE IF NOT EXISTS tags (
+	id BIGINT NOT NULL AUTO_INCREMENT,
+	name VARCHAR(32) NOT NULL,
+	kind VARCHAR(16) NOT NULL,
+	alias_of BIGINT NOT NULL DEFAULT 0,
+	created BIGINT NOT NULL,
+	PRIMARY KEY (id),
+	UNIQUE KEY tags_name (name),
+	KEY tags_alias_of (alias_of)
+);
+
+CREATE TABLE IF NOT EXISTS post_tags (
+	post_uuid VARCHAR(8) NOT NULL,
+	tag_id BIGINT NOT NULL,
+	PRIMARY KEY (post_uuid, tag_id),
+	KEY post_tags_tag_id (tag_id)
+);
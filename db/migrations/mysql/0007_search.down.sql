@@ -0,0 +1,4 @@
+ALTER TABLE tags DROP KEY tags_name_search;
+ALTER TABLE users DROP KEY users_username_search;
+ALTER TABLE posts DROP KEY posts_description_search;
+ALTER TABLE posts DROP KEY posts_title_search;
@@ -0,0 +1,5 @@
+-- Full-text indexes used by searches, posts index their fields separately so each can be weighted.
+ALTER TABLE posts ADD FULLTEXT KEY posts_title_search (title);
+ALTER TABLE posts ADD FULLTEXT KEY posts_description_search (description);
+ALTER TABLE users ADD FULLTEXT KEY users_username_search (username);
+ALTER TABLE tags ADD FULLTEXT KEY tags_name_search (name);
@@ -0,0 +1,6 @@
+DROP INDEX posts_controversial ON posts;
+DROP INDEX posts_top ON posts;
+DROP INDEX posts_new ON posts;
+
+ALTER TABLE posts DROP COLUMN controversy;
+ALTER TABLE posts DROP COLUMN score;
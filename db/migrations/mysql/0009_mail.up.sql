@@ -0,0 +1,15 @@
+-- Outgoing emails are queued and sent by a background worker, state is pending, sent or dead.
+CREATE TABLE IF NOT EXISTS mail (
+	id BIGINT NOT NULL AUTO_INCREMENT,
+	recipient VARCHAR(254) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	html MEDIUMTEXT NOT NULL,
+	text TEXT NOT NULL,
+	state VARCHAR(8) NOT NULL DEFAULT 'pending',
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt BIGINT NOT NULL,
+	last_error TEXT NOT NULL,
+	created BIGINT NOT NULL,
+	PRIMARY KEY (id),
+	KEY mail_due (state, next_attempt)
+);
@@ -0,0 +1,7 @@
+-- Hashed codes can't be turned back into codes so they are all removed.
+DELETE FROM email;
+DELETE FROM recovery;
+
+ALTER TABLE recovery MODIFY uuid VARCHAR(8) NOT NULL;
+ALTER TABLE email DROP COLUMN creation;
+ALTER TABLE email MODIFY uuid VARCHAR(8) NOT NULL;
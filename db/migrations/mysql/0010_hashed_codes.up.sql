@@ -0,0 +1,4 @@
+-- Verification and recovery codes are stored as SHA-256 hashes in the uuid column, existing codes are hashed by a Go hook.
+ALTER TABLE email MODIFY uuid VARCHAR(64) NOT NULL;
+ALTER TABLE email ADD COLUMN creation BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE recovery MODIFY uuid VARCHAR(64) NOT NULL;
@@ -0,0 +1 @@
+-- Ratings of every post are calculated again by a Go hook, as the Reddit ranker used to divide their age with integer division.
@@ -0,0 +1 @@
+ALTER TABLE image_hashes ADD KEY image_hashes_hash (hash);
@@ -0,0 +1,2 @@
+-- The index on hash couldn't be used, as similar hashes are found by counting the bits which differ from every hash.
+ALTER TABLE image_hashes DROP KEY image_hashes_hash;
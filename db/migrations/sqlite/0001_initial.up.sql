@@ -0,0 +1,53 @@
+CREATE TABLE users (
+	uuid TEXT NOT NULL PRIMARY KEY,
+	email TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	username TEXT NOT NULL,
+	privilege INTEGER NOT NULL DEFAULT 0,
+	creation INTEGER NOT NULL,
+	fname TEXT NOT NULL DEFAULT '',
+	lname TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	imageExtension TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE posts (
+	uuid TEXT NOT NULL PRIMARY KEY,
+	useruuid TEXT NOT NULL,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL,
+	images TEXT NOT NULL,
+	votes TEXT NOT NULL DEFAULT '{}',
+	rating REAL NOT NULL DEFAULT 0,
+	creation INTEGER NOT NULL
+);
+
+CREATE INDEX posts_useruuid ON posts (useruuid);
+CREATE INDEX posts_hot ON posts (rating, creation);
+
+CREATE TABLE jti (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	jti TEXT NOT NULL,
+	useruuid TEXT NOT NULL,
+	expiry INTEGER NOT NULL
+);
+
+CREATE INDEX jti_jti ON jti (jti);
+CREATE INDEX jti_useruuid ON jti (useruuid);
+
+CREATE TABLE email (
+	uuid TEXT NOT NULL PRIMARY KEY,
+	useruuid TEXT NOT NULL,
+	email TEXT NOT NULL
+);
+
+CREATE INDEX email_useruuid ON email (useruuid);
+
+CREATE TABLE recovery (
+	uuid TEXT NOT NULL PRIMARY KEY,
+	useruuid TEXT NOT NULL,
+	email TEXT NOT NULL,
+	creation INTEGER NOT NULL
+);
+
+CREATE INDEX recovery_useruuid ON recovery (useruuid);
@@ -0,0 +1,3 @@
+ALTER TABLE posts DROP COLUMN downvotes;
+ALTER TABLE posts DROP COLUMN upvotes;
+DROP TABLE votes;
@@ -0,0 +1,13 @@
+-- Existing JSON votes are copied into the votes table by a Go hook once this has run.
+CREATE TABLE votes (
+	post_uuid TEXT NOT NULL,
+	user_uuid TEXT NOT NULL,
+	value INTEGER NOT NULL,
+	created INTEGER NOT NULL,
+	PRIMARY KEY (post_uuid, user_uuid)
+);
+
+CREATE INDEX votes_user_uuid ON votes (user_uuid);
+
+ALTER TABLE posts ADD COLUMN upvotes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN downvotes INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- Hashes of existing images are added by the backfill-hashes command.
+CREATE TABLE image_hashes (
+	post_uuid TEXT NOT NULL,
+	image_key TEXT NOT NULL,
+	hash INTEGER NOT NULL,
+	PRIMARY KEY (post_uuid, image_key)
+);
+
+CREATE INDEX image_hashes_hash ON image_hashes (hash);
@@ -0,0 +1,27 @@
+-- Top level comments have a parent_id and root_id of 0, replies have the id of the top level comment as their root_id.
+CREATE TABLE comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	post_uuid TEXT NOT NULL,
+	parent_id INTEGER NOT NULL DEFAULT 0,
+	root_id INTEGER NOT NULL DEFAULT 0,
+	user_uuid TEXT NOT NULL,
+	body TEXT NOT NULL,
+	upvotes INTEGER NOT NULL DEFAULT 0,
+	downvotes INTEGER NOT NULL DEFAULT 0,
+	deleted INTEGER NOT NULL DEFAULT 0,
+	created INTEGER NOT NULL,
+	edited INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX comments_post ON comments (post_uuid, root_id);
+CREATE INDEX comments_root ON comments (root_id);
+
+CREATE TABLE comment_votes (
+	comment_id INTEGER NOT NULL,
+	user_uuid TEXT NOT NULL,
+	value INTEGER NOT NULL,
+	created INTEGER NOT NULL,
+	PRIMARY KEY (comment_id, user_uuid)
+);
+
+CREATE INDEX comment_votes_user_uuid ON comment_votes (user_uuid);
@@ -0,0 +1,18 @@
+-- Aliases have the id of the tag they are another name for as their alias_of, other tags have 0.
+CREATE TABLE tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	kind TEXT NOT NULL,
+	alias_of INTEGER NOT NULL DEFAULT 0,
+	created INTEGER NOT NULL
+);
+
+CREATE INDEX tags_alias_of ON tags (alias_of);
+
+CREATE TABLE post_tags (
+	post_uuid TEXT NOT NULL,
+	tag_id INTEGER NOT NULL,
+	PRIMARY KEY (post_uuid, tag_id)
+);
+
+CREATE INDEX post_tags_tag_id ON post_tags (tag_id);
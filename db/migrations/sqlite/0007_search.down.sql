@@ -0,0 +1 @@
+-- SQLite has no FULLTEXT indexes, searches use an in-memory index instead.
@@ -0,0 +1,2 @@
+-- SQLite has no FULLTEXT indexes, searches use an in-memory index instead.
+-- This migration keeps the versions of both databases the same.
@@ -0,0 +1,6 @@
+DROP INDEX posts_controversial;
+DROP INDEX posts_top;
+DROP INDEX posts_new;
+
+ALTER TABLE posts DROP COLUMN controversy;
+ALTER TABLE posts DROP COLUMN score;
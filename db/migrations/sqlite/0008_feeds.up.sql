@@ -0,0 +1,9 @@
+-- The controversy of existing posts is calculated by a Go hook once this has run.
+ALTER TABLE posts ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN controversy REAL NOT NULL DEFAULT 0;
+
+UPDATE posts SET score = upvotes - downvotes;
+
+CREATE INDEX posts_new ON posts (creation);
+CREATE INDEX posts_top ON posts (score, creation);
+CREATE INDEX posts_controversial ON posts (controversy, creation);
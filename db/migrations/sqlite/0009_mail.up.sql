@@ -0,0 +1,15 @@
+-- Outgoing emails are queued and sent by a background worker, state is pending, sent or dead.
+CREATE TABLE mail (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	recipient TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	html TEXT NOT NULL,
+	text TEXT NOT NULL,
+	state TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt INTEGER NOT NULL,
+	last_error TEXT NOT NULL,
+	created INTEGER NOT NULL
+);
+
+CREATE INDEX mail_due ON mail (state, next_attempt);
@@ -0,0 +1,5 @@
+-- Hashed codes can't be turned back into codes so they are all removed.
+DELETE FROM email;
+DELETE FROM recovery;
+
+ALTER TABLE email DROP COLUMN creation;
@@ -0,0 +1,2 @@
+-- Verification and recovery codes are stored as SHA-256 hashes in the uuid column, existing codes are hashed by a Go hook.
+ALTER TABLE email ADD COLUMN creation INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+-- Ratings are left as they are, they are only calculated differently.
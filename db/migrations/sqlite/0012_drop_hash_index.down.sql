@@ -0,0 +1 @@
+CREATE INDEX image_hashes_hash ON image_hashes (hash);
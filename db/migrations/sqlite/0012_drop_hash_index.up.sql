@@ -0,0 +1,2 @@
+-- The index on hash couldn't be used, as similar hashes are found by counting the bits which differ from every hash.
+DROP INDEX image_hashes_hash;
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"database/sql"
 	"encoding/json"
 	"time"
 
@@ -8,20 +9,86 @@ import (
 	"github.com/zemirco/uid"
 )
 
-// GetHotPosts will get the respective hot posts for a given page.
-func GetHotPosts(page int) (posts []models.Post, err error) {
-	rows, err := db.Query("SELECT P.uuid, P.title, P.description, P.images, P.votes, P.rating, P.creation, U.uuid, U.email, U.password, U.username, U.privilege, U.creation, U.fname, U.lname, U.description, U.imageExtension FROM posts AS P INNER JOIN users AS U ON P.useruuid = U.uuid ORDER BY P.rating DESC, P.creation DESC LIMIT ?, ?", page*models.PostsPerPage, models.PostsPerPage+page*models.PostsPerPage)
+// selectPosts selects posts with their owner.
+const selectPosts = "SELECT P.uuid, P.title, P.description, P.images, P.upvotes, P.downvotes, P.rating, P.creation, U.uuid, U.email, U.password, U.username, U.privilege, U.creation, U.fname, U.lname, U.description, U.imageExtension FROM posts AS P INNER JOIN users AS U ON P.useruuid = U.uuid"
+
+// GetHotPosts returns a page of the hot posts, more is whether there is another page.
+func GetHotPosts(page int) (posts []models.Post, more bool, err error) {
+	return pagePosts(selectPosts+" ORDER BY P.rating DESC, P.creation DESC, P.uuid", page)
+}
+
+// GetNewPosts returns a page of the newest posts, more is whether there is another page.
+func GetNewPosts(page int) (posts []models.Post, more bool, err error) {
+	return pagePosts(selectPosts+" ORDER BY P.creation DESC, P.uuid", page)
+}
+
+// GetTopPosts returns a page of the highest scoring posts made since a unix time, more is whether there is another page.
+func GetTopPosts(since int64, page int) (posts []models.Post, more bool, err error) {
+	return pagePosts(selectPosts+" WHERE P.creation >= ? ORDER BY P.score DESC, P.creation DESC, P.uuid", page, since)
+}
+
+// GetRisingPosts returns a page of the posts made within RisingPostsTime gaining score the fastest, more is whether there is another page.
+func GetRisingPosts(page int) (posts []models.Post, more bool, err error) {
+	// Posts are given an hour's head start so the newest posts don't rise from a single vote.
+	now := time.Now().Unix()
+	return pagePosts(selectPosts+" WHERE P.creation >= ? ORDER BY P.score * 1.0 / (? - P.creation + 3600) DESC, P.creation DESC, P.uuid", page, now-int64(models.RisingPostsTime/time.Second), now)
+}
+
+// GetControversialPosts returns a page of the posts with the most evenly split votes, more is whether there is another page.
+func GetControversialPosts(page int) (posts []models.Post, more bool, err error) {
+	return pagePosts(selectPosts+" ORDER BY P.controversy DESC, P.creation DESC, P.uuid", page)
+}
+
+// userPostOrders are the ORDER BY clauses of the orderings a user's posts can be listed in.
+var userPostOrders = map[string]string{
+	models.SortHot: "P.rating DESC, P.creation DESC, P.uuid",
+	models.SortNew: "P.creation DESC, P.uuid",
+	models.SortTop: "P.score DESC, P.creation DESC, P.uuid",
+}
+
+// GetUserPosts returns a page of a user's posts in an ordering (hot, new or top), more is whether there is another page.
+// Unknown orderings list the newest posts first.
+func GetUserPosts(userUUID, sort string, page int) (posts []models.Post, more bool, err error) {
+	order, ok := userPostOrders[sort]
+	if !ok {
+		order = userPostOrders[models.SortNew]
+	}
+
+	return pagePosts(selectPosts+" WHERE P.useruuid=? ORDER BY "+order, page, userUUID)
+}
+
+// pagePosts returns a page of the posts selected by a query built from selectPosts, more is whether there is another page.
+// Queries order by UUID last so posts which are otherwise equal never appear on two pages.
+func pagePosts(query string, page int, args ...interface{}) (posts []models.Post, more bool, err error) {
+	if !models.ValidPage(page) {
+		return
+	}
+
+	rows, err := db.Query(query+" LIMIT ? OFFSET ?", append(args, models.PostsPerPage+1, page*models.PostsPerPage)...)
 	if err != nil {
 		return
 	}
 
+	posts, err = scanPosts(rows)
+
+	// One more post than a page is selected to know if there is another page.
+	if len(posts) > models.PostsPerPage {
+		posts = posts[:models.PostsPerPage]
+		more = true
+	}
+
+	return
+}
+
+// scanPosts scans every row selected by selectPosts.
+func scanPosts(rows *sql.Rows) (posts []models.Post, err error) {
 	defer rows.Close()
 
 	for rows.Next() {
 		var post models.Post
-		var imagesJSON, votesJSON string
+		var imagesJSON string
 
-		err = rows.Scan(&post.UUID, &post.Title, &post.Description, &imagesJSON, &votesJSON, &post.Rating, &post.Creation, &post.Owner.UUID, &post.Owner.Email, &post.Owner.Password, &post.Owner.Username, &post.Owner.Privilege, &post.Owner.Creation, &post.Owner.Fname, &post.Owner.Lname, &post.Owner.Description, &post.Owner.ImageExtension) // Scan data from query.
+		err = rows.Scan(&post.UUID, &post.Title, &post.Description, &imagesJSON, &post.Upvotes, &post.Downvotes, &post.Rating, &post.Creation, &post.Owner.UUID, &post.Owner.Email, &post.Owner.Password, &post.Owner.Username, &post.Owner.Privilege, &post.Owner.Creation, &post.Owner.Fname, &post.Owner.Lname, &post.Owner.Description, &post.Owner.ImageExtension) // Scan data from query.
 		if err != nil {
 			return
 		}
@@ -31,28 +98,16 @@ func GetHotPosts(page int) (posts []models.Post, err error) {
 			return
 		}
 
-		err = json.Unmarshal([]byte(votesJSON), &post.Votes)
-		if err != nil {
-			return
-		}
-
-		for _, upvote := range post.Votes {
-			if upvote {
-				post.Upvotes++
-			} else {
-				post.Downvotes++
-			}
-		}
-
 		posts = append(posts, post)
 	}
 
+	err = rows.Err()
 	return
 }
 
 // GetPost returns a post given a UUID.
 func GetPost(uuid string) (post models.Post, err error) {
-	rows, err := db.Query("SELECT P.title, P.description, P.images, P.votes, P.rating, P.creation, U.uuid, U.email, U.password, U.username, U.privilege, U.creation, U.fname, U.lname, U.description, U.imageExtension FROM posts AS P INNER JOIN users AS U ON P.useruuid = U.uuid WHERE P.uuid=?", uuid)
+	rows, err := db.Query("SELECT P.title, P.description, P.images, P.upvotes, P.downvotes, P.rating, P.creation, U.uuid, U.email, U.password, U.username, U.privilege, U.creation, U.fname, U.lname, U.description, U.imageExtension FROM posts AS P INNER JOIN users AS U ON P.useruuid = U.uuid WHERE P.uuid=?", uuid)
 	if err != nil {
 		return
 	}
@@ -61,9 +116,9 @@ func GetPost(uuid string) (post models.Post, err error) {
 
 	post.UUID = uuid
 	if rows.Next() {
-		var imagesJSON, votesJSON string
+		var imagesJSON string
 
-		err = rows.Scan(&post.Title, &post.Description, &imagesJSON, &votesJSON, &post.Rating, &post.Creation, &post.Owner.UUID, &post.Owner.Email, &post.Owner.Password, &post.Owner.Username, &post.Owner.Privilege, &post.Owner.Creation, &post.Owner.Fname, &post.Owner.Lname, &post.Owner.Description, &post.Owner.ImageExtension) // Scan data from query.
+		err = rows.Scan(&post.Title, &post.Description, &imagesJSON, &post.Upvotes, &post.Downvotes, &post.Rating, &post.Creation, &post.Owner.UUID, &post.Owner.Email, &post.Owner.Password, &post.Owner.Username, &post.Owner.Privilege, &post.Owner.Creation, &post.Owner.Fname, &post.Owner.Lname, &post.Owner.Description, &post.Owner.ImageExtension) // Scan data from query.
 		if err != nil {
 			return
 		}
@@ -72,26 +127,13 @@ func GetPost(uuid string) (post models.Post, err error) {
 		if err != nil {
 			return
 		}
-
-		err = json.Unmarshal([]byte(votesJSON), &post.Votes)
-		if err != nil {
-			return
-		}
-
-		for _, upvote := range post.Votes {
-			if upvote {
-				post.Upvotes++
-			} else {
-				post.Downvotes++
-			}
-		}
 	}
 
 	return
 }
 
-// NewPost creates a new post.
-func NewPost(title, description, userUUID string, images []string) (post models.Post, err error) {
+// NewPost creates a new post with its tags.
+func NewPost(title, description, userUUID string, images []models.Image, tags []models.Tag) (post models.Post, err error) {
 	imagesJSON, err := json.Marshal(images)
 	if err != nil {
 		return
@@ -115,57 +157,125 @@ func NewPost(title, description, userUUID string, images []string) (post models.
 		Title:       title,
 		Description: description,
 		Images:      images,
-		Votes:       make(map[string]bool),
 		Creation:    time.Now().Unix(),
 	}
 
 	post.Rating = post.GetRating()
 
-	_, err = db.Exec("INSERT INTO posts (uuid, useruuid, title, description, images, votes, rating, creation) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", post.UUID, userUUID, post.Title, post.Description, imagesJSON, "{}", post.Rating, post.Creation)
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	_, err = tx.Exec("INSERT INTO posts (uuid, useruuid, title, description, images, rating, creation) VALUES (?, ?, ?, ?, ?, ?, ?)", post.UUID, userUUID, post.Title, post.Description, imagesJSON, post.Rating, post.Creation)
+	if err != nil {
+		return
+	}
+
+	err = setImageHashes(tx, post.UUID, images)
+	if err != nil {
+		return
+	}
 
+	// Tagging in the same transaction means a post is never published without its tags.
+	err = tagPost(tx, post.UUID, tags)
 	return
 }
 
-// SetVote sets a vote on a post.
-func SetVote(post models.Post, uuid string, vote bool) (score int, err error) {
-	if oldVote, ok := post.Votes[uuid]; ok {
-		if vote == oldVote {
-			if vote == true {
-				post.Upvotes--
-			} else {
-				post.Downvotes--
-			}
-
-			delete(post.Votes, uuid)
-		} else {
-			if vote == true {
-				post.Upvotes++
-				post.Downvotes--
-			} else {
-				post.Upvotes--
-				post.Downvotes++
-			}
-
-			post.Votes[uuid] = vote
-		}
-	} else {
-		if vote == true {
-			post.Upvotes++
-		} else {
-			post.Downvotes++
+// rerankBatch is how many posts Rerank rates in each transaction, so votes on the posts aren't blocked for long.
+const rerankBatch = 500
+
+// Rerank recalculates the rating of every post with the current ranker, returning how many posts were rated.
+// Decaying ratings change for posts of every age, so no post can be skipped.
+func Rerank() (reranked int, err error) {
+	after := ""
+	for {
+		var rated int
+		after, rated, err = rerankNext(after)
+		reranked += rated
+		if err != nil || rated < rerankBatch {
+			return
 		}
+	}
+}
 
-		post.Votes[uuid] = vote
+// rerankNext rates the next batch of posts after a UUID in a transaction of its own, returning the last UUID rated.
+func rerankNext(after string) (last string, rated int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
 	}
 
-	votesJSON, err := json.Marshal(post.Votes)
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	return rerank(tx, after, rerankBatch)
+}
+
+// rerank recalculates the rating of up to limit posts after a UUID, in order of their UUIDs, in a transaction.
+// The posts are locked so a vote can't change them between reading and rating them. It returns the last UUID rated.
+func rerank(tx *sql.Tx, after string, limit int) (last string, rated int, err error) {
+	rows, err := tx.Query("SELECT uuid, upvotes, downvotes, creation FROM posts WHERE uuid > ? ORDER BY uuid LIMIT ?"+current.forUpdate, after, limit)
 	if err != nil {
 		return
 	}
 
-	score = post.Score()
-	post.Rating = post.GetRating()
+	// Read every post first as a transaction can't run statements while rows are open.
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+
+		err = rows.Scan(&post.UUID, &post.Upvotes, &post.Downvotes, &post.Creation)
+		if err != nil {
+			rows.Close()
+			return
+		}
+
+		posts = append(posts, post)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	for _, post := range posts {
+		_, err = tx.Exec("UPDATE posts SET rating=? WHERE uuid=?", post.GetRating(), post.UUID)
+		if err != nil {
+			return
+		}
+
+		last = post.UUID
+	}
+
+	rated = len(posts)
+	return
+}
+
+// rerankAll rates every post again, as the Reddit ranker used to divide their age with integer division.
+func rerankAll(tx *sql.Tx) (err error) {
+	after, rated := "", rerankBatch
+	for rated == rerankBatch {
+		after, rated, err = rerank(tx, after, rerankBatch)
+		if err != nil {
+			return
+		}
+	}
 
-	_, err = db.Exec("UPDATE posts SET votes=?, rating=? WHERE uuid=?", votesJSON, post.Rating, post.UUID)
 	return
 }
@@ -1,43 +1,38 @@
 package db
 
 import (
+	"database/sql"
 	"time"
 
-	"github.com/zemirco/uid"
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
 )
 
-// AddEmailVerification adds an email verification code to the DB.
-func AddEmailVerification(userUUID, email string) (uuid string, err error) {
-	exists, err := rowExists("SELECT uuid FROM email WHERE useruuid=?", userUUID)
+// Verification and recovery codes are stored hashed in the uuid column so a leaked database can't be used to take over accounts.
+
+// AddEmailVerification adds an email verification code to the DB, replacing any the user already has.
+func AddEmailVerification(userUUID, email string) (code string, err error) {
+	code, err = helpers.GenerateCode()
 	if err != nil {
 		return
 	}
-	if exists {
-		_, err = db.Exec("DELETE FROM email WHERE useruuid=?", userUUID)
-		if err != nil {
-			return
-		}
-	}
 
-	for {
-		uuid = uid.New(8)
-		exists, err = rowExists("SELECT useruuid FROM email WHERE uuid=?", uuid)
-		if err != nil {
-			return uuid, err
-		}
-
-		if !exists {
-			break
-		}
+	_, err = db.Exec("DELETE FROM email WHERE useruuid=?", userUUID)
+	if err != nil {
+		return
 	}
 
-	_, err = db.Exec("INSERT INTO email (uuid, useruuid, email) VALUES (?, ?, ?)", uuid, userUUID, email)
+	_, err = db.Exec("INSERT INTO email (uuid, useruuid, email, creation) VALUES (?, ?, ?, ?)", helpers.HashCode(code), userUUID, email, time.Now().Unix())
 	return
 }
 
-// GetEmailVerification retrieves an email verification information.
-func GetEmailVerification(uuid string) (userUUID, email string, err error) {
-	rows, err := db.Query("SELECT useruuid, email FROM email WHERE uuid=?", uuid)
+// GetEmailVerification retrieves and removes an email verification, codes older than the TTL are treated as if they don't exist.
+func GetEmailVerification(code string, ttl time.Duration) (userUUID, email string, err error) {
+	return takeCode("email", code, ttl)
+}
+
+// GetEmailVerificationFromUser gets the email verification of a given user (if one exists), uuid is the code's hash.
+func GetEmailVerificationFromUser(userUUID string) (uuid, email string, creation int64, err error) {
+	rows, err := db.Query("SELECT uuid, email, creation FROM email WHERE useruuid=?", userUUID)
 	if err != nil {
 		return
 	}
@@ -45,70 +40,111 @@ func GetEmailVerification(uuid string) (userUUID, email string, err error) {
 	defer rows.Close()
 
 	if rows.Next() {
-		err = rows.Scan(&userUUID, &email)
-		if err != nil {
-			return
-		}
+		err = rows.Scan(&uuid, &email, &creation)
+	}
 
-		if userUUID != "" && email != "" {
-			_, err = db.Exec("DELETE FROM email WHERE uuid=?", uuid)
-		}
+	return
+}
+
+// AddRecovery adds a password recovery code to the DB, replacing any the user already has.
+func AddRecovery(userUUID, email string) (code string, err error) {
+	code, err = helpers.GenerateCode()
+	if err != nil {
+		return
+	}
+
+	_, err = db.Exec("DELETE FROM recovery WHERE useruuid=?", userUUID)
+	if err != nil {
+		return
 	}
 
+	_, err = db.Exec("INSERT INTO recovery (uuid, useruuid, email, creation) VALUES (?, ?, ?, ?)", helpers.HashCode(code), userUUID, email, time.Now().Unix())
 	return
 }
 
-// AddRecovery adds a password recovery code to the DB.
-func AddRecovery(userUUID, email string) (uuid string, err error) {
-	exists, err := rowExists("SELECT uuid FROM recovery WHERE useruuid=?", userUUID)
+// GetRecovery retrieves and removes a password recovery code from the DB, codes older than the TTL are treated as if they don't exist.
+func GetRecovery(code string, ttl time.Duration) (userUUID, email string, err error) {
+	return takeCode("recovery", code, ttl)
+}
+
+// ResetPassword sets the password of the user a recovery code is for and removes the code, returning the user's UUID.
+// Both happen in one transaction, so the code is only used up if the password is changed.
+// Codes older than the TTL are treated as if they don't exist and give an empty UUID.
+func ResetPassword(code string, ttl time.Duration, password string) (userUUID string, err error) {
+	tx, err := db.Begin()
 	if err != nil {
 		return
 	}
-	if exists {
-		_, err = db.Exec("DELETE FROM recovery WHERE useruuid=?", userUUID)
+
+	defer func() {
 		if err != nil {
+			tx.Rollback()
 			return
 		}
-	}
 
-	for {
-		uuid = uid.New(8)
-		exists, err = rowExists("SELECT useruuid FROM recovery WHERE uuid=?", uuid)
-		if err != nil {
-			return uuid, err
-		}
+		err = tx.Commit()
+	}()
 
-		if !exists {
-			break
-		}
+	userUUID, _, err = takeCodeTx(tx, "recovery", code, ttl)
+	if err != nil || userUUID == "" {
+		return
 	}
 
-	_, err = db.Exec("INSERT INTO recovery (uuid, useruuid, email, creation) VALUES (?, ?, ?, ?)", uuid, userUUID, email, time.Now().Unix())
+	_, err = tx.Exec("UPDATE users SET password=? WHERE uuid=?", password, userUUID)
 	return
 }
 
-// GetRecovery retrieves a password recovery code from the DB.
-func GetRecovery(uuid string) (userUUID, email string, err error) {
-	rows, err := db.Query("SELECT useruuid, email FROM recovery WHERE uuid=?", uuid)
+// takeCode retrieves and removes a code from a table of codes in a transaction, returning nothing if it has expired.
+func takeCode(table, code string, ttl time.Duration) (userUUID, email string, err error) {
+	tx, err := db.Begin()
 	if err != nil {
 		return
 	}
 
-	defer rows.Close()
-
-	if rows.Next() {
-		err = rows.Scan(&userUUID, &email)
+	defer func() {
 		if err != nil {
+			tx.Rollback()
 			return
 		}
 
-		_, err = db.Exec("DELETE FROM recovery WHERE uuid=?", uuid)
+		err = tx.Commit()
+	}()
+
+	return takeCodeTx(tx, table, code, ttl)
+}
+
+// takeCodeTx retrieves and removes a code from a table of codes, returning nothing if it has expired.
+// The code is locked and deleted in the transaction, so if requests race to use it only the one which deletes it gets it.
+func takeCodeTx(tx *sql.Tx, table, code string, ttl time.Duration) (userUUID, email string, err error) {
+	hash := helpers.HashCode(code)
+
+	var creation int64
+	err = tx.QueryRow("SELECT useruuid, email, creation FROM "+table+" WHERE uuid=?"+current.forUpdate, hash).Scan(&userUUID, &email, &creation)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	} else if err != nil {
+		return
+	}
+
+	// Codes can only be used once.
+	result, err := tx.Exec("DELETE FROM "+table+" WHERE uuid=?", hash)
+	if err != nil {
+		return
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if deleted != 1 || time.Unix(creation, 0).Add(ttl).Before(time.Now()) {
+		return "", "", nil
 	}
 
 	return
 }
 
-// GetRecoveryFromUser gets the recovery of a given user (if one exists).
+// GetRecoveryFromUser gets the recovery of a given user (if one exists), uuid is the code's hash.
 func GetRecoveryFromUser(userUUID string) (uuid, email string, creation int64, err error) {
 	rows, err := db.Query("SELECT uuid, email, creation FROM recovery WHERE useruuid=?", userUUID)
 	if err != nil {
@@ -123,3 +159,43 @@ func GetRecoveryFromUser(userUUID string) (uuid, email string, creation int64, e
 
 	return
 }
+
+// hashCodes hashes the codes stored before they were hashed, verifications are given the time of the migration as their creation.
+func hashCodes(tx *sql.Tx) (err error) {
+	for _, table := range []string{"email", "recovery"} {
+		var rows *sql.Rows
+		rows, err = tx.Query("SELECT uuid FROM " + table)
+		if err != nil {
+			return
+		}
+
+		// Read every code first as a transaction can't run statements while rows are open.
+		var codes []string
+		for rows.Next() {
+			var code string
+
+			err = rows.Scan(&code)
+			if err != nil {
+				rows.Close()
+				return
+			}
+
+			codes = append(codes, code)
+		}
+
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return
+		}
+
+		for _, code := range codes {
+			_, err = tx.Exec("UPDATE "+table+" SET uuid=? WHERE uuid=?", helpers.HashCode(code), code)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	_, err = tx.Exec("UPDATE email SET creation=? WHERE creation=0", time.Now().Unix())
+	return
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Kinds of schema changes which MySQL can't make conditionally with IF [NOT] EXISTS.
+const (
+	addColumn  = "add column"
+	dropColumn = "drop column"
+	addIndex   = "add index"
+	dropIndex  = "drop index"
+)
+
+// schemaChange is a column or index added or dropped by a migration statement.
+type schemaChange struct {
+	kind, table, name string
+	// dataType is the type of an added column, such as "int".
+	dataType string
+}
+
+// schemaChanges match the statements of schema changes, their groups are the table and then the name unless tableLast is set.
+var schemaChanges = []struct {
+	kind      string
+	pattern   *regexp.Regexp
+	tableLast bool
+}{
+	{addColumn, regexp.MustCompile(`(?i)^ALTER TABLE (\w+) ADD COLUMN (\w+) (\w+)`), false},
+	{dropColumn, regexp.MustCompile(`(?i)^ALTER TABLE (\w+) DROP COLUMN (\w+)`), false},
+	{addIndex, regexp.MustCompile(`(?i)^ALTER TABLE (\w+) ADD (?:UNIQUE |FULLTEXT )?(?:KEY|INDEX) (\w+)`), false},
+	{addIndex, regexp.MustCompile(`(?i)^CREATE (?:UNIQUE |FULLTEXT )?INDEX (\w+) ON (\w+)`), true},
+	{dropIndex, regexp.MustCompile(`(?i)^ALTER TABLE (\w+) DROP (?:KEY|INDEX) (\w+)`), false},
+	{dropIndex, regexp.MustCompile(`(?i)^DROP INDEX (\w+) ON (\w+)`), true},
+}
+
+// parseSchemaChange returns the column or index a statement adds or drops, ok is false for any other statement.
+func parseSchemaChange(stmt string) (change schemaChange, ok bool) {
+	for _, c := range schemaChanges {
+		match := c.pattern.FindStringSubmatch(strings.TrimSpace(stmt))
+		if match == nil {
+			continue
+		}
+
+		change.kind, change.table, change.name = c.kind, match[1], match[2]
+		if c.tableLast {
+			change.table, change.name = match[2], match[1]
+		}
+
+		if c.kind == addColumn {
+			change.dataType = strings.ToLower(match[3])
+		}
+
+		return change, true
+	}
+
+	return
+}
+
+// mysqlApplied returns if the change of a migration statement is already in the schema, checked in information_schema.
+// Columns which already exist with a different type are an error instead, as the schema has drifted from the migrations.
+func mysqlApplied(q querier, stmt string) (applied bool, err error) {
+	change, ok := parseSchemaChange(stmt)
+	if !ok {
+		return
+	}
+
+	switch change.kind {
+	case addColumn, dropColumn:
+		var dataType string
+		err = q.QueryRow("SELECT DATA_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=? AND COLUMN_NAME=?", change.table, change.name).Scan(&dataType)
+		if err == sql.ErrNoRows {
+			return change.kind == dropColumn, nil
+		} else if err != nil {
+			return
+		}
+
+		if change.kind == addColumn && !strings.EqualFold(dataType, change.dataType) {
+			return false, fmt.Errorf("column %v.%v already exists as %v instead of %v", change.table, change.name, dataType, change.dataType)
+		}
+
+		return change.kind == addColumn, nil
+	default:
+		var exists bool
+		err = q.QueryRow("SELECT EXISTS (SELECT 1 FROM information_schema.STATISTICS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=? AND INDEX_NAME=?)", change.table, change.name).Scan(&exists)
+		return exists == (change.kind == addIndex), err
+	}
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/VolticFroogo/Animal-Pictures/search"
+)
+
+var (
+	// index searches databases without full-text search, it is reloaded when older than HotPostsTickRate.
+	index       = search.NewIndex()
+	indexMutex  sync.Mutex
+	indexLoaded time.Time
+)
+
+// Search returns the posts, users and tags matching a query.
+func Search(query search.Query) (results search.Results, err error) {
+	if !current.fullText {
+		return indexSearch(query)
+	}
+
+	return fullTextSearch(query)
+}
+
+// postMatches is whether a post matches the query parameter in any indexed column, it takes the parameter four times.
+// Every MATCH is a condition of its own, so each can use the FULLTEXT index of its column.
+const postMatches = "(MATCH (P.title) AGAINST (?) OR MATCH (P.description) AGAINST (?) OR MATCH (U.username) AGAINST (?) OR EXISTS (SELECT 1 FROM post_tags AS PT INNER JOIN tags AS T ON PT.tag_id = T.id WHERE PT.post_uuid = P.uuid AND MATCH (T.name) AGAINST (?)))"
+
+// postRelevance is how well a post matches the query parameter, it takes the parameter four times.
+// It can't use the indexes, so it only orders the posts already filtered by postMatches.
+const postRelevance = "(MATCH (P.title) AGAINST (?) * 3 + MATCH (P.description) AGAINST (?) + MATCH (U.username) AGAINST (?) * 2 + COALESCE((SELECT SUM(MATCH (T.name) AGAINST (?)) FROM post_tags AS PT INNER JOIN tags AS T ON PT.tag_id = T.id WHERE PT.post_uuid = P.uuid), 0) * 2)"
+
+// fullTextSearch searches using the FULLTEXT indexes of MySQL.
+func fullTextSearch(query search.Query) (results search.Results, err error) {
+	results.Posts, results.More, err = fullTextPosts(query)
+	if err != nil || query.Text == "" {
+		return
+	}
+
+	results.Users, err = scanUsers("SELECT uuid, username, privilege, creation, imageExtension FROM users WHERE MATCH (username) AGAINST (?) ORDER BY MATCH (username) AGAINST (?) DESC, username LIMIT ?", query.Text, query.Text, search.Limit)
+	if err != nil {
+		return
+	}
+
+	results.Tags, err = scanTags("SELECT C.id, C.name, C.kind, COUNT(DISTINCT PT.post_uuid) AS posts FROM tags AS T INNER JOIN tags AS C ON C.id = CASE WHEN T.alias_of = 0 THEN T.id ELSE T.alias_of END LEFT JOIN post_tags AS PT ON PT.tag_id = C.id WHERE MATCH (T.name) AGAINST (?) GROUP BY C.id, C.name, C.kind ORDER BY posts DESC, C.name LIMIT ?", query.Text, search.Limit)
+	return
+}
+
+// fullTextPosts returns the page of posts matching a query using the FULLTEXT indexes, more is whether there is another page.
+func fullTextPosts(query search.Query) (posts []models.Post, more bool, err error) {
+	if !models.ValidPage(query.Page) {
+		return
+	}
+
+	text := []interface{}{query.Text, query.Text, query.Text, query.Text}
+
+	where := " WHERE P.creation >= ?"
+	args := []interface{}{query.Since}
+
+	if query.Text != "" {
+		where += " AND " + postMatches
+		args = append(args, text...)
+	}
+
+	if query.MinScore != search.NoMinScore {
+		where += " AND P.upvotes - P.downvotes >= ?"
+		args = append(args, query.MinScore)
+	}
+
+	if query.Author != "" {
+		where += " AND U.username = ?"
+		args = append(args, query.Author)
+	}
+
+	order := " ORDER BY P.rating DESC, P.creation DESC"
+	if query.Order == search.OrderRelevance && query.Text != "" {
+		order = " ORDER BY " + postRelevance + " DESC, P.rating DESC, P.creation DESC"
+		args = append(args, text...)
+	}
+
+	args = append(args, models.PostsPerPage+1, query.Page*models.PostsPerPage)
+
+	rows, err := db.Query(selectPosts+where+order+" LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		return
+	}
+
+	posts, err = scanPosts(rows)
+	if err != nil {
+		return
+	}
+
+	// One more post than a page is selected to know if there is another page.
+	if len(posts) > models.PostsPerPage {
+		posts = posts[:models.PostsPerPage]
+		more = true
+	}
+
+	for i := range posts {
+		posts[i].Tags, err = GetPostTags(posts[i].UUID)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// indexSearch searches using the in-memory index, loading it first if it is out of date.
+func indexSearch(query search.Query) (results search.Results, err error) {
+	indexMutex.Lock()
+	if time.Since(indexLoaded) > models.HotPostsTickRate {
+		err = loadIndex()
+		if err != nil {
+			indexMutex.Unlock()
+			return
+		}
+
+		indexLoaded = time.Now()
+	}
+	indexMutex.Unlock()
+
+	return index.Search(query)
+}
+
+// loadIndex loads every post, user and tag into the index.
+func loadIndex() (err error) {
+	rows, err := db.Query(selectPosts)
+	if err != nil {
+		return
+	}
+
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return
+	}
+
+	users, err := scanUsers("SELECT uuid, username, privilege, creation, imageExtension FROM users")
+	if err != nil {
+		return
+	}
+
+	tags, err := scanTags("SELECT T.id, T.name, T.kind, COUNT(PT.post_uuid) FROM tags AS T LEFT JOIN post_tags AS PT ON PT.tag_id = T.id WHERE T.alias_of = 0 GROUP BY T.id, T.name, T.kind")
+	if err != nil {
+		return
+	}
+
+	rows, err = db.Query("SELECT PT.post_uuid, T.id, T.name, T.kind FROM post_tags AS PT INNER JOIN tags AS T ON PT.tag_id = T.id ORDER BY T.name")
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	postTags := make(map[string][]models.Tag)
+	for rows.Next() {
+		var postUUID string
+		var tag models.Tag
+
+		err = rows.Scan(&postUUID, &tag.ID, &tag.Name, &tag.Kind)
+		if err != nil {
+			return
+		}
+
+		postTags[postUUID] = append(postTags[postUUID], tag)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+
+	for i := range posts {
+		posts[i].Tags = postTags[posts[i].UUID]
+	}
+
+	index.Load(posts, users, tags)
+	return
+}
+
+// scanUsers returns the public details of the users selected by a query.
+func scanUsers(query string, args ...interface{}) (users []models.User, err error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.User
+
+		err = rows.Scan(&user.UUID, &user.Username, &user.Privilege, &user.Creation, &user.ImageExtension)
+		if err != nil {
+			return
+		}
+
+		users = append(users, user)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// scanTags returns the tags and their number of posts selected by a query.
+func scanTags(query string, args ...interface{}) (tags []models.Tag, err error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag models.Tag
+
+		err = rows.Scan(&tag.ID, &tag.Name, &tag.Kind, &tag.Posts)
+		if err != nil {
+			return
+		}
+
+		tags = append(tags, tag)
+	}
+
+	err = rows.Err()
+	return
+}
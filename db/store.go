@@ -0,0 +1,398 @@
+package db
+
+import (
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/VolticFroogo/Animal-Pictures/search"
+)
+
+// UserStore stores users.
+type UserStore interface {
+	GetUserFromUUID(uuid string) (models.User, error)
+	GetUserFromEmail(email string) (models.User, error)
+	UserExistsFromEmail(email string) (bool, error)
+	NewUser(email, password, username string, privilege int) (string, error)
+	EditSelf(uuid, username, fname, lname, description string) error
+	EditProfilePicture(uuid, extension string) error
+	EditSelfEmail(uuid, email string) error
+	EditPassword(uuid, password string) error
+	EditPrivilege(uuid string, privilege int) error
+	DeleteUser(uuid string) error
+	GetUserStats(uuid string) (models.UserStats, error)
+}
+
+// PostStore stores posts and their votes.
+type PostStore interface {
+	GetHotPosts(page int) ([]models.Post, bool, error)
+	GetNewPosts(page int) ([]models.Post, bool, error)
+	GetTopPosts(since int64, page int) ([]models.Post, bool, error)
+	GetRisingPosts(page int) ([]models.Post, bool, error)
+	GetControversialPosts(page int) ([]models.Post, bool, error)
+	GetUserPosts(userUUID, sort string, page int) ([]models.Post, bool, error)
+	GetPost(uuid string) (models.Post, error)
+	NewPost(title, description, userUUID string, images []models.Image, tags []models.Tag) (models.Post, error)
+	GetVote(postUUID, userUUID string) (int, error)
+	SetVote(post models.Post, uuid string, vote bool) (int, error)
+	FindSimilarImages(hash uint64, distance int) ([]models.SimilarImage, error)
+}
+
+// CommentStore stores comments on posts and their votes.
+type CommentStore interface {
+	GetComments(postUUID, userUUID string, page int) ([]models.Comment, bool, error)
+	GetComment(id int64) (models.Comment, error)
+	NewComment(postUUID string, parentID int64, userUUID, body string) (models.Comment, error)
+	EditComment(id int64, body string) error
+	DeleteComment(id int64) error
+	SetCommentVote(comment models.Comment, uuid string, vote bool) (int, error)
+}
+
+// TagStore stores tags and which posts have them.
+type TagStore interface {
+	GetTag(name string) (models.Tag, error)
+	TagPost(postUUID string, tags []models.Tag) error
+	GetPostTags(postUUID string) ([]models.Tag, error)
+	GetTagPosts(tagID int64, page int) ([]models.Post, bool, error)
+	SearchTags(prefix string) ([]models.Tag, error)
+	MergeTags(from, into string) error
+}
+
+// TokenStore stores the JTIs of refresh tokens.
+type TokenStore interface {
+	StoreRefreshToken(uuid string) (models.JTI, error)
+	GetJTI(jti string) (models.JTI, error)
+	CheckJTI(jti models.JTI) (bool, error)
+	DeleteJTI(jti string) error
+	DeAuthUser(uuid string) error
+}
+
+// VerificationStore stores email verification and password recovery codes.
+type VerificationStore interface {
+	AddEmailVerification(userUUID, email string) (string, error)
+	GetEmailVerification(code string, ttl time.Duration) (string, string, error)
+	GetEmailVerificationFromUser(userUUID string) (string, string, int64, error)
+	AddRecovery(userUUID, email string) (string, error)
+	GetRecovery(code string, ttl time.Duration) (string, string, error)
+	GetRecoveryFromUser(userUUID string) (string, string, int64, error)
+	ResetPassword(code string, ttl time.Duration, password string) (string, error)
+}
+
+// MailStore stores the queue of outgoing emails.
+type MailStore interface {
+	QueueMail(mail models.Mail) (int64, error)
+	GetDueMail(now int64, limit int) ([]models.Mail, error)
+	GetMail(state string, page int) ([]models.Mail, bool, error)
+	SetMailAttempt(mail models.Mail) error
+	RetryMail(id int64) error
+	PurgeMail(redactBefore, deleteBefore int64) (int64, error)
+}
+
+// Stores groups together every store used by the handlers.
+type Stores struct {
+	Users         UserStore
+	Posts         PostStore
+	Comments      CommentStore
+	Tags          TagStore
+	Searcher      search.Searcher
+	Tokens        TokenStore
+	Verifications VerificationStore
+	Mail          MailStore
+}
+
+// SQLStores returns stores backed by the database opened with InitDB.
+func SQLStores() Stores {
+	return Stores{
+		Users:         SQL{},
+		Posts:         SQL{},
+		Comments:      SQL{},
+		Tags:          SQL{},
+		Searcher:      SQL{},
+		Tokens:        SQL{},
+		Verifications: SQL{},
+		Mail:          SQL{},
+	}
+}
+
+// NewMemoryStores returns stores backed by a new empty in-memory database.
+func NewMemoryStores() Stores {
+	memory := NewMemory()
+
+	return Stores{
+		Users:         memory,
+		Posts:         memory,
+		Comments:      memory,
+		Tags:          memory,
+		Searcher:      memory,
+		Tokens:        memory,
+		Verifications: memory,
+		Mail:          memory,
+	}
+}
+
+// SQL implements every store using the database opened with InitDB.
+type SQL struct{}
+
+// GetUserFromUUID calls GetUserFromUUID.
+func (SQL) GetUserFromUUID(uuid string) (models.User, error) {
+	return GetUserFromUUID(uuid)
+}
+
+// GetUserFromEmail calls GetUserFromEmail.
+func (SQL) GetUserFromEmail(email string) (models.User, error) {
+	return GetUserFromEmail(email)
+}
+
+// UserExistsFromEmail calls UserExistsFromEmail.
+func (SQL) UserExistsFromEmail(email string) (bool, error) {
+	return UserExistsFromEmail(email)
+}
+
+// NewUser calls NewUser.
+func (SQL) NewUser(email, password, username string, privilege int) (string, error) {
+	return NewUser(email, password, username, privilege)
+}
+
+// EditSelf calls EditSelf.
+func (SQL) EditSelf(uuid, username, fname, lname, description string) error {
+	return EditSelf(uuid, username, fname, lname, description)
+}
+
+// EditProfilePicture calls EditProfilePicture.
+func (SQL) EditProfilePicture(uuid, extension string) error {
+	return EditProfilePicture(uuid, extension)
+}
+
+// EditSelfEmail calls EditSelfEmail.
+func (SQL) EditSelfEmail(uuid, email string) error {
+	return EditSelfEmail(uuid, email)
+}
+
+// EditPassword calls EditPassword.
+func (SQL) EditPassword(uuid, password string) error {
+	return EditPassword(uuid, password)
+}
+
+// EditPrivilege calls EditPrivilege.
+func (SQL) EditPrivilege(uuid string, privilege int) error {
+	return EditPrivilege(uuid, privilege)
+}
+
+// DeleteUser calls DeleteUser.
+func (SQL) DeleteUser(uuid string) error {
+	return DeleteUser(uuid)
+}
+
+// GetUserStats calls GetUserStats.
+func (SQL) GetUserStats(uuid string) (models.UserStats, error) {
+	return GetUserStats(uuid)
+}
+
+// GetHotPosts calls GetHotPosts.
+func (SQL) GetHotPosts(page int) ([]models.Post, bool, error) {
+	return GetHotPosts(page)
+}
+
+// GetNewPosts calls GetNewPosts.
+func (SQL) GetNewPosts(page int) ([]models.Post, bool, error) {
+	return GetNewPosts(page)
+}
+
+// GetTopPosts calls GetTopPosts.
+func (SQL) GetTopPosts(since int64, page int) ([]models.Post, bool, error) {
+	return GetTopPosts(since, page)
+}
+
+// GetRisingPosts calls GetRisingPosts.
+func (SQL) GetRisingPosts(page int) ([]models.Post, bool, error) {
+	return GetRisingPosts(page)
+}
+
+// GetControversialPosts calls GetControversialPosts.
+func (SQL) GetControversialPosts(page int) ([]models.Post, bool, error) {
+	return GetControversialPosts(page)
+}
+
+// GetUserPosts calls GetUserPosts.
+func (SQL) GetUserPosts(userUUID, sort string, page int) ([]models.Post, bool, error) {
+	return GetUserPosts(userUUID, sort, page)
+}
+
+// GetPost calls GetPost.
+func (SQL) GetPost(uuid string) (models.Post, error) {
+	return GetPost(uuid)
+}
+
+// NewPost calls NewPost.
+func (SQL) NewPost(title, description, userUUID string, images []models.Image, tags []models.Tag) (models.Post, error) {
+	return NewPost(title, description, userUUID, images, tags)
+}
+
+// GetVote calls GetVote.
+func (SQL) GetVote(postUUID, userUUID string) (int, error) {
+	return GetVote(postUUID, userUUID)
+}
+
+// SetVote calls SetVote.
+func (SQL) SetVote(post models.Post, uuid string, vote bool) (int, error) {
+	return SetVote(post, uuid, vote)
+}
+
+// FindSimilarImages calls FindSimilarImages.
+func (SQL) FindSimilarImages(hash uint64, distance int) ([]models.SimilarImage, error) {
+	return FindSimilarImages(hash, distance)
+}
+
+// GetComments calls GetComments.
+func (SQL) GetComments(postUUID, userUUID string, page int) ([]models.Comment, bool, error) {
+	return GetComments(postUUID, userUUID, page)
+}
+
+// GetComment calls GetComment.
+func (SQL) GetComment(id int64) (models.Comment, error) {
+	return GetComment(id)
+}
+
+// NewComment calls NewComment.
+func (SQL) NewComment(postUUID string, parentID int64, userUUID, body string) (models.Comment, error) {
+	return NewComment(postUUID, parentID, userUUID, body)
+}
+
+// EditComment calls EditComment.
+func (SQL) EditComment(id int64, body string) error {
+	return EditComment(id, body)
+}
+
+// DeleteComment calls DeleteComment.
+func (SQL) DeleteComment(id int64) error {
+	return DeleteComment(id)
+}
+
+// SetCommentVote calls SetCommentVote.
+func (SQL) SetCommentVote(comment models.Comment, uuid string, vote bool) (int, error) {
+	return SetCommentVote(comment, uuid, vote)
+}
+
+// GetTag calls GetTag.
+func (SQL) GetTag(name string) (models.Tag, error) {
+	return GetTag(name)
+}
+
+// TagPost calls TagPost.
+func (SQL) TagPost(postUUID string, tags []models.Tag) error {
+	return TagPost(postUUID, tags)
+}
+
+// GetPostTags calls GetPostTags.
+func (SQL) GetPostTags(postUUID string) ([]models.Tag, error) {
+	return GetPostTags(postUUID)
+}
+
+// GetTagPosts calls GetTagPosts.
+func (SQL) GetTagPosts(tagID int64, page int) ([]models.Post, bool, error) {
+	return GetTagPosts(tagID, page)
+}
+
+// SearchTags calls SearchTags.
+func (SQL) SearchTags(prefix string) ([]models.Tag, error) {
+	return SearchTags(prefix)
+}
+
+// MergeTags calls MergeTags.
+func (SQL) MergeTags(from, into string) error {
+	return MergeTags(from, into)
+}
+
+// Search calls Search.
+func (SQL) Search(query search.Query) (search.Results, error) {
+	return Search(query)
+}
+
+// StoreRefreshToken calls StoreRefreshToken.
+func (SQL) StoreRefreshToken(uuid string) (models.JTI, error) {
+	return StoreRefreshToken(uuid)
+}
+
+// GetJTI calls GetJTI.
+func (SQL) GetJTI(jti string) (models.JTI, error) {
+	return GetJTI(jti)
+}
+
+// CheckJTI calls CheckJTI.
+func (SQL) CheckJTI(jti models.JTI) (bool, error) {
+	return CheckJTI(jti)
+}
+
+// DeleteJTI calls DeleteJTI.
+func (SQL) DeleteJTI(jti string) error {
+	return DeleteJTI(jti)
+}
+
+// DeAuthUser calls DeAuthUser.
+func (SQL) DeAuthUser(uuid string) error {
+	return DeAuthUser(uuid)
+}
+
+// AddEmailVerification calls AddEmailVerification.
+func (SQL) AddEmailVerification(userUUID, email string) (string, error) {
+	return AddEmailVerification(userUUID, email)
+}
+
+// GetEmailVerification calls GetEmailVerification.
+func (SQL) GetEmailVerification(code string, ttl time.Duration) (string, string, error) {
+	return GetEmailVerification(code, ttl)
+}
+
+// GetEmailVerificationFromUser calls GetEmailVerificationFromUser.
+func (SQL) GetEmailVerificationFromUser(userUUID string) (string, string, int64, error) {
+	return GetEmailVerificationFromUser(userUUID)
+}
+
+// AddRecovery calls AddRecovery.
+func (SQL) AddRecovery(userUUID, email string) (string, error) {
+	return AddRecovery(userUUID, email)
+}
+
+// GetRecovery calls GetRecovery.
+func (SQL) GetRecovery(code string, ttl time.Duration) (string, string, error) {
+	return GetRecovery(code, ttl)
+}
+
+// GetRecoveryFromUser calls GetRecoveryFromUser.
+func (SQL) GetRecoveryFromUser(userUUID string) (string, string, int64, error) {
+	return GetRecoveryFromUser(userUUID)
+}
+
+// ResetPassword calls ResetPassword.
+func (SQL) ResetPassword(code string, ttl time.Duration, password string) (string, error) {
+	return ResetPassword(code, ttl, password)
+}
+
+// QueueMail calls QueueMail.
+func (SQL) QueueMail(mail models.Mail) (int64, error) {
+	return QueueMail(mail)
+}
+
+// GetDueMail calls GetDueMail.
+func (SQL) GetDueMail(now int64, limit int) ([]models.Mail, error) {
+	return GetDueMail(now, limit)
+}
+
+// GetMail calls GetMail.
+func (SQL) GetMail(state string, page int) ([]models.Mail, bool, error) {
+	return GetMail(state, page)
+}
+
+// SetMailAttempt calls SetMailAttempt.
+func (SQL) SetMailAttempt(mail models.Mail) error {
+	return SetMailAttempt(mail)
+}
+
+// RetryMail calls RetryMail.
+func (SQL) RetryMail(id int64) error {
+	return RetryMail(id)
+}
+
+// PurgeMail calls PurgeMail.
+func (SQL) PurgeMail(redactBefore, deleteBefore int64) (int64, error) {
+	return PurgeMail(redactBefore, deleteBefore)
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// tagSearchLimit is the most tags returned when autocompleting.
+const tagSearchLimit = 10
+
+// Define tag errors.
+var (
+	ErrTagNotFound = errors.New("tag not found")
+	ErrSameTag     = errors.New("tags are already the same tag")
+)
+
+// querier runs queries on the database or in a transaction.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// getTag returns a tag given its name without following aliases, the ID is 0 if it doesn't exist.
+func getTag(q querier, name string) (tag models.Tag, err error) {
+	err = q.QueryRow("SELECT id, name, kind, alias_of FROM tags WHERE name=?", name).Scan(&tag.ID, &tag.Name, &tag.Kind, &tag.AliasOf)
+	if err == sql.ErrNoRows {
+		return models.Tag{Name: name}, nil
+	}
+
+	return
+}
+
+// canonicalTag returns a tag given its name, aliases return the tag they are another name for.
+func canonicalTag(q querier, name string) (tag models.Tag, err error) {
+	tag, err = getTag(q, name)
+	if err != nil || tag.AliasOf == 0 {
+		return
+	}
+
+	err = q.QueryRow("SELECT id, name, kind, alias_of FROM tags WHERE id=?", tag.AliasOf).Scan(&tag.ID, &tag.Name, &tag.Kind, &tag.AliasOf)
+	return
+}
+
+// GetTag returns a tag given its name, aliases return the tag they are another name for.
+// The ID is 0 if it doesn't exist.
+func GetTag(name string) (tag models.Tag, err error) {
+	return canonicalTag(db, name)
+}
+
+// TagPost adds tags to a post, creating the tags which don't exist yet.
+func TagPost(postUUID string, tags []models.Tag) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	err = tagPost(tx, postUUID, tags)
+	return
+}
+
+// tagPost adds tags to a post in a transaction, creating the tags which don't exist yet.
+func tagPost(q querier, postUUID string, tags []models.Tag) (err error) {
+	for _, tag := range tags {
+		// Tags which already exist keep their kind.
+		_, err = q.Exec("INSERT INTO tags (name, kind, created) VALUES (?, ?, ?)"+current.upsert([]string{"name"}, []string{"name"}), tag.Name, tag.Kind, time.Now().Unix())
+		if err != nil {
+			return
+		}
+
+		tag, err = canonicalTag(q, tag.Name)
+		if err != nil {
+			return
+		}
+
+		_, err = q.Exec("INSERT INTO post_tags (post_uuid, tag_id) VALUES (?, ?)"+current.upsert([]string{"post_uuid", "tag_id"}, []string{"tag_id"}), postUUID, tag.ID)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// GetPostTags returns the tags of a post.
+func GetPostTags(postUUID string) (tags []models.Tag, err error) {
+	rows, err := db.Query("SELECT T.id, T.name, T.kind FROM post_tags AS PT INNER JOIN tags AS T ON PT.tag_id = T.id WHERE PT.post_uuid=? ORDER BY T.name", postUUID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag models.Tag
+
+		err = rows.Scan(&tag.ID, &tag.Name, &tag.Kind)
+		if err != nil {
+			return
+		}
+
+		tags = append(tags, tag)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// GetTagPosts returns a page of the hot posts with a tag, more is whether there is another page.
+func GetTagPosts(tagID int64, page int) (posts []models.Post, more bool, err error) {
+	return pagePosts(selectPosts+" INNER JOIN post_tags AS PT ON PT.post_uuid = P.uuid WHERE PT.tag_id=? ORDER BY P.rating DESC, P.creation DESC, P.uuid", page, tagID)
+}
+
+// SearchTags returns the most used tags starting with a prefix, aliases which match return the tag they are another name for.
+func SearchTags(prefix string) (tags []models.Tag, err error) {
+	return scanTags("SELECT C.id, C.name, C.kind, COUNT(DISTINCT PT.post_uuid) AS posts FROM tags AS T INNER JOIN tags AS C ON C.id = CASE WHEN T.alias_of = 0 THEN T.id ELSE T.alias_of END LEFT JOIN post_tags AS PT ON PT.tag_id = C.id WHERE T.name LIKE ? GROUP BY C.id, C.name, C.kind ORDER BY posts DESC, C.name LIMIT ?", prefix+"%", tagSearchLimit)
+}
+
+// MergeTags makes a tag an alias of another, moving its posts and aliases over.
+// If the tag doesn't exist it is created as an alias.
+func MergeTags(from, into string) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	target, err := canonicalTag(tx, into)
+	if err != nil {
+		return
+	}
+
+	if target.ID == 0 {
+		return ErrTagNotFound
+	}
+
+	tag, err := getTag(tx, from)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case tag.ID == 0:
+		_, err = tx.Exec("INSERT INTO tags (name, kind, alias_of, created) VALUES (?, ?, ?, ?)", from, target.Kind, target.ID, time.Now().Unix())
+		return
+	case tag.ID == target.ID || tag.AliasOf == target.ID:
+		return ErrSameTag
+	case tag.AliasOf != 0:
+		// Aliases don't have posts so only need to point to the new tag.
+		_, err = tx.Exec("UPDATE tags SET alias_of=? WHERE id=?", target.ID, tag.ID)
+		return
+	}
+
+	_, err = tx.Exec("INSERT INTO post_tags (post_uuid, tag_id) SELECT post_uuid, ? FROM post_tags WHERE tag_id=?"+current.upsert([]string{"post_uuid", "tag_id"}, []string{"tag_id"}), target.ID, tag.ID)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM post_tags WHERE tag_id=?", tag.ID)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec("UPDATE tags SET alias_of=? WHERE id=? OR alias_of=?", target.ID, tag.ID, tag.ID)
+	return
+}
@@ -64,9 +64,15 @@ func EditUserNoPassword(ID int, Email, Fname, Lname string, Privileges int) (err
 	return
 }
 
-// EditSelf updates a user from settings.
-func EditSelf(uuid, password, username string) (err error) {
-	_, err = db.Exec("UPDATE users SET username=?, password=? WHERE uuid=?", username, password, uuid)
+// EditSelf updates a user's profile from settings.
+func EditSelf(uuid, username, fname, lname, description string) (err error) {
+	_, err = db.Exec("UPDATE users SET username=?, fname=?, lname=?, description=? WHERE uuid=?", username, fname, lname, description, uuid)
+	return
+}
+
+// EditProfilePicture updates the file extension of a user's profile picture, empty if they have none.
+func EditProfilePicture(uuid, extension string) (err error) {
+	_, err = db.Exec("UPDATE users SET imageExtension=? WHERE uuid=?", extension, uuid)
 	return
 }
 
@@ -95,6 +101,39 @@ func DeleteUser(uuid string) (err error) {
 	return
 }
 
+// PurgeUnverifiedUsers deletes the users who were created before a time and never verified their email, returning how many were deleted.
+func PurgeUnverifiedUsers(before int64) (purged int64, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	// Their codes are deleted first so none are left pointing at deleted users.
+	for _, table := range []string{"email", "recovery"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE useruuid IN (SELECT uuid FROM users WHERE privilege=? AND creation<?)", models.PrivUnverified, before)
+		if err != nil {
+			return
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM users WHERE privilege=? AND creation<?", models.PrivUnverified, before)
+	if err != nil {
+		return
+	}
+
+	purged, err = result.RowsAffected()
+	return
+}
+
 // EditSelfEmail updates a user's email after verification.
 func EditSelfEmail(uuid string, email string) (err error) {
 	_, err = db.Exec("UPDATE users SET email=? WHERE uuid=?", email, uuid)
@@ -112,3 +151,16 @@ func EditPrivilege(uuid string, privilege int) (err error) {
 	_, err = db.Exec("UPDATE users SET privilege=? WHERE uuid=?", privilege, uuid)
 	return
 }
+
+// GetUserStats returns how many posts a user has made and the total score of their posts and comments.
+func GetUserStats(uuid string) (stats models.UserStats, err error) {
+	var postKarma, commentKarma int
+	err = db.QueryRow("SELECT COUNT(*), COALESCE(SUM(upvotes - downvotes), 0) FROM posts WHERE useruuid=?", uuid).Scan(&stats.Posts, &postKarma)
+	if err != nil {
+		return
+	}
+
+	err = db.QueryRow("SELECT COALESCE(SUM(upvotes - downvotes), 0) FROM comments WHERE user_uuid=?", uuid).Scan(&commentKarma)
+	stats.Karma = postKarma + commentKarma
+	return
+}
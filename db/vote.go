@@ -0,0 +1,273 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// Vote values stored in the votes table.
+const (
+	voteUp   = 1
+	voteDown = -1
+)
+
+// GetVote returns a user's vote on a post: models.VoteNone, models.VoteUp or models.VoteDown.
+func GetVote(postUUID, userUUID string) (vote int, err error) {
+	var value int
+	err = db.QueryRow("SELECT value FROM votes WHERE post_uuid=? AND user_uuid=?", postUUID, userUUID).Scan(&value)
+	if err == sql.ErrNoRows {
+		return models.VoteNone, nil
+	} else if err != nil {
+		return
+	}
+
+	return voteStatus(value), nil
+}
+
+// voteStatus converts a vote value into models.VoteNone, models.VoteUp or models.VoteDown.
+func voteStatus(value int) int {
+	switch value {
+	case voteUp:
+		return models.VoteUp
+	case voteDown:
+		return models.VoteDown
+	}
+
+	return models.VoteNone
+}
+
+// SetVote sets a vote on a post, voting the same way twice removes the vote.
+func SetVote(post models.Post, uuid string, vote bool) (score int, err error) {
+	value := voteDown
+	if vote {
+		value = voteUp
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	// Lock the post so votes on it are applied one at a time.
+	err = tx.QueryRow("SELECT upvotes, downvotes FROM posts WHERE uuid=?"+current.forUpdate, post.UUID).Scan(&post.Upvotes, &post.Downvotes)
+	if err != nil {
+		return
+	}
+
+	var oldValue int
+	err = tx.QueryRow("SELECT value FROM votes WHERE post_uuid=? AND user_uuid=?", post.UUID, uuid).Scan(&oldValue)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+
+	if oldValue == value {
+		// Voting the same way again removes the vote.
+		_, err = tx.Exec("DELETE FROM votes WHERE post_uuid=? AND user_uuid=?", post.UUID, uuid)
+		value = 0
+	} else {
+		_, err = tx.Exec("INSERT INTO votes (post_uuid, user_uuid, value, created) VALUES (?, ?, ?, ?)"+current.upsert([]string{"post_uuid", "user_uuid"}, []string{"value", "created"}), post.UUID, uuid, value, time.Now().Unix())
+	}
+
+	if err != nil {
+		return
+	}
+
+	upvotes, downvotes := voteCounts(value)
+	oldUpvotes, oldDownvotes := voteCounts(oldValue)
+	post.Upvotes += upvotes - oldUpvotes
+	post.Downvotes += downvotes - oldDownvotes
+
+	score = post.Score()
+	post.Rating = post.GetRating()
+
+	_, err = tx.Exec("UPDATE posts SET upvotes=?, downvotes=?, score=?, rating=?, controversy=? WHERE uuid=?", post.Upvotes, post.Downvotes, score, post.Rating, post.GetControversy(), post.UUID)
+	return
+}
+
+// voteCounts converts a vote value into how many upvotes and downvotes it adds.
+func voteCounts(value int) (upvotes, downvotes int) {
+	switch value {
+	case voteUp:
+		return 1, 0
+	case voteDown:
+		return 0, 1
+	}
+
+	return 0, 0
+}
+
+/*
+	Migration hooks moving votes between the posts JSON column and the votes table and calculating controversy.
+*/
+
+// convertJSONVotes copies the JSON votes of every post into the votes table and counters.
+func convertJSONVotes(tx *sql.Tx) (err error) {
+	rows, err := tx.Query("SELECT uuid, votes, creation FROM posts")
+	if err != nil {
+		return
+	}
+
+	type postVotes struct {
+		uuid     string
+		creation int64
+		votes    map[string]bool
+	}
+
+	// Read every post first as a transaction can't run statements while rows are open.
+	var posts []postVotes
+	for rows.Next() {
+		var post postVotes
+		var votesJSON string
+
+		err = rows.Scan(&post.uuid, &votesJSON, &post.creation)
+		if err != nil {
+			rows.Close()
+			return
+		}
+
+		// Posts from before votes were stored can have an empty column, which means nobody voted.
+		if votesJSON == "" {
+			votesJSON = "{}"
+		}
+
+		err = json.Unmarshal([]byte(votesJSON), &post.votes)
+		if err != nil {
+			rows.Close()
+			return
+		}
+
+		posts = append(posts, post)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	for _, post := range posts {
+		var upvotes, downvotes int
+
+		for userUUID, upvote := range post.votes {
+			value := voteDown
+			if upvote {
+				value = voteUp
+				upvotes++
+			} else {
+				downvotes++
+			}
+
+			// The time of the original vote is unknown so the post's creation is used.
+			// Votes copied by an earlier failed run are overwritten so the migration can be repeated.
+			_, err = tx.Exec("INSERT INTO votes (post_uuid, user_uuid, value, created) VALUES (?, ?, ?, ?)"+current.upsert([]string{"post_uuid", "user_uuid"}, []string{"value", "created"}), post.uuid, userUUID, value, post.creation)
+			if err != nil {
+				return
+			}
+		}
+
+		_, err = tx.Exec("UPDATE posts SET upvotes=?, downvotes=? WHERE uuid=?", upvotes, downvotes, post.uuid)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// restoreJSONVotes rebuilds the JSON votes of every post from the votes table.
+func restoreJSONVotes(tx *sql.Tx) (err error) {
+	rows, err := tx.Query("SELECT post_uuid, user_uuid, value FROM votes")
+	if err != nil {
+		return
+	}
+
+	votes := make(map[string]map[string]bool)
+	for rows.Next() {
+		var postUUID, userUUID string
+		var value int
+
+		err = rows.Scan(&postUUID, &userUUID, &value)
+		if err != nil {
+			rows.Close()
+			return
+		}
+
+		if _, ok := votes[postUUID]; !ok {
+			votes[postUUID] = make(map[string]bool)
+		}
+
+		votes[postUUID][userUUID] = value == voteUp
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	_, err = tx.Exec("UPDATE posts SET votes='{}'")
+	if err != nil {
+		return
+	}
+
+	for postUUID, postVotes := range votes {
+		var votesJSON []byte
+		votesJSON, err = json.Marshal(postVotes)
+		if err != nil {
+			return
+		}
+
+		_, err = tx.Exec("UPDATE posts SET votes=? WHERE uuid=?", votesJSON, postUUID)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// setControversy calculates the controversy of every post which has both upvotes and downvotes.
+func setControversy(tx *sql.Tx) (err error) {
+	rows, err := tx.Query("SELECT uuid, upvotes, downvotes FROM posts WHERE upvotes > 0 AND downvotes > 0")
+	if err != nil {
+		return
+	}
+
+	// Read every post first as a transaction can't run statements while rows are open.
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+
+		err = rows.Scan(&post.UUID, &post.Upvotes, &post.Downvotes)
+		if err != nil {
+			rows.Close()
+			return
+		}
+
+		posts = append(posts, post)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	for _, post := range posts {
+		_, err = tx.Exec("UPDATE posts SET controversy=? WHERE uuid=?", post.GetControversy(), post.UUID)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -4,131 +4,125 @@ import (
 	"bytes"
 	"html/template"
 	"log"
+	"net/url"
+	text "text/template"
 
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
 	"github.com/VolticFroogo/Animal-Pictures/models"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ses"
 )
 
-// Register sends the account registry email.
-func Register(code, username, email string) (err error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("eu-west-1")},
-	)
-	if err != nil {
-		return
+var (
+	// Mail is the mail backend chosen by Init.
+	Mail Mailer
+
+	baseURL string
+)
+
+// Init initialises the mail backend chosen by the configuration and sets the base URL used in links.
+func Init(config config.Email, base string) (err error) {
+	baseURL = base
+
+	switch config.Driver {
+	case DriverSES:
+		Mail, err = NewSES(config.Sender, config.Region)
+	case DriverSMTP:
+		Mail, err = NewSMTP(config.Sender, config.SMTPAddress, config.SMTPUsername, config.SMTPPassword)
+	case DriverFile:
+		Mail, err = NewFile(config.Sender, config.Path)
+	default:
+		err = ErrUnknownDriver
 	}
 
-	// Create an SES session.
-	svc := ses.New(sess)
+	return
+}
 
-	t, err := template.ParseFiles("templates/email/register.html") // Parse the HTML page.
+// render renders the HTML and text templates of an email, templates/email/name.html and templates/email/name.txt.
+func render(name, subject string, variables models.EmailTemplateVariables) (message Message, err error) {
+	message.Subject = subject
+
+	t, err := template.ParseFiles("templates/email/" + name + ".html") // Parse the HTML page.
 	if err != nil {
 		log.Printf("Template parsing error: %v", err)
 		return
 	}
 
-	variables := models.EmailTemplateVariables{
-		Code:     code,
-		Username: username,
+	var html bytes.Buffer
+	err = t.Execute(&html, variables)
+	if err != nil {
+		log.Printf("Template execution error: %v", err)
+		return
 	}
 
-	var tBytes bytes.Buffer
-	err = t.Execute(&tBytes, variables)
+	// The text body isn't HTML so it mustn't be escaped.
+	tText, err := text.ParseFiles("templates/email/" + name + ".txt") // Parse the text body.
 	if err != nil {
-		log.Printf("Template execution error: %v", err)
+		log.Printf("Template parsing error: %v", err)
 		return
 	}
 
-	// Assemble the email.
-	input := &ses.SendEmailInput{
-		Source: aws.String("\"Animal Pictures\" <noreply@froogo.co.uk>"),
-		Destination: &ses.Destination{
-			ToAddresses: []*string{
-				aws.String(email),
-			},
-		},
-		Message: &ses.Message{
-			Subject: &ses.Content{
-				Charset: aws.String("UTF-8"),
-				Data:    aws.String("Register Account"),
-			},
-			Body: &ses.Body{
-				Html: &ses.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String(tBytes.String()),
-				},
-				Text: &ses.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String("Welcome " + username + ",\nTo finish the registration process of your account please visit: https://ap.froogo.co.uk/verify?code=" + code + "\nIf you haven't registered an account please just ignore this email, sorry for any inconvenience."),
-				},
-			},
-		},
+	var plain bytes.Buffer
+	err = tText.Execute(&plain, variables)
+	if err != nil {
+		log.Printf("Template execution error: %v", err)
+		return
 	}
 
-	// Attempt to send the email.
-	_, err = svc.SendEmail(input)
+	message.HTML, message.Text = html.String(), plain.String()
 	return
 }
 
-// Recovery sends the recovery email.
-func Recovery(code, username, email string) (err error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("eu-west-1")},
-	)
+// send renders an email for a user and sends it to them.
+func send(name, subject, email string, variables models.EmailTemplateVariables) (err error) {
+	variables.BaseURL = baseURL
+
+	message, err := render(name, subject, variables)
 	if err != nil {
 		return
 	}
 
-	// Create an SES session.
-	svc := ses.New(sess)
+	message.To = email
+	return Mail.Send(message)
+}
 
-	t, err := template.ParseFiles("templates/email/recovery.html") // Parse the HTML page.
+// Register sends the account registry email.
+func Register(code, username, email string) (err error) {
+	link, err := helpers.URL("verify", nil, "code", code)
 	if err != nil {
-		log.Printf("Template parsing error: %v", err)
 		return
 	}
 
-	variables := models.EmailTemplateVariables{
+	return send("register", "Register Account", email, models.EmailTemplateVariables{
 		Code:     code,
 		Username: username,
-	}
+		Link:     link,
+	})
+}
 
-	var tBytes bytes.Buffer
-	err = t.Execute(&tBytes, variables)
+// Recovery sends the recovery email.
+func Recovery(code, username, email string) (err error) {
+	link, err := helpers.URL("password-recovery", url.Values{"code": {code}})
 	if err != nil {
-		log.Printf("Template execution error: %v", err)
 		return
 	}
 
-	// Assemble the email.
-	input := &ses.SendEmailInput{
-		Source: aws.String("\"Animal Pictures\" <noreply@froogo.co.uk>"),
-		Destination: &ses.Destination{
-			ToAddresses: []*string{
-				aws.String(email),
-			},
-		},
-		Message: &ses.Message{
-			Subject: &ses.Content{
-				Charset: aws.String("UTF-8"),
-				Data:    aws.String("Reset Your Password"),
-			},
-			Body: &ses.Body{
-				Html: &ses.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String(tBytes.String()),
-				},
-				Text: &ses.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String("Hello " + username + ",\nTo reset your password please click this link: https://ap.froogo.co.uk/password-recovery/?code=" + code + "\nIf it wasn't you trying to reset your password please just ignore this email, sorry for any inconvenience.\nHowever, if you are receiving lots of these emails please contact support for assistance."),
-				},
-			},
-		},
+	return send("recovery", "Reset Your Password", email, models.EmailTemplateVariables{
+		Code:     code,
+		Username: username,
+		Link:     link,
+	})
+}
+
+// ChangeEmail sends the email verifying a user's new email address.
+func ChangeEmail(code, username, email string) (err error) {
+	link, err := helpers.URL("verify", nil, "code", code)
+	if err != nil {
+		return
 	}
 
-	// Attempt to send the email.
-	_, err = svc.SendEmail(input)
-	return
+	return send("change-email", "Change Your Email", email, models.EmailTemplateVariables{
+		Code:     code,
+		Username: username,
+		Link:     link,
+	})
 }
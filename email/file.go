@@ -0,0 +1,50 @@
+package email
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// File writes emails to a directory instead of sending them, for developing and testing offline.
+type File struct {
+	sender, path string
+}
+
+// NewFile creates a new file mailer writing to a directory.
+func NewFile(sender, path string) (mailer *File, err error) {
+	err = os.MkdirAll(path, 0755)
+	if err != nil {
+		return
+	}
+
+	mailer = &File{
+		sender: sender,
+		path:   path,
+	}
+	return
+}
+
+// Send writes an email to a .eml file named after when it was sent.
+func (mailer *File) Send(message Message) (err error) {
+	encoded, err := message.mime(mailer.sender)
+	if err != nil {
+		return
+	}
+
+	file, err := os.CreateTemp(mailer.path, strconv.FormatInt(time.Now().UnixNano(), 10)+"-*.eml")
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	_, err = file.Write(encoded)
+	if err != nil {
+		return
+	}
+
+	log.Printf("Wrote email %q to %v: %v", message.Subject, message.To, file.Name())
+	return
+}
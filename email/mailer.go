@@ -0,0 +1,78 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"time"
+)
+
+// Mail drivers.
+const (
+	DriverSES  = "ses"
+	DriverSMTP = "smtp"
+	DriverFile = "file"
+)
+
+// Define mail errors.
+var (
+	ErrUnknownDriver = errors.New("unknown mail driver")
+)
+
+// Message is an email with both an HTML and a plain text body.
+type Message struct {
+	To, Subject, HTML, Text string
+}
+
+// Mailer is a backend which emails are sent with.
+type Mailer interface {
+	// Send sends a message from the configured sender.
+	Send(message Message) error
+}
+
+// mime encodes a message as a multipart MIME email from a sender.
+func (message Message) mime(from string) (encoded []byte, err error) {
+	var buffer bytes.Buffer
+	body := multipart.NewWriter(&buffer)
+
+	fmt.Fprintf(&buffer, "From: %v\r\n", from)
+	fmt.Fprintf(&buffer, "To: %v\r\n", message.To)
+	fmt.Fprintf(&buffer, "Subject: %v\r\n", mime.QEncoding.Encode("UTF-8", message.Subject))
+	fmt.Fprintf(&buffer, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buffer, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buffer, "Content-Type: multipart/alternative; boundary=%v\r\n\r\n", body.Boundary())
+
+	// Clients show the last part they can display so the HTML goes after the text.
+	parts := []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", message.Text},
+		{"text/html; charset=UTF-8", message.HTML},
+	}
+
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		writer, err := body.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err = encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+
+		if err = encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	err = body.Close()
+	encoded = buffer.Bytes()
+	return
+}
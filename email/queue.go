@@ -0,0 +1,131 @@
+package email
+
+import (
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// Counters of queued emails sent, failed and given up on, published by expvar.
+var (
+	mailSent   = expvar.NewInt("mail_sent")
+	mailFailed = expvar.NewInt("mail_failed")
+	mailDead   = expvar.NewInt("mail_dead")
+)
+
+// maxBackoff is the longest a failed email waits before being sent again.
+const maxBackoff = time.Hour * 24 // 1 day.
+
+// queueBatch is the most emails sent every MailTickRate.
+const queueBatch = 50
+
+// Queue is a Mailer which stores emails to be sent in the background by another Mailer.
+// Emails which fail are sent again after a delay which doubles every attempt until they have failed maxAttempts times.
+type Queue struct {
+	store       db.MailStore
+	mailer      Mailer
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewQueue returns a queue storing emails in a store and sending them with a mailer.
+// Backoff is how long the first failed attempt waits to be sent again.
+func NewQueue(store db.MailStore, mailer Mailer, maxAttempts int, backoff time.Duration) *Queue {
+	return &Queue{
+		store:       store,
+		mailer:      mailer,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+	}
+}
+
+// Send adds an email to the queue, it is sent by the next tick of the worker.
+func (queue *Queue) Send(message Message) (err error) {
+	_, err = queue.store.QueueMail(models.Mail{
+		To:      message.To,
+		Subject: message.Subject,
+		HTML:    message.HTML,
+		Text:    message.Text,
+	})
+	return
+}
+
+// Start sends the queued emails which are due every MailTickRate in the background.
+func (queue *Queue) Start() {
+	go func() {
+		for range time.Tick(models.MailTickRate) {
+			if err := queue.Flush(); err != nil {
+				log.Printf("Error sending queued emails: %v", err)
+			}
+		}
+	}()
+}
+
+// Flush sends every queued email which is due.
+func (queue *Queue) Flush() (err error) {
+	for {
+		var due []models.Mail
+		due, err = queue.store.GetDueMail(time.Now().Unix(), queueBatch)
+		if err != nil || len(due) == 0 {
+			return
+		}
+
+		for _, mail := range due {
+			err = queue.deliver(mail)
+			if err != nil {
+				return
+			}
+		}
+
+		if len(due) < queueBatch {
+			return
+		}
+	}
+}
+
+// deliver tries to send a queued email and stores the outcome.
+func (queue *Queue) deliver(mail models.Mail) error {
+	err := queue.mailer.Send(Message{
+		To:      mail.To,
+		Subject: mail.Subject,
+		HTML:    mail.HTML,
+		Text:    mail.Text,
+	})
+
+	if err == nil {
+		mailSent.Add(1)
+		mail.State, mail.LastError = models.MailSent, ""
+		return queue.store.SetMailAttempt(mail)
+	}
+
+	mail.Attempts++
+	mail.LastError = err.Error()
+
+	if mail.Attempts >= queue.maxAttempts {
+		mailDead.Add(1)
+		log.Printf("Giving up sending email %v to %v after %v attempts: %v", mail.ID, mail.To, mail.Attempts, err)
+		mail.State = models.MailDead
+		return queue.store.SetMailAttempt(mail)
+	}
+
+	mailFailed.Add(1)
+	mail.NextAttempt = time.Now().Add(queue.delay(mail.Attempts)).Unix()
+	return queue.store.SetMailAttempt(mail)
+}
+
+// delay returns how long an email which has failed a number of times waits to be sent again.
+func (queue *Queue) delay(attempts int) time.Duration {
+	delay := queue.backoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	return delay
+}
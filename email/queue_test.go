@@ -0,0 +1,103 @@
+package email
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// failing is a mailer which fails to send every email.
+type failing struct{}
+
+func (failing) Send(message Message) error {
+	return errors.New("mailer is down")
+}
+
+// sending is a mailer which sends every email.
+type sending struct{}
+
+func (sending) Send(message Message) error {
+	return nil
+}
+
+// onlyMail returns the only email in a state, failing the test if there isn't exactly one.
+func onlyMail(t *testing.T, store db.MailStore, state string) models.Mail {
+	mail, _, err := store.GetMail(state, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mail) != 1 {
+		t.Fatalf("got %v %v emails, want 1", len(mail), state)
+	}
+
+	return mail[0]
+}
+
+func TestQueueClearsSentBodies(t *testing.T) {
+	store := db.NewMemoryStores().Mail
+	queue := NewQueue(store, sending{}, 3, 0)
+
+	if err := queue.Send(Message{To: "user@example.com", Subject: "Verify", HTML: "<a href=\"/verify/code\">", Text: "/verify/code"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := queue.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := onlyMail(t, store, models.MailSent); sent.HTML != "" || sent.Text != "" {
+		t.Errorf("sent email still has its body: %q %q", sent.HTML, sent.Text)
+	}
+}
+
+func TestQueueDeadMail(t *testing.T) {
+	store := db.NewMemoryStores().Mail
+	queue := NewQueue(store, failing{}, 3, 0)
+
+	if err := queue.Send(Message{To: "user@example.com", Subject: "Verify", Text: "/verify/code"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a backoff every attempt is due straight away.
+	for i := 0; i < 3; i++ {
+		if err := queue.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dead := onlyMail(t, store, models.MailDead)
+	if dead.Attempts != 3 || dead.Text == "" {
+		t.Fatalf("dead email has %v attempts and body %q, want 3 attempts and its body kept to retry", dead.Attempts, dead.Text)
+	}
+
+	now := time.Now()
+
+	// Dead emails whose links have expired are cleared and can't be retried.
+	if _, err := store.PurgeMail(now.Add(time.Second).Unix(), now.Add(-models.MailKeepTime).Unix()); err != nil {
+		t.Fatal(err)
+	}
+
+	if dead = onlyMail(t, store, models.MailDead); dead.Text != "" {
+		t.Errorf("dead email still has its body after its links expired: %q", dead.Text)
+	}
+
+	if err := store.RetryMail(dead.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	onlyMail(t, store, models.MailDead)
+
+	// Old emails are deleted.
+	purged, err := store.PurgeMail(now.Add(time.Second).Unix(), now.Add(time.Second).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if purged != 1 {
+		t.Errorf("purged %v emails, want 1", purged)
+	}
+}
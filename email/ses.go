@@ -0,0 +1,58 @@
+package email
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+)
+
+// SES sends emails with Amazon SES.
+type SES struct {
+	sender string
+	client *ses.SES
+}
+
+// NewSES creates a new SES mailer sending from an address in a region.
+func NewSES(sender, region string) (mailer *SES, err error) {
+	session, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return
+	}
+
+	mailer = &SES{
+		sender: sender,
+		client: ses.New(session),
+	}
+	return
+}
+
+// Send sends an email with SES.
+func (mailer *SES) Send(message Message) (err error) {
+	_, err = mailer.client.SendEmail(&ses.SendEmailInput{
+		Source: aws.String(mailer.sender),
+		Destination: &ses.Destination{
+			ToAddresses: []*string{
+				aws.String(message.To),
+			},
+		},
+		Message: &ses.Message{
+			Subject: &ses.Content{
+				Charset: aws.String("UTF-8"),
+				Data:    aws.String(message.Subject),
+			},
+			Body: &ses.Body{
+				Html: &ses.Content{
+					Charset: aws.String("UTF-8"),
+					Data:    aws.String(message.HTML),
+				},
+				Text: &ses.Content{
+					Charset: aws.String("UTF-8"),
+					Data:    aws.String(message.Text),
+				},
+			},
+		},
+	})
+	return
+}
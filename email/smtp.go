@@ -0,0 +1,49 @@
+package email
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTP sends emails through an SMTP server.
+type SMTP struct {
+	sender, from, address string
+	auth                  smtp.Auth
+}
+
+// NewSMTP creates a new SMTP mailer sending from an address through a server's host:port.
+// The server is only logged in to if a username is given.
+func NewSMTP(sender, address, username, password string) (mailer *SMTP, err error) {
+	from, err := mail.ParseAddress(sender)
+	if err != nil {
+		return
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return
+	}
+
+	mailer = &SMTP{
+		sender:  sender,
+		from:    from.Address,
+		address: address,
+	}
+
+	if username != "" {
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return
+}
+
+// Send sends an email through the SMTP server.
+func (mailer *SMTP) Send(message Message) (err error) {
+	encoded, err := message.mime(mailer.sender)
+	if err != nil {
+		return
+	}
+
+	return smtp.SendMail(mailer.address, mailer.auth, mailer.from, []string{message.To}, encoded)
+}
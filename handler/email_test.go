@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/email"
+	"github.com/VolticFroogo/Animal-Pictures/internal/handlertest"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/gorilla/mux"
+)
+
+// testBaseURL is the base URL links are built from in tests.
+const testBaseURL = "https://ap.example.com"
+
+// links finds the links to the website in an email.
+var links = regexp.MustCompile(regexp.QuoteMeta(testBaseURL) + `[^\s"'<>]*`)
+
+func TestMain(m *testing.M) {
+	handlertest.Main(m)
+}
+
+// follow serves GET requests for a link with the router, following redirects like a browser, and returns the final response and every URL visited.
+func follow(t *testing.T, router *mux.Router, link string) (recorder *httptest.ResponseRecorder, visited []string) {
+	for len(visited) < 5 {
+		visited = append(visited, link)
+
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, link, nil))
+
+		location, err := recorder.Result().Location()
+		if err != nil {
+			return
+		}
+
+		// The file server redirects directories relative to the page.
+		current, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		link = current.ResolveReference(location).String()
+	}
+
+	t.Fatalf("too many redirects: %q", visited)
+	return
+}
+
+func TestEmailLinks(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		settings := config.Default()
+		settings.HTTP.BaseURL = testBaseURL
+		Init(stores, settings)
+		router := Router()
+
+		if err := email.Init(config.Email{Driver: email.DriverFile, Path: t.TempDir()}, testBaseURL); err != nil {
+			t.Fatal(err)
+		}
+
+		mail := handlertest.Mail()
+		uuid := handlertest.NewUser(t, store.Users, "user@example.com", "hash", models.PrivUnverified)
+
+		// Every email is sent with a real code, so following its link must use it.
+		cases := []struct {
+			name     string
+			send     func() (string, error)
+			route    string
+			redirect string
+		}{
+			{"register", func() (string, error) {
+				code, err := store.Verifications.AddEmailVerification(uuid, "user@example.com")
+				if err == nil {
+					err = email.Register(code, "user", "user@example.com")
+				}
+
+				return code, err
+			}, "verify", testBaseURL + "/login?code=1"},
+			{"change email", func() (string, error) {
+				code, err := store.Verifications.AddEmailVerification(uuid, "new@example.com")
+				if err == nil {
+					err = email.ChangeEmail(code, "user", "new@example.com")
+				}
+
+				return code, err
+			}, "verify", testBaseURL + "/login?code=1"},
+			{"recovery", func() (string, error) {
+				code, err := store.Verifications.AddRecovery(uuid, "new@example.com")
+				if err == nil {
+					err = email.Recovery(code, "user", "new@example.com")
+				}
+
+				return code, err
+			}, "password-recovery", ""},
+		}
+
+		for _, c := range cases {
+			mail.Sent = nil
+
+			code, err := c.send()
+			if err != nil {
+				t.Fatalf("%v: %v", c.name, err)
+			}
+
+			if len(mail.Sent) != 1 {
+				t.Fatalf("%v: %v emails were sent, want 1", c.name, len(mail.Sent))
+			}
+
+			message := mail.Sent[0]
+			found := append(links.FindAllString(message.Text, -1), links.FindAllString(html.UnescapeString(message.HTML), -1)...)
+			if len(found) != 2 {
+				t.Fatalf("%v: found links %q, want one in the text and one in the HTML", c.name, found)
+			}
+
+			if found[0] != found[1] {
+				t.Errorf("%v: text links to %q but HTML links to %q", c.name, found[0], found[1])
+			}
+
+			var match mux.RouteMatch
+			if !router.Match(httptest.NewRequest(http.MethodGet, found[0], nil), &match) || match.MatchErr != nil || match.Route.GetName() != c.route {
+				t.Errorf("%v: link %q doesn't resolve to the %v route", c.name, found[0], c.route)
+				continue
+			}
+
+			if !strings.Contains(found[0], url.QueryEscape(code)) {
+				t.Errorf("%v: link %q doesn't contain the code %q", c.name, found[0], code)
+			}
+
+			recorder, visited := follow(t, router, found[0])
+			if recorder.Code != http.StatusOK {
+				t.Errorf("%v: following %q got status %v, want %v", c.name, visited, recorder.Code, http.StatusOK)
+			}
+
+			for _, link := range visited {
+				if !strings.HasPrefix(link, testBaseURL+"/") {
+					t.Errorf("%v: redirected to %q which isn't built from the base URL", c.name, link)
+				}
+			}
+
+			// Verifying redirects to the login page showing that it worked.
+			if c.redirect != "" && (len(visited) < 2 || visited[1] != c.redirect) {
+				t.Errorf("%v: following %q visited %q, want a redirect to %q", c.name, found[0], visited, c.redirect)
+			}
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/VolticFroogo/Animal-Pictures/search"
+	"github.com/gorilla/context"
+)
+
+// sorts are every ordering in the order they are listed by the sort switcher.
+var sorts = []string{models.SortHot, models.SortNew, models.SortTop, models.SortRising, models.SortControversial}
+
+// feedPost is a post in a JSON feed with the values templates get from its methods.
+type feedPost struct {
+	models.Post
+	Score        int
+	ThumbnailURL string `json:",omitempty"`
+}
+
+type feedResponse struct {
+	Posts []feedPost
+	More  bool
+}
+
+// feedPosts returns a page of posts in an ordering, the range of top posts is the t query parameter.
+// Invalid ranges are treated as all time.
+func feedPosts(sort string, r *http.Request) (posts []models.Post, pagination models.Pagination, timeRange string, err error) {
+	pagination.Page = helpers.Page(r.URL.Query().Get("page"))
+
+	switch sort {
+	case models.SortNew:
+		posts, pagination.More, err = store.Posts.GetNewPosts(pagination.Page)
+	case models.SortTop:
+		var since int64
+		timeRange = "all"
+		if duration, ok := search.Ranges[r.URL.Query().Get("t")]; ok {
+			timeRange = r.URL.Query().Get("t")
+			since = time.Now().Add(-duration).Unix()
+		}
+
+		posts, pagination.More, err = store.Posts.GetTopPosts(since, pagination.Page)
+	case models.SortRising:
+		posts, pagination.More, err = store.Posts.GetRisingPosts(pagination.Page)
+	case models.SortControversial:
+		posts, pagination.More, err = store.Posts.GetControversialPosts(pagination.Page)
+	default:
+		posts, pagination.More, err = store.Posts.GetHotPosts(pagination.Page)
+	}
+
+	return
+}
+
+// feed returns the handler for the index page listing posts in an ordering.
+func feed(sort string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uuid, loggedIn := context.GetOk(r, "uuid")
+
+		variables := models.TemplateVariables{
+			LoggedIn: loggedIn,
+			Sort:     sort,
+		}
+
+		if loggedIn {
+			user, err := store.Users.GetUserFromUUID(uuid.(string))
+			if err != nil {
+				helpers.ThrowErr(w, r, "Getting user from DB error", err)
+				return
+			}
+
+			csrfSecret, err := r.Cookie("csrfSecret")
+			if err != nil {
+				helpers.ThrowErr(w, r, "Getting CSRF Secret cookie error", err)
+				return
+			}
+
+			variables.Self = user
+			variables.CsrfSecret = csrfSecret.Value
+		}
+
+		var err error
+		variables.Posts, variables.Pagination, variables.Range, err = feedPosts(sort, r)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting "+sort+" posts error", err)
+			return
+		}
+
+		t, err := template.ParseFiles("templates/index.html", "templates/nested.html") // Parse the HTML pages.
+		if err != nil {
+			helpers.ThrowErr(w, r, "Template parsing error", err)
+			return
+		}
+
+		err = t.Execute(w, variables)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Template execution error", err)
+		}
+	}
+}
+
+// feedJSON returns the handler for a page of posts in an ordering as JSON, used to load more posts while scrolling.
+func feedJSON(sort string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		posts, pagination, _, err := feedPosts(sort, r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			helpers.ThrowErr(w, r, "Getting "+sort+" posts error", err)
+			return
+		}
+
+		response := feedResponse{
+			Posts: []feedPost{},
+			More:  pagination.More,
+		}
+
+		for _, post := range posts {
+			response.Posts = append(response.Posts, feedPost{
+				Post:         post,
+				Score:        post.Score(),
+				ThumbnailURL: post.ThumbnailURL(),
+			})
+		}
+
+		helpers.JSONResponse(response, w)
+	}
+}
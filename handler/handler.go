@@ -2,21 +2,24 @@ package handler
 
 import (
 	"encoding/json"
+	"expvar"
 	"log"
 	"net/http"
 	"text/template"
 
 	"github.com/VolticFroogo/Animal-Pictures/captcha"
+	"github.com/VolticFroogo/Animal-Pictures/config"
 	"github.com/VolticFroogo/Animal-Pictures/db"
 	"github.com/VolticFroogo/Animal-Pictures/email"
 	"github.com/VolticFroogo/Animal-Pictures/handler/post"
 	"github.com/VolticFroogo/Animal-Pictures/handler/recovery"
+	"github.com/VolticFroogo/Animal-Pictures/handler/tag"
 	"github.com/VolticFroogo/Animal-Pictures/handler/user"
 	"github.com/VolticFroogo/Animal-Pictures/helpers"
 	"github.com/VolticFroogo/Animal-Pictures/middleware"
 	"github.com/VolticFroogo/Animal-Pictures/middleware/myJWT"
 	"github.com/VolticFroogo/Animal-Pictures/models"
-	"github.com/gorilla/context"
+	"github.com/VolticFroogo/Animal-Pictures/upload"
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
 )
@@ -25,17 +28,67 @@ type formData struct {
 	Email, Username, Password, Captcha, CaptchaV2 string
 }
 
-// Start the server by handling the web server.
-func Start() {
+var (
+	store    db.Stores
+	settings config.Config
+)
+
+// Init sets the stores and configuration used by every handler.
+func Init(stores db.Stores, config config.Config) {
+	store = stores
+	settings = config
+	post.Init(stores, config)
+	recovery.Init(stores, config)
+	tag.Init(stores, config)
+	user.Init(stores, config)
+	myJWT.Init(stores.Tokens)
+}
+
+// Start the server by handling the web server using the given stores and configuration.
+func Start(stores db.Stores, config config.Config) {
+	Init(stores, config)
+
+	log.Printf("Server started...")
+	http.ListenAndServe(config.HTTP.Address, Router())
+}
+
+// Router returns the router of every page on the website.
+func Router() *mux.Router {
 	r := mux.NewRouter()
 	r.StrictSlash(true)
 	r.NotFoundHandler = http.HandlerFunc(notFound)
 
 	r.Handle("/", negroni.New(
 		negroni.HandlerFunc(middleware.View),
-		negroni.Wrap(http.HandlerFunc(index)),
+		negroni.Wrap(feed(models.SortHot)),
 	)).Methods(http.MethodGet)
 
+	for _, sort := range sorts {
+		if sort != models.SortHot {
+			r.Handle("/"+sort, negroni.New(
+				negroni.HandlerFunc(middleware.View),
+				negroni.Wrap(feed(sort)),
+			)).Methods(http.MethodGet)
+		}
+
+		r.Handle("/"+sort+".json", feedJSON(sort)).Methods(http.MethodGet)
+	}
+
+	r.Handle("/debug/vars", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(vars)),
+	)).Methods(http.MethodGet)
+
+	r.Handle("/admin/mail", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(mailPage)),
+	)).Methods(http.MethodGet)
+
+	r.Handle("/admin/mail/{id:[0-9]+}/retry", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(retryMail)),
+	)).Methods(http.MethodPost)
+
 	r.Handle("/login", http.HandlerFunc(login)).Methods(http.MethodPost)
 	r.Handle("/register", http.HandlerFunc(register)).Methods(http.MethodPost)
 
@@ -47,7 +100,35 @@ func Start() {
 	r.Handle("/forgot-password", http.HandlerFunc(recovery.Begin)).Methods(http.MethodPost)
 	r.Handle("/password-recovery", http.HandlerFunc(recovery.End)).Methods(http.MethodPost)
 
-	r.Handle("/verify/{code}", http.HandlerFunc(user.Verify)).Methods(http.MethodGet)
+	r.Handle("/verify/resend", http.HandlerFunc(user.Resend)).Methods(http.MethodPost)
+	r.Handle("/verify/{code}", http.HandlerFunc(user.Verify)).Methods(http.MethodGet).Name("verify")
+
+	r.Handle("/settings", negroni.New(
+		negroni.HandlerFunc(middleware.View),
+		negroni.Wrap(http.HandlerFunc(user.Settings)),
+	)).Methods(http.MethodGet)
+
+	r.Handle("/settings/profile", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(user.EditProfile)),
+	)).Methods(http.MethodPost)
+
+	r.Handle("/settings/password", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(user.EditPassword)),
+	)).Methods(http.MethodPost)
+
+	r.Handle("/settings/email", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(user.EditEmail)),
+	)).Methods(http.MethodPost)
+
+	r.Handle("/settings/picture", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(user.EditPicture)),
+	)).Methods(http.MethodPost)
+
+	r.Handle("/user/{uuid}.json", http.HandlerFunc(user.PageJSON)).Methods(http.MethodGet)
 
 	r.Handle("/user/{uuid}", negroni.New(
 		negroni.HandlerFunc(middleware.View),
@@ -74,16 +155,67 @@ func Start() {
 		negroni.Wrap(http.HandlerFunc(post.Vote)),
 	)).Methods(http.MethodPost)
 
-	r.PathPrefix("/login").Handler(http.FileServer(http.Dir("./static/")))
+	r.Handle("/post/{uuid}/comments", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(post.NewComment)),
+	)).Methods(http.MethodPost)
+
+	r.Handle("/post/{uuid}/comments/{id:[0-9]+}", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(post.EditComment)),
+	)).Methods(http.MethodPut)
+
+	r.Handle("/post/{uuid}/comments/{id:[0-9]+}", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(post.DeleteComment)),
+	)).Methods(http.MethodDelete)
+
+	r.Handle("/post/{uuid}/comments/{id:[0-9]+}/vote", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(post.VoteComment)),
+	)).Methods(http.MethodPost)
+
+	r.Handle("/tag/{name}", negroni.New(
+		negroni.HandlerFunc(middleware.View),
+		negroni.Wrap(http.HandlerFunc(tag.Page)),
+	)).Methods(http.MethodGet)
+
+	r.Handle("/tag/{name}/merge", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(tag.Merge)),
+	)).Methods(http.MethodPost)
+
+	r.Handle("/tag/{name}/aliases", negroni.New(
+		negroni.HandlerFunc(middleware.User),
+		negroni.Wrap(http.HandlerFunc(tag.Alias)),
+	)).Methods(http.MethodPost)
+
+	r.Handle("/tags", http.HandlerFunc(tag.Autocomplete)).Methods(http.MethodGet)
+
+	r.Handle("/search", negroni.New(
+		negroni.HandlerFunc(middleware.View),
+		negroni.Wrap(http.HandlerFunc(searchPage)),
+	)).Methods(http.MethodGet)
+
+	r.Handle("/search.json", http.HandlerFunc(searchJSON)).Methods(http.MethodGet)
+
+	// Backends without their own public URLs are served by the router.
+	if server, ok := upload.Store.(http.Handler); ok {
+		r.PathPrefix(settings.Storage.Prefix).Handler(server).Methods(http.MethodGet)
+	}
+
+	r.PathPrefix("/login").Handler(http.FileServer(http.Dir("./static/"))).Name("login")
 	r.PathPrefix("/register").Handler(http.FileServer(http.Dir("./static/")))
 	r.PathPrefix("/forgot-password").Handler(http.FileServer(http.Dir("./static/")))
-	r.PathPrefix("/password-recovery").Handler(http.FileServer(http.Dir("./static/")))
+	r.PathPrefix("/password-recovery").Handler(http.FileServer(http.Dir("./static/"))).Name("password-recovery")
 	r.PathPrefix("/robots.txt").Handler(http.FileServer(http.Dir("./static/")))
 	r.PathPrefix("/css/").Handler(http.FileServer(http.Dir("./static/")))
 	r.PathPrefix("/js/").Handler(http.FileServer(http.Dir("./static/")))
 
-	log.Printf("Server started...")
-	http.ListenAndServe(":87", r)
+	// Links in emails and redirects are built from the routes' names.
+	helpers.InitURLs(r, settings.HTTP.BaseURL)
+
+	return r
 }
 
 func notFound(w http.ResponseWriter, r *http.Request) {
@@ -101,47 +233,13 @@ func notFound(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func index(w http.ResponseWriter, r *http.Request) {
-	uuid, loggedIn := context.GetOk(r, "uuid")
-
-	variables := models.TemplateVariables{
-		LoggedIn: loggedIn,
-	}
-
-	if loggedIn {
-		user, err := db.GetUserFromUUID(uuid.(string))
-		if err != nil {
-			helpers.ThrowErr(w, r, "Getting user from DB error", err)
-			return
-		}
-
-		csrfSecret, err := r.Cookie("csrfSecret")
-		if err != nil {
-			helpers.ThrowErr(w, r, "Getting CSRF Secret cookie error", err)
-			return
-		}
-
-		variables.Self = user
-		variables.CsrfSecret = csrfSecret.Value
-	}
-
-	var err error
-	variables.Posts, err = db.GetHotPosts(0)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Getting hot posts error", err)
-		return
-	}
-
-	t, err := template.ParseFiles("templates/index.html", "templates/nested.html") // Parse the HTML pages.
-	if err != nil {
-		helpers.ThrowErr(w, r, "Template parsing error", err)
+// vars is the handler for admins reading the expvar counters, such as the hot posts cache hits and misses.
+func vars(w http.ResponseWriter, r *http.Request) {
+	if _, ok := admin(w, r); !ok {
 		return
 	}
 
-	err = t.Execute(w, variables)
-	if err != nil {
-		helpers.ThrowErr(w, r, "Template execution error", err)
-	}
+	expvar.Handler().ServeHTTP(w, r)
 }
 
 func login(w http.ResponseWriter, r *http.Request) {
@@ -154,12 +252,12 @@ func login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Secure our request with reCAPTCHA v2 and v3.
-	if !captcha.V3(credentials.CaptchaV2, credentials.Captcha, r.Header.Get("CF-Connecting-IP"), "login") {
+	if !captcha.V3(credentials.CaptchaV2, credentials.Captcha, helpers.IP(r), "login") {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	user, err := db.GetUserFromEmail(credentials.Email)
+	user, err := store.Users.GetUserFromEmail(credentials.Email)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Getting user from DB error", err)
@@ -200,7 +298,7 @@ func register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Secure our request with reCAPTCHA v2 and v3.
-	if !captcha.V3(data.CaptchaV2, data.Captcha, r.Header.Get("CF-Connecting-IP"), "register") {
+	if !captcha.V3(data.CaptchaV2, data.Captcha, helpers.IP(r), "register") {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -213,7 +311,7 @@ func register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if a user exists with the requested email.
-	exists, err := db.UserExistsFromEmail(data.Email)
+	exists, err := store.Users.UserExistsFromEmail(data.Email)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Checking if user exists error", err)
@@ -232,7 +330,7 @@ func register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create the new user.
-	uuid, err := db.NewUser(data.Email, hash, data.Username, models.PrivUnverified)
+	uuid, err := store.Users.NewUser(data.Email, hash, data.Username, models.PrivUnverified)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Creating user error", err)
@@ -240,7 +338,7 @@ func register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add the email verification to the database.
-	code, err := db.AddEmailVerification(uuid, data.Email)
+	code, err := store.Verifications.AddEmailVerification(uuid, data.Email)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Creating email verification error", err)
@@ -251,7 +349,7 @@ func register(w http.ResponseWriter, r *http.Request) {
 	err = email.Register(code, data.Username, data.Email)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		helpers.ThrowErr(w, r, "Sending registration email error", err)
+		helpers.ThrowErr(w, r, "Queueing registration email error", err)
 		return
 	}
 
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// mailStates are the states of queued emails in the order the admin view lists them.
+var mailStates = []string{models.MailDead, models.MailPending, models.MailSent}
+
+type mailVariables struct {
+	models.TemplateVariables
+	States []string
+	State  string
+	Mail   []models.Mail
+}
+
+// admin returns the logged in user if they are an admin, writing the failure status if it returns false.
+func admin(w http.ResponseWriter, r *http.Request) (self models.User, ok bool) {
+	self, err := store.Users.GetUserFromUUID(context.Get(r, "uuid").(string))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Getting user from DB error", err)
+		return
+	}
+
+	if self.Privilege < models.PrivAdmin {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	return self, true
+}
+
+// mailPage is the handler for admins viewing the queue of outgoing emails in the state given by the state query parameter.
+func mailPage(w http.ResponseWriter, r *http.Request) {
+	self, ok := admin(w, r)
+	if !ok {
+		return
+	}
+
+	variables := mailVariables{
+		TemplateVariables: models.TemplateVariables{
+			LoggedIn: true,
+			Self:     self,
+		},
+		States: mailStates,
+		State:  r.URL.Query().Get("state"),
+	}
+
+	valid := false
+	for _, state := range mailStates {
+		valid = valid || variables.State == state
+	}
+
+	if !valid {
+		variables.State = models.MailDead
+	}
+
+	// The retry forms send the CSRF secret back to prove they came from this page.
+	csrfSecret, err := r.Cookie("csrfSecret")
+	if err != nil {
+		helpers.ThrowErr(w, r, "Getting CSRF Secret cookie error", err)
+		return
+	}
+
+	variables.CsrfSecret = csrfSecret.Value
+
+	variables.Pagination.Page = helpers.Page(r.URL.Query().Get("page"))
+	variables.Mail, variables.Pagination.More, err = store.Mail.GetMail(variables.State, variables.Pagination.Page)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Getting queued emails error", err)
+		return
+	}
+
+	t, err := template.ParseFiles("templates/admin/mail.html", "templates/nested.html") // Parse the HTML pages.
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template parsing error", err)
+		return
+	}
+
+	err = t.Execute(w, variables)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template execution error", err)
+	}
+}
+
+// retryMail is the handler for admins putting a dead email back in the queue.
+// The form must send the CSRF secret so other sites can't make an admin retry emails.
+func retryMail(w http.ResponseWriter, r *http.Request) {
+	if _, ok := admin(w, r); !ok {
+		return
+	}
+
+	csrfSecret, err := r.Cookie("csrfSecret")
+	if err != nil || csrfSecret.Value == "" || subtle.ConstantTimeCompare([]byte(csrfSecret.Value), []byte(r.PostFormValue("csrf"))) != 1 {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = store.Mail.RetryMail(id)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Retrying email error", err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/mail?state="+models.MailDead, http.StatusSeeOther)
+}
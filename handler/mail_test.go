@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/internal/handlertest"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+func TestRetryMail(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		Init(stores, config.Default())
+
+		admin := handlertest.NewUser(t, store.Users, "admin@example.com", "hash", models.PrivAdmin)
+		id, err := store.Mail.QueueMail(models.Mail{To: "user@example.com", Subject: "Verify", Text: "/verify/code"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.Mail.SetMailAttempt(models.Mail{ID: id, State: models.MailDead, Attempts: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/mail/{id:[0-9]+}/retry", func(w http.ResponseWriter, r *http.Request) {
+			context.Set(r, "uuid", admin)
+			retryMail(w, r)
+		})
+
+		// The cases run in order, so the email is only retried by the last case.
+		cases := []struct {
+			name   string
+			csrf   string
+			status int
+			state  string
+		}{
+			{"no token", "", http.StatusForbidden, models.MailDead},
+			{"wrong token", "wrong", http.StatusForbidden, models.MailDead},
+			{"right token", "secret", http.StatusSeeOther, models.MailPending},
+		}
+
+		for _, c := range cases {
+			request := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/mail/%v/retry", id), strings.NewReader(url.Values{"csrf": {c.csrf}}.Encode()))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			request.AddCookie(&http.Cookie{Name: "csrfSecret", Value: "secret"})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+			}
+
+			if mail, _, _ := store.Mail.GetMail(c.state, 0); len(mail) != 1 {
+				t.Errorf("%v: email isn't %v", c.name, c.state)
+			}
+		}
+	})
+}
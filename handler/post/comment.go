@@ -0,0 +1,213 @@
+package post
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/VolticFroogo/Animal-Pictures/captcha"
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+type commentRequest struct {
+	Body               string
+	ParentID           int64
+	Upvote             bool
+	Captcha, CaptchaV2 string
+}
+
+// decodeCommentRequest decodes a comment request and checks its reCAPTCHA, writing the failure status if it returns false.
+func decodeCommentRequest(w http.ResponseWriter, r *http.Request, action string) (data commentRequest, ok bool) {
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	// Secure our request with reCAPTCHA v2 and v3.
+	if !captcha.V3(data.CaptchaV2, data.Captcha, helpers.IP(r), action) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	return data, true
+}
+
+// validBody returns if a comment body isn't empty or too long, trimming its whitespace.
+func validBody(body *string) bool {
+	*body = strings.TrimSpace(*body)
+	return *body != "" && utf8.RuneCountInString(*body) <= models.MaxCommentLength
+}
+
+// requestComment returns the comment of a request's URL, writing the failure status if it returns false.
+// Comments which have been deleted or belong to another post are gone.
+func requestComment(w http.ResponseWriter, r *http.Request) (comment models.Comment, ok bool) {
+	vars := mux.Vars(r)
+
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	comment, err = store.Comments.GetComment(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Getting comment from DB error", err)
+		return
+	}
+
+	if comment.ID == 0 || comment.PostUUID != vars["uuid"] || comment.Deleted {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	return comment, true
+}
+
+// NewComment is the handler for commenting on a post or replying to a comment.
+func NewComment(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeCommentRequest(w, r, "comment")
+	if !ok {
+		return
+	}
+
+	if !validBody(&data.Body) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	post, err := store.Posts.GetPost(mux.Vars(r)["uuid"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Getting post from DB error", err)
+		return
+	}
+
+	if post.Creation == 0 {
+		// Post has been deleted.
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	if data.ParentID != 0 {
+		parent, err := store.Comments.GetComment(data.ParentID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			helpers.ThrowErr(w, r, "Getting comment from DB error", err)
+			return
+		}
+
+		if parent.ID == 0 || parent.PostUUID != post.UUID || parent.Deleted {
+			// The comment being replied to has been deleted.
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+	}
+
+	comment, err := store.Comments.NewComment(post.UUID, data.ParentID, context.Get(r, "uuid").(string), data.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Adding comment to DB error", err)
+		return
+	}
+
+	helpers.JSONResponse(comment, w)
+}
+
+// EditComment is the handler for a user editing their comment.
+func EditComment(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeCommentRequest(w, r, "comment_edit")
+	if !ok {
+		return
+	}
+
+	if !validBody(&data.Body) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	comment, ok := requestComment(w, r)
+	if !ok {
+		return
+	}
+
+	if comment.Owner.UUID != context.Get(r, "uuid").(string) {
+		// Only the owner can edit a comment.
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	err := store.Comments.EditComment(comment.ID, data.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Editing comment error", err)
+		return
+	}
+
+	helpers.SuccessResponse(true, w, r)
+}
+
+// DeleteComment is the handler for deleting a comment by its owner or a moderator.
+func DeleteComment(w http.ResponseWriter, r *http.Request) {
+	_, ok := decodeCommentRequest(w, r, "comment_delete")
+	if !ok {
+		return
+	}
+
+	comment, ok := requestComment(w, r)
+	if !ok {
+		return
+	}
+
+	self, err := store.Users.GetUserFromUUID(context.Get(r, "uuid").(string))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Getting user from DB error", err)
+		return
+	}
+
+	if comment.Owner.UUID != self.UUID && self.Privilege < models.PrivModerator {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	err = store.Comments.DeleteComment(comment.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Deleting comment error", err)
+		return
+	}
+
+	helpers.SuccessResponse(true, w, r)
+}
+
+// VoteComment is the handler for voting on a comment.
+func VoteComment(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeCommentRequest(w, r, "vote")
+	if !ok {
+		return
+	}
+
+	comment, ok := requestComment(w, r)
+	if !ok {
+		return
+	}
+
+	score, err := store.Comments.SetCommentVote(comment, context.Get(r, "uuid").(string), data.Upvote)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Setting comment vote error", err)
+		return
+	}
+
+	helpers.JSONResponse(voteResponse{
+		Score: score,
+	}, w)
+}
@@ -1,11 +1,13 @@
 package post
 
 import (
+	"errors"
 	"html/template"
+	"mime/multipart"
 	"net/http"
+	"strings"
 
 	"github.com/VolticFroogo/Animal-Pictures/captcha"
-	"github.com/VolticFroogo/Animal-Pictures/db"
 	"github.com/VolticFroogo/Animal-Pictures/helpers"
 	"github.com/VolticFroogo/Animal-Pictures/models"
 	"github.com/VolticFroogo/Animal-Pictures/upload"
@@ -16,11 +18,25 @@ type response struct {
 	UUID string
 }
 
+type duplicateResponse struct {
+	// Duplicates are the UUIDs of posts with similar images.
+	Duplicates []string
+	// Rejected is whether an image was too similar to be posted, otherwise the user can confirm it isn't a repost.
+	Rejected bool
+}
+
 // New is the handler for the new post request.
 func New(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, 5*1024*1024) // 50MB max request size otherwise decline.
-	err := r.ParseMultipartForm(5 * 1024 * 1024)         // Parse multipart form, use total 5MB of RAM.
+	// Decline requests larger than the maximum size of every image with 1MB left for the rest of the form.
+	r.Body = http.MaxBytesReader(w, r.Body, int64(settings.Posts.MaxImages)*settings.Uploads.MaxBytes+1024*1024)
+	err := r.ParseMultipartForm(5 * 1024 * 1024) // Parse multipart form, use total 5MB of RAM.
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Parsing multipart form error", err)
 		return
@@ -39,28 +55,77 @@ func New(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Secure our request with reCAPTCHA v2 and v3.
-	if !captcha.V3(v2, v3, r.Header.Get("CF-Connecting-IP"), "post_new") {
+	if !captcha.V3(v2, v3, helpers.IP(r), "post_new") {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	// Upload the image.
-	location, err := upload.Image(form.File["image"][0])
+	files := form.File["image"]
+	if len(files) == 0 || len(files) > settings.Posts.MaxImages {
+		// A post needs at least one image but no more than the maximum.
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	tags := formTags(form)
+	if len(tags) > settings.Posts.MaxTags {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Decode and resize the images without storing them yet.
+	prepared, err := upload.Prepare(files)
 	if err != nil {
-		if err == upload.ErrNotImage {
-			// They are trying to upload a file that we think isn't an image.
+		switch err {
+		case upload.ErrNotImage, upload.ErrUnsupportedImage:
+			// They are trying to upload a file that we think isn't an image or can't handle.
 			w.WriteHeader(http.StatusUnsupportedMediaType)
 			return
+		case upload.ErrTooLarge:
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		case upload.ErrTooManyPixels:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
 		}
 
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Preparing image error", err)
+		return
+	}
+
+	// Check the images haven't already been posted before storing them.
+	duplicates, rejected, err := findDuplicates(prepared)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Finding similar images error", err)
+		return
+	}
+
+	if rejected || (len(duplicates) > 0 && formValue(form, "duplicate", 0) != "confirm") {
+		helpers.JSONStatusResponse(duplicateResponse{
+			Duplicates: duplicates,
+			Rejected:   rejected,
+		}, http.StatusConflict, w)
+		return
+	}
+
+	images, err := upload.Put(prepared)
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Uploading image error", err)
 		return
 	}
 
-	images := []string{location}
-	post, err := db.NewPost(form.Value["title"][0], form.Value["description"][0], context.Get(r, "uuid").(string), images)
+	// Captions and alt text are sent in the same order as the images.
+	for i := range images {
+		images[i].Caption = formValue(form, "caption", i)
+		images[i].Alt = formValue(form, "alt", i)
+	}
+
+	post, err := store.Posts.NewPost(formValue(form, "title", 0), formValue(form, "description", 0), context.Get(r, "uuid").(string), images, tags)
 	if err != nil {
+		removeImages(images)
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Adding Post to DB error", err)
 		return
@@ -71,6 +136,69 @@ func New(w http.ResponseWriter, r *http.Request) {
 	}, w)
 }
 
+// formTags returns the tags of a new post: a species, a breed and comma separated labels.
+func formTags(form *multipart.Form) (tags []models.Tag) {
+	found := make(map[string]bool)
+	add := func(name, kind string) {
+		name = models.TagName(name)
+		if name != "" && !found[name] {
+			found[name] = true
+			tags = append(tags, models.Tag{Name: name, Kind: kind})
+		}
+	}
+
+	add(formValue(form, "species", 0), models.TagSpecies)
+	add(formValue(form, "breed", 0), models.TagBreed)
+
+	for _, label := range strings.Split(formValue(form, "tags", 0), ",") {
+		add(label, models.TagLabel)
+	}
+
+	return
+}
+
+// findDuplicates returns the UUIDs of posts with images similar to any of the images and whether any are too similar to post.
+func findDuplicates(images []upload.Prepared) (duplicates []string, rejected bool, err error) {
+	found := make(map[string]bool)
+
+	for _, image := range images {
+		var similar []models.SimilarImage
+		similar, err = store.Posts.FindSimilarImages(image.Hash, settings.Posts.DuplicateWarnDistance)
+		if err != nil {
+			return
+		}
+
+		for _, match := range similar {
+			if match.Distance <= settings.Posts.DuplicateRejectDistance {
+				rejected = true
+			}
+
+			if !found[match.PostUUID] {
+				found[match.PostUUID] = true
+				duplicates = append(duplicates, match.PostUUID)
+			}
+		}
+	}
+
+	return
+}
+
+// removeImages deletes uploaded images which won't be posted.
+func removeImages(images []models.Image) {
+	for _, image := range images {
+		upload.Remove(image)
+	}
+}
+
+// formValue returns the value at an index of a multipart form field or an empty string.
+func formValue(form *multipart.Form, key string, index int) string {
+	if values, ok := form.Value[key]; ok && index < len(values) {
+		return values[index]
+	}
+
+	return ""
+}
+
 // PageNew is the handler for the new post page.
 func PageNew(w http.ResponseWriter, r *http.Request) {
 	uuid, loggedIn := context.GetOk(r, "uuid")
@@ -80,7 +208,7 @@ func PageNew(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if loggedIn {
-		self, err := db.GetUserFromUUID(uuid.(string))
+		self, err := store.Users.GetUserFromUUID(uuid.(string))
 		if err != nil {
 			helpers.ThrowErr(w, r, "Getting user from DB error", err)
 			return
@@ -0,0 +1,99 @@
+package post
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/internal/handlertest"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/VolticFroogo/Animal-Pictures/upload"
+	"github.com/gorilla/context"
+)
+
+// newPostRequest returns a new post form with a file for each image.
+func newPostRequest(t *testing.T, images ...[]byte) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	writer.WriteField("captcha", "ok")
+	writer.WriteField("title", "Cat")
+	writer.WriteField("species", "cat")
+
+	for _, image := range images {
+		part, err := writer.CreateFormFile("image", "image.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		part.Write(image)
+	}
+
+	writer.Close()
+
+	request, err := http.NewRequest(http.MethodPost, "/post/new", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+func TestNew(t *testing.T) {
+	jpeg, err := ioutil.ReadFile("upload/testdata/gps.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := ioutil.ReadFile("upload/testdata/rotated.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		// The fixtures are 40x20 and just small enough on their own.
+		settings := config.Default()
+		settings.Storage = config.Storage{Driver: upload.DriverMemory, Prefix: "/uploads/"}
+		settings.Uploads = config.Uploads{MaxBytes: int64(len(jpeg)), MaxWidth: 40, MaxHeight: 40, MaxPixels: 1000}
+		Init(stores, settings)
+
+		if err := upload.Init(settings.Storage, settings.Uploads); err != nil {
+			t.Fatal(err)
+		}
+
+		author := handlertest.NewUser(t, store.Users, "author@example.com", "hash", models.PrivUser)
+
+		// The cases run in order, so the image has been posted before it is posted again.
+		cases := []struct {
+			name   string
+			images [][]byte
+			status int
+		}{
+			{"no images", nil, http.StatusUnprocessableEntity},
+			{"not an image", [][]byte{[]byte("This is not an image.")}, http.StatusUnsupportedMediaType},
+			{"unsupported image", [][]byte{append([]byte("BM"), make([]byte, 64)...)}, http.StatusUnsupportedMediaType},
+			{"too large", [][]byte{append(jpeg, 0)}, http.StatusRequestEntityTooLarge},
+			{"too many pixels together", [][]byte{jpeg, rotated}, http.StatusUnprocessableEntity},
+			{"valid", [][]byte{jpeg}, http.StatusOK},
+			{"repost", [][]byte{jpeg}, http.StatusConflict},
+		}
+
+		for _, c := range cases {
+			request := newPostRequest(t, c.images...)
+			context.Set(request, "uuid", author)
+
+			recorder := httptest.NewRecorder()
+			New(recorder, request)
+
+			if recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+			}
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/VolticFroogo/Animal-Pictures/captcha"
+	"github.com/VolticFroogo/Animal-Pictures/config"
 	"github.com/VolticFroogo/Animal-Pictures/db"
 	"github.com/VolticFroogo/Animal-Pictures/helpers"
 	"github.com/VolticFroogo/Animal-Pictures/models"
@@ -13,6 +14,17 @@ import (
 	"github.com/gorilla/mux"
 )
 
+var (
+	store    = db.SQLStores()
+	settings = config.Default()
+)
+
+// Init sets the stores and configuration used by the handlers.
+func Init(stores db.Stores, config config.Config) {
+	store = stores
+	settings = config
+}
+
 type voteRequest struct {
 	Upvote             bool
 	Captcha, CaptchaV2 string
@@ -31,7 +43,7 @@ func Page(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if loggedIn {
-		self, err := db.GetUserFromUUID(uuid.(string))
+		self, err := store.Users.GetUserFromUUID(uuid.(string))
 		if err != nil {
 			helpers.ThrowErr(w, r, "Getting user from DB error", err)
 			return
@@ -49,7 +61,7 @@ func Page(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 
-	post, err := db.GetPost(vars["uuid"])
+	post, err := store.Posts.GetPost(vars["uuid"])
 	if err != nil {
 		helpers.ThrowErr(w, r, "Getting post from DB error", err)
 		return
@@ -73,11 +85,27 @@ func Page(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if vote, ok := variables.Post.Votes[variables.Self.UUID]; ok {
-		if vote {
-			variables.Post.Vote = 1
-		} else {
-			variables.Post.Vote = 2
+	if loggedIn && post.Creation != 0 {
+		variables.Post.Vote, err = store.Posts.GetVote(post.UUID, variables.Self.UUID)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting vote from DB error", err)
+			return
+		}
+	}
+
+	if post.Creation != 0 {
+		variables.Post.Tags, err = store.Tags.GetPostTags(post.UUID)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting post tags from DB error", err)
+			return
+		}
+
+		page := helpers.Page(r.URL.Query().Get("comments"))
+		variables.Pagination.Page = page
+		variables.Comments, variables.Pagination.More, err = store.Comments.GetComments(post.UUID, variables.Self.UUID, page)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting comments from DB error", err)
+			return
 		}
 	}
 
@@ -98,14 +126,14 @@ func Vote(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Secure our request with reCAPTCHA v2 and v3.
-	if !captcha.V3(data.CaptchaV2, data.Captcha, r.Header.Get("CF-Connecting-IP"), "vote") {
+	if !captcha.V3(data.CaptchaV2, data.Captcha, helpers.IP(r), "vote") {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	vars := mux.Vars(r)
 
-	post, err := db.GetPost(vars["uuid"])
+	post, err := store.Posts.GetPost(vars["uuid"])
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Getting post from DB error", err)
@@ -118,7 +146,7 @@ func Vote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	score, err := db.SetVote(post, context.Get(r, "uuid").(string), data.Upvote)
+	score, err := store.Posts.SetVote(post, context.Get(r, "uuid").(string), data.Upvote)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Setting vote error", err)
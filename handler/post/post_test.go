@@ -0,0 +1,130 @@
+package post
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/internal/handlertest"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+func TestMain(m *testing.M) {
+	handlertest.Main(m)
+}
+
+func TestVote(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		Init(stores, config.Default())
+
+		voter := handlertest.NewUser(t, store.Users, "voter@example.com", "hash", models.PrivUser)
+		post, err := store.Posts.NewPost("Cat", "A cat.", voter, []models.Image{{Key: "cat.jpg"}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The cases run in order against the same post.
+		cases := []struct {
+			name   string
+			post   string
+			body   string
+			status int
+			score  int
+		}{
+			{"failed captcha", post.UUID, `{"Upvote":true}`, http.StatusBadRequest, 0},
+			{"missing post", "missing", `{"Upvote":true,"Captcha":"ok"}`, http.StatusGone, 0},
+			{"upvote", post.UUID, `{"Upvote":true,"Captcha":"ok"}`, http.StatusOK, 1},
+			{"change to downvote", post.UUID, `{"Upvote":false,"Captcha":"ok"}`, http.StatusOK, -1},
+		}
+
+		for _, c := range cases {
+			recorder := handlertest.Serve(Vote, "/post/{uuid}/vote", http.MethodPost, "/post/"+c.post+"/vote", c.body, voter)
+			if recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+				continue
+			}
+
+			if c.status != http.StatusOK {
+				continue
+			}
+
+			var response voteResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Errorf("%v: decoding response: %v", c.name, err)
+			} else if response.Score != c.score {
+				t.Errorf("%v: got score %v, want %v", c.name, response.Score, c.score)
+			}
+		}
+	})
+}
+
+func TestComments(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		Init(stores, config.Default())
+
+		owner := handlertest.NewUser(t, store.Users, "owner@example.com", "hash", models.PrivUser)
+		other := handlertest.NewUser(t, store.Users, "other@example.com", "hash", models.PrivUser)
+		moderator := handlertest.NewUser(t, store.Users, "moderator@example.com", "hash", models.PrivModerator)
+
+		post, err := store.Posts.NewPost("Dog", "A dog.", owner, []models.Image{{Key: "dog.jpg"}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		comment, err := store.Comments.NewComment(post.UUID, 0, owner, "Good dog.")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		comments := "/post/" + post.UUID + "/comments"
+		target := fmt.Sprintf("%v/%v", comments, comment.ID)
+
+		// The cases run in order, so the comment is edited before it is deleted.
+		cases := []struct {
+			name    string
+			handler http.HandlerFunc
+			pattern string
+			method  string
+			target  string
+			body    string
+			user    string
+			status  int
+		}{
+			{"comment", NewComment, "/post/{uuid}/comments", http.MethodPost, comments, `{"Body":"Very good dog.","Captcha":"ok"}`, other, http.StatusOK},
+			{"empty comment", NewComment, "/post/{uuid}/comments", http.MethodPost, comments, `{"Body":"  ","Captcha":"ok"}`, other, http.StatusUnprocessableEntity},
+			{"reply to missing comment", NewComment, "/post/{uuid}/comments", http.MethodPost, comments, `{"Body":"Hi.","ParentID":999,"Captcha":"ok"}`, other, http.StatusGone},
+			{"comment on missing post", NewComment, "/post/{uuid}/comments", http.MethodPost, "/post/missing/comments", `{"Body":"Hi.","Captcha":"ok"}`, other, http.StatusGone},
+			{"failed captcha", NewComment, "/post/{uuid}/comments", http.MethodPost, comments, `{"Body":"Hi."}`, other, http.StatusBadRequest},
+			{"edit someone else's", EditComment, "/post/{uuid}/comments/{id:[0-9]+}", http.MethodPut, target, `{"Body":"Bad dog.","Captcha":"ok"}`, other, http.StatusForbidden},
+			{"edit through another post", EditComment, "/post/{uuid}/comments/{id:[0-9]+}", http.MethodPut, fmt.Sprintf("/post/missing/comments/%v", comment.ID), `{"Body":"Bad dog.","Captcha":"ok"}`, owner, http.StatusGone},
+			{"edit own", EditComment, "/post/{uuid}/comments/{id:[0-9]+}", http.MethodPut, target, `{"Body":"Best dog.","Captcha":"ok"}`, owner, http.StatusOK},
+			{"vote", VoteComment, "/post/{uuid}/comments/{id:[0-9]+}", http.MethodPost, target, `{"Upvote":true,"Captcha":"ok"}`, other, http.StatusOK},
+			{"delete someone else's", DeleteComment, "/post/{uuid}/comments/{id:[0-9]+}", http.MethodDelete, target, `{"Captcha":"ok"}`, other, http.StatusForbidden},
+			{"delete as moderator", DeleteComment, "/post/{uuid}/comments/{id:[0-9]+}", http.MethodDelete, target, `{"Captcha":"ok"}`, moderator, http.StatusOK},
+			{"vote on deleted", VoteComment, "/post/{uuid}/comments/{id:[0-9]+}", http.MethodPost, target, `{"Upvote":true,"Captcha":"ok"}`, other, http.StatusGone},
+		}
+
+		for _, c := range cases {
+			recorder := handlertest.Serve(c.handler, c.pattern, c.method, c.target, c.body, c.user)
+			if recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+			}
+		}
+
+		edited, err := store.Comments.GetComment(comment.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !edited.Deleted {
+			t.Error("comment wasn't deleted")
+		}
+
+		if edited.Upvotes != 1 {
+			t.Errorf("comment has %v upvotes, want 1", edited.Upvotes)
+		}
+	})
+}
@@ -6,12 +6,30 @@ import (
 	"time"
 
 	"github.com/VolticFroogo/Animal-Pictures/captcha"
+	"github.com/VolticFroogo/Animal-Pictures/config"
 	"github.com/VolticFroogo/Animal-Pictures/db"
 	"github.com/VolticFroogo/Animal-Pictures/email"
 	"github.com/VolticFroogo/Animal-Pictures/helpers"
 	"github.com/VolticFroogo/Animal-Pictures/models"
 )
 
+var (
+	store    = db.SQLStores()
+	settings = config.Default()
+	// requests limits how many recovery emails each user and IP can ask for.
+	requests = helpers.NewLimiter(settings.Codes.MaxAttempts, settings.Codes.AttemptPeriod.Duration)
+	// guesses limits how many wrong recovery codes each IP can try.
+	guesses = helpers.NewLimiter(settings.Codes.MaxAttempts, settings.Codes.AttemptPeriod.Duration)
+)
+
+// Init sets the stores and configuration used by the handlers.
+func Init(stores db.Stores, config config.Config) {
+	store = stores
+	settings = config
+	requests = helpers.NewLimiter(config.Codes.MaxAttempts, config.Codes.AttemptPeriod.Duration)
+	guesses = helpers.NewLimiter(config.Codes.MaxAttempts, config.Codes.AttemptPeriod.Duration)
+}
+
 // Response codes.
 const (
 	Success = iota
@@ -41,12 +59,17 @@ func Begin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Secure our request with reCAPTCHA v2 and v3.
-	if !captcha.V3(data.CaptchaV2, data.Captcha, r.Header.Get("CF-Connecting-IP"), "forgot_password") {
+	if !captcha.V3(data.CaptchaV2, data.Captcha, helpers.IP(r), "forgot_password") {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	user, err := db.GetUserFromEmail(data.Email)
+	if !requests.Attempt(helpers.IP(r)) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	user, err := store.Users.GetUserFromEmail(data.Email)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Getting user error", err)
@@ -58,9 +81,15 @@ func Begin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !requests.Attempt(user.UUID) {
+		// Even though we aren't sending an email we can't reveal if a user exists so we say that we MAY have sent an email.
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
 	// Check if we have sent a recovery email within the last X amount of time.
 	// If we have we won't send them an email to prevent spam.
-	_, _, creation, err := db.GetRecoveryFromUser(user.UUID)
+	_, _, creation, err := store.Verifications.GetRecoveryFromUser(user.UUID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Getting previous recovery error", err)
@@ -71,7 +100,7 @@ func Begin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	code, err := db.AddRecovery(user.UUID, data.Email)
+	code, err := store.Verifications.AddRecovery(user.UUID, data.Email)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		helpers.ThrowErr(w, r, "Adding recovery error", err)
@@ -81,7 +110,7 @@ func Begin(w http.ResponseWriter, r *http.Request) {
 	err = email.Recovery(code, user.Username, data.Email)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		helpers.ThrowErr(w, r, "Send email error", err)
+		helpers.ThrowErr(w, r, "Queueing recovery email error", err)
 		return
 	}
 
@@ -99,34 +128,44 @@ func End(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Secure our request with reCAPTCHA v2 and v3.
-	if !captcha.V3(data.CaptchaV2, data.Captcha, r.Header.Get("CF-Connecting-IP"), "reset_password") {
+	if !captcha.V3(data.CaptchaV2, data.Captcha, helpers.IP(r), "reset_password") {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	userUUID, email, err := db.GetRecovery(data.Code)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		helpers.ThrowErr(w, r, "Getting recovery error", err)
+	ip := helpers.IP(r)
+	if !guesses.Allowed(ip) {
+		w.WriteHeader(http.StatusTooManyRequests)
 		return
 	}
 
-	if userUUID == "" || email == "" {
+	hash, err := helpers.HashPassword(data.Password)
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Hashing password error", err)
 		return
 	}
 
-	hash, err := helpers.HashPassword(data.Password)
+	// The code is only used up if the password is changed, so a failure doesn't lock the user out of recovering their account.
+	userUUID, err := store.Verifications.ResetPassword(data.Code, settings.Codes.TTL.Duration, hash)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		helpers.ThrowErr(w, r, "Hashing password error", err)
+		helpers.ThrowErr(w, r, "Resetting password error", err)
+		return
+	}
+
+	if userUUID == "" {
+		// The code is wrong, has expired or has already been used.
+		guesses.Attempt(ip)
+		w.WriteHeader(http.StatusGone)
 		return
 	}
 
-	err = db.EditPassword(userUUID, hash)
+	// Log out everywhere in case someone else was logged in to the account.
+	err = store.Tokens.DeAuthUser(userUUID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		helpers.ThrowErr(w, r, "Editing password error", err)
+		helpers.ThrowErr(w, r, "Deauthorising user error", err)
 		return
 	}
 
@@ -0,0 +1,160 @@
+package recovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
+	"github.com/VolticFroogo/Animal-Pictures/internal/handlertest"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/gorilla/mux"
+)
+
+func TestMain(m *testing.M) {
+	router := mux.NewRouter()
+	router.PathPrefix("/password-recovery").Handler(http.NotFoundHandler()).Name("password-recovery")
+	helpers.InitURLs(router, "")
+
+	handlertest.Main(m)
+}
+
+// setup uses stores and a new empty mailer for a test.
+func setup(stores db.Stores) *handlertest.Outbox {
+	Init(stores, config.Default())
+	return handlertest.Mail()
+}
+
+// post sends a JSON request to a handler.
+func post(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return recorder
+}
+
+func TestBegin(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		mail := setup(stores)
+		handlertest.NewUser(t, store.Users, "user@example.com", "hash", models.PrivUser)
+
+		// The cases run in order, so the second request for the same account is throttled.
+		cases := []struct {
+			name   string
+			body   string
+			status int
+			sent   int
+		}{
+			{"failed captcha", `{"Email":"user@example.com"}`, http.StatusBadRequest, 0},
+			{"unknown email", `{"Email":"nobody@example.com","Captcha":"ok"}`, http.StatusOK, 0},
+			{"known email", `{"Email":"user@example.com","Captcha":"ok"}`, http.StatusOK, 1},
+			{"sent too recently", `{"Email":"user@example.com","Captcha":"ok"}`, http.StatusOK, 1},
+		}
+
+		for _, c := range cases {
+			recorder := post(Begin, c.body)
+			if recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+			}
+
+			if len(mail.Sent) != c.sent {
+				t.Errorf("%v: %v emails have been sent, want %v", c.name, len(mail.Sent), c.sent)
+			}
+		}
+
+		if len(mail.Sent) > 0 && !strings.Contains(mail.Sent[0].Text, "/password-recovery?code=") {
+			t.Errorf("recovery email doesn't link to /password-recovery: %q", mail.Sent[0].Text)
+		}
+	})
+}
+
+func TestBeginLimit(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		setup(stores)
+
+		for i := 0; i < settings.Codes.MaxAttempts; i++ {
+			if recorder := post(Begin, `{"Email":"nobody@example.com","Captcha":"ok"}`); recorder.Code != http.StatusOK {
+				t.Fatalf("request %v: got status %v, want %v", i, recorder.Code, http.StatusOK)
+			}
+		}
+
+		if recorder := post(Begin, `{"Email":"nobody@example.com","Captcha":"ok"}`); recorder.Code != http.StatusTooManyRequests {
+			t.Errorf("got status %v once the IP used every attempt, want %v", recorder.Code, http.StatusTooManyRequests)
+		}
+	})
+}
+
+func TestEnd(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		setup(stores)
+
+		uuid := handlertest.NewUser(t, store.Users, "user@example.com", "hash", models.PrivUser)
+		code, err := store.Verifications.AddRecovery(uuid, "user@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jti, err := store.Tokens.StoreRefreshToken(uuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The cases run in order, so the code has been used by the last case.
+		cases := []struct {
+			name   string
+			body   string
+			status int
+		}{
+			{"failed captcha", `{"Code":"` + code + `","Password":"new password"}`, http.StatusBadRequest},
+			{"wrong code", `{"Code":"wrong","Password":"new password","Captcha":"ok"}`, http.StatusGone},
+			{"right code", `{"Code":"` + code + `","Password":"new password","Captcha":"ok"}`, http.StatusOK},
+			{"used code", `{"Code":"` + code + `","Password":"other password","Captcha":"ok"}`, http.StatusGone},
+		}
+
+		for _, c := range cases {
+			if recorder := post(End, c.body); recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+			}
+		}
+
+		user, err := store.Users.GetUserFromUUID(uuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !helpers.CheckPassword("new password", user.Password) {
+			t.Error("password wasn't changed")
+		}
+
+		// Resetting the password logs the user out everywhere.
+		if _, err := store.Tokens.GetJTI(jti.JTI); err == nil {
+			t.Error("refresh token is still valid after resetting the password")
+		}
+	})
+}
+
+func TestEndLimit(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		// Every attempt hashes the new password, so fewer attempts keep the test quick.
+		settings := config.Default()
+		settings.Codes.MaxAttempts = 1
+		Init(stores, settings)
+
+		uuid := handlertest.NewUser(t, store.Users, "user@example.com", "hash", models.PrivUser)
+		code, err := store.Verifications.AddRecovery(uuid, "user@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < settings.Codes.MaxAttempts; i++ {
+			post(End, `{"Code":"wrong","Password":"new password","Captcha":"ok"}`)
+		}
+
+		// Once an IP has guessed too many times even the right code is refused.
+		if recorder := post(End, `{"Code":"`+code+`","Password":"new password","Captcha":"ok"}`); recorder.Code != http.StatusTooManyRequests {
+			t.Errorf("got status %v once the IP used every attempt, want %v", recorder.Code, http.StatusTooManyRequests)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/VolticFroogo/Animal-Pictures/search"
+	"github.com/gorilla/context"
+)
+
+type searchVariables struct {
+	models.TemplateVariables
+	Query   search.Query
+	Results search.Results
+	// Range and Score are the filters as they were given so the form keeps them.
+	Range, Score string
+	// Previous and Next are the URLs of the pages around this one.
+	Previous, Next string
+}
+
+// searchQuery reads a search from the query parameters q, t, score, author, order and page.
+// Invalid filters are ignored.
+func searchQuery(values url.Values) (query search.Query) {
+	query = search.Query{
+		Text:     strings.TrimSpace(values.Get("q")),
+		MinScore: search.NoMinScore,
+		Author:   strings.TrimSpace(values.Get("author")),
+		Order:    search.OrderRelevance,
+	}
+
+	if duration, ok := search.Ranges[values.Get("t")]; ok {
+		query.Since = time.Now().Add(-duration).Unix()
+	}
+
+	if score, err := strconv.Atoi(values.Get("score")); err == nil {
+		query.MinScore = score
+	}
+
+	if values.Get("order") == search.OrderRating {
+		query.Order = search.OrderRating
+	}
+
+	query.Page = helpers.Page(values.Get("page"))
+	return
+}
+
+// searchPage is the handler for the search page.
+func searchPage(w http.ResponseWriter, r *http.Request) {
+	uuid, loggedIn := context.GetOk(r, "uuid")
+
+	variables := searchVariables{
+		TemplateVariables: models.TemplateVariables{
+			LoggedIn: loggedIn,
+		},
+		Query: searchQuery(r.URL.Query()),
+		Range: r.URL.Query().Get("t"),
+		Score: r.URL.Query().Get("score"),
+	}
+
+	if loggedIn {
+		user, err := store.Users.GetUserFromUUID(uuid.(string))
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting user from DB error", err)
+			return
+		}
+
+		csrfSecret, err := r.Cookie("csrfSecret")
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting CSRF Secret cookie error", err)
+			return
+		}
+
+		variables.Self = user
+		variables.CsrfSecret = csrfSecret.Value
+	}
+
+	var err error
+	variables.Results, err = store.Searcher.Search(variables.Query)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Searching error", err)
+		return
+	}
+
+	values := r.URL.Query()
+	variables.Pagination = models.Pagination{
+		Page: variables.Query.Page,
+		More: variables.Results.More,
+	}
+
+	values.Set("page", strconv.Itoa(variables.Pagination.Previous()))
+	variables.Previous = "/search?" + values.Encode()
+	values.Set("page", strconv.Itoa(variables.Pagination.Next()))
+	variables.Next = "/search?" + values.Encode()
+
+	t, err := template.ParseFiles("templates/search.html", "templates/nested.html") // Parse the HTML pages.
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template parsing error", err)
+		return
+	}
+
+	err = t.Execute(w, variables)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template execution error", err)
+	}
+}
+
+// searchJSON is the handler for searching which returns the results as JSON.
+func searchJSON(w http.ResponseWriter, r *http.Request) {
+	results, err := store.Searcher.Search(searchQuery(r.URL.Query()))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Searching error", err)
+		return
+	}
+
+	if results.Posts == nil {
+		results.Posts = []models.Post{}
+	}
+
+	helpers.JSONResponse(results, w)
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/VolticFroogo/Animal-Pictures/search"
+)
+
+func TestSearchQuery(t *testing.T) {
+	cases := []struct {
+		raw   string
+		query search.Query
+	}{
+		{"q=+cat+&score=5&author=alice&order=rating&page=2", search.Query{Text: "cat", MinScore: 5, Author: "alice", Order: search.OrderRating, Page: 2}},
+		{"q=cat&score=many&order=random&page=-3", search.Query{Text: "cat", MinScore: search.NoMinScore, Order: search.OrderRelevance}},
+		{"page=999999999999", search.Query{MinScore: search.NoMinScore, Order: search.OrderRelevance, Page: models.MaxPage}},
+		{"page=99999999999999999999", search.Query{MinScore: search.NoMinScore, Order: search.OrderRelevance}},
+	}
+
+	for _, c := range cases {
+		values, err := url.ParseQuery(c.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if query := searchQuery(values); query != c.query {
+			t.Errorf("%q: got %+v, want %+v", c.raw, query, c.query)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package tag
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/VolticFroogo/Animal-Pictures/captcha"
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+var (
+	store    = db.SQLStores()
+	settings = config.Default()
+)
+
+// Init sets the stores and configuration used by the handlers.
+func Init(stores db.Stores, config config.Config) {
+	store = stores
+	settings = config
+}
+
+type mergeRequest struct {
+	// Tag is the other tag, the tag merged into or the alias being added.
+	Tag                string
+	Captcha, CaptchaV2 string
+}
+
+// Page is the handler for the page of the hot posts with a tag.
+func Page(w http.ResponseWriter, r *http.Request) {
+	uuid, loggedIn := context.GetOk(r, "uuid")
+
+	variables := models.TemplateVariables{
+		LoggedIn: loggedIn,
+	}
+
+	if loggedIn {
+		self, err := store.Users.GetUserFromUUID(uuid.(string))
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting user from DB error", err)
+			return
+		}
+
+		csrfSecret, err := r.Cookie("csrfSecret")
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting CSRF Secret cookie error", err)
+			return
+		}
+
+		variables.Self = self
+		variables.CsrfSecret = csrfSecret.Value
+	}
+
+	name := mux.Vars(r)["name"]
+
+	tag, err := store.Tags.GetTag(models.TagName(name))
+	if err != nil {
+		helpers.ThrowErr(w, r, "Getting tag from DB error", err)
+		return
+	}
+
+	if tag.ID == 0 {
+		w.WriteHeader(http.StatusNotFound)
+
+		t, err := template.ParseFiles("templates/tag/not-found.html", "templates/nested.html") // Parse the HTML pages.
+		if err != nil {
+			helpers.ThrowErr(w, r, "Template parsing error", err)
+			return
+		}
+
+		err = t.Execute(w, variables)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Template execution error", err)
+		}
+
+		return
+	}
+
+	if tag.Name != name {
+		// Aliases and names which aren't normalised are redirected to the tag's own page.
+		target := "/tag/" + tag.Name
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	page := helpers.Page(r.URL.Query().Get("page"))
+	variables.Tag = tag
+	variables.Pagination.Page = page
+	variables.Posts, variables.Pagination.More, err = store.Tags.GetTagPosts(tag.ID, page)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Getting tag posts error", err)
+		return
+	}
+
+	t, err := template.ParseFiles("templates/tag/page.html", "templates/nested.html") // Parse the HTML pages.
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template parsing error", err)
+		return
+	}
+
+	err = t.Execute(w, variables)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template execution error", err)
+	}
+}
+
+// Autocomplete is the handler returning the tags starting with the query as JSON.
+func Autocomplete(w http.ResponseWriter, r *http.Request) {
+	tags := []models.Tag{}
+
+	if prefix := models.TagName(r.URL.Query().Get("q")); prefix != "" {
+		found, err := store.Tags.SearchTags(prefix)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			helpers.ThrowErr(w, r, "Searching tags error", err)
+			return
+		}
+
+		if found != nil {
+			tags = found
+		}
+	}
+
+	helpers.JSONResponse(tags, w)
+}
+
+// Merge is the handler for moderators merging the tag into another.
+func Merge(w http.ResponseWriter, r *http.Request) {
+	merge(w, r, func(name, other string) error {
+		return store.Tags.MergeTags(name, other)
+	})
+}
+
+// Alias is the handler for moderators adding an alias of the tag.
+func Alias(w http.ResponseWriter, r *http.Request) {
+	merge(w, r, func(name, other string) error {
+		return store.Tags.MergeTags(other, name)
+	})
+}
+
+// merge checks a moderator's merge request and then applies it.
+func merge(w http.ResponseWriter, r *http.Request, apply func(name, other string) error) {
+	var data mergeRequest                        // Create struct to store data.
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	// Secure our request with reCAPTCHA v2 and v3.
+	if !captcha.V3(data.CaptchaV2, data.Captcha, helpers.IP(r), "tag_merge") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	self, err := store.Users.GetUserFromUUID(context.Get(r, "uuid").(string))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Getting user from DB error", err)
+		return
+	}
+
+	if self.Privilege < models.PrivModerator {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	name, other := models.TagName(mux.Vars(r)["name"]), models.TagName(data.Tag)
+	if name == "" || other == "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = apply(name, other)
+	switch err {
+	case nil:
+		helpers.SuccessResponse(true, w, r)
+	case db.ErrTagNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case db.ErrSameTag:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Merging tags error", err)
+	}
+}
@@ -0,0 +1,104 @@
+package tag
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/internal/handlertest"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+func TestMain(m *testing.M) {
+	handlertest.Main(m)
+}
+
+// setup uses stores with a post tagged cat and dog for a test.
+func setup(t *testing.T, stores db.Stores) {
+	Init(stores, config.Default())
+
+	author := handlertest.NewUser(t, store.Users, "author@example.com", "hash", models.PrivUser)
+	_, err := store.Posts.NewPost("Cat", "A cat.", author, []models.Image{{Key: "cat.jpg"}}, []models.Tag{{Name: "cat", Kind: models.TagSpecies}, {Name: "dog", Kind: models.TagLabel}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPage(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		setup(t, stores)
+
+		if err := store.Tags.MergeTags("kitty", "cat"); err != nil {
+			t.Fatal(err)
+		}
+
+		cases := []struct {
+			name     string
+			target   string
+			status   int
+			redirect string
+		}{
+			{"tag", "/tag/cat", http.StatusOK, ""},
+			{"alias", "/tag/kitty", http.StatusMovedPermanently, "/tag/cat"},
+			{"not normalised", "/tag/Cat?page=1", http.StatusMovedPermanently, "/tag/cat?page=1"},
+			{"missing", "/tag/wolf", http.StatusNotFound, ""},
+		}
+
+		for _, c := range cases {
+			recorder := handlertest.Serve(Page, "/tag/{name}", http.MethodGet, c.target, "", "")
+			if recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+			}
+
+			if location := recorder.Header().Get("Location"); location != c.redirect {
+				t.Errorf("%v: redirected to %q, want %q", c.name, location, c.redirect)
+			}
+		}
+	})
+}
+
+func TestMerge(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		setup(t, stores)
+
+		user := handlertest.NewUser(t, store.Users, "user@example.com", "hash", models.PrivUser)
+		moderator := handlertest.NewUser(t, store.Users, "moderator@example.com", "hash", models.PrivModerator)
+
+		// The cases run in order, so tags which have been merged are aliases afterwards.
+		cases := []struct {
+			name    string
+			handler http.HandlerFunc
+			target  string
+			body    string
+			user    string
+			status  int
+		}{
+			{"merge as user", Merge, "/tag/dog/merge", `{"Tag":"cat","Captcha":"ok"}`, user, http.StatusForbidden},
+			{"alias as user", Alias, "/tag/cat/alias", `{"Tag":"kitty","Captcha":"ok"}`, user, http.StatusForbidden},
+			{"failed captcha", Merge, "/tag/dog/merge", `{"Tag":"cat"}`, moderator, http.StatusBadRequest},
+			{"empty tag", Merge, "/tag/dog/merge", `{"Tag":"!!","Captcha":"ok"}`, moderator, http.StatusUnprocessableEntity},
+			{"merge into missing tag", Merge, "/tag/dog/merge", `{"Tag":"wolf","Captcha":"ok"}`, moderator, http.StatusNotFound},
+			{"alias of missing tag", Alias, "/tag/wolf/alias", `{"Tag":"puppy","Captcha":"ok"}`, moderator, http.StatusNotFound},
+			{"merge into itself", Merge, "/tag/cat/merge", `{"Tag":"Cat","Captcha":"ok"}`, moderator, http.StatusConflict},
+			{"alias", Alias, "/tag/cat/alias", `{"Tag":"kitty","Captcha":"ok"}`, moderator, http.StatusOK},
+			{"alias twice", Alias, "/tag/cat/alias", `{"Tag":"kitty","Captcha":"ok"}`, moderator, http.StatusConflict},
+			{"merge", Merge, "/tag/dog/merge", `{"Tag":"kitty","Captcha":"ok"}`, moderator, http.StatusOK},
+			{"merge twice", Merge, "/tag/dog/merge", `{"Tag":"cat","Captcha":"ok"}`, moderator, http.StatusConflict},
+		}
+
+		for _, c := range cases {
+			recorder := handlertest.Serve(c.handler, "/tag/{name}/{action}", http.MethodPost, c.target, c.body, c.user)
+			if recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+			}
+		}
+
+		// Merging into an alias merges into the tag it is another name for.
+		for _, name := range []string{"kitty", "dog"} {
+			if tag, err := store.Tags.GetTag(name); err != nil || tag.Name != "cat" {
+				t.Errorf("%v is %+v, want an alias of cat: %v", name, tag, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,316 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/VolticFroogo/Animal-Pictures/captcha"
+	"github.com/VolticFroogo/Animal-Pictures/email"
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
+	"github.com/VolticFroogo/Animal-Pictures/middleware"
+	"github.com/VolticFroogo/Animal-Pictures/middleware/myJWT"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/VolticFroogo/Animal-Pictures/upload"
+	"github.com/gorilla/context"
+)
+
+type settingsRequest struct {
+	Username, Fname, Lname, Description string
+	Email, Password, NewPassword        string
+	Captcha, CaptchaV2                  string
+}
+
+type pictureResponse struct {
+	ProfilePicture string
+}
+
+// decodeSettingsRequest decodes a settings request and checks its reCAPTCHA, writing the failure status if it returns false.
+func decodeSettingsRequest(w http.ResponseWriter, r *http.Request, action string) (data settingsRequest, ok bool) {
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	// Secure our request with reCAPTCHA v2 and v3.
+	if !captcha.V3(data.CaptchaV2, data.Captcha, helpers.IP(r), action) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	return data, true
+}
+
+// requestSelf returns the logged in user making a request, writing the failure status if it returns false.
+func requestSelf(w http.ResponseWriter, r *http.Request) (self models.User, ok bool) {
+	self, err := store.Users.GetUserFromUUID(context.Get(r, "uuid").(string))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Getting user from DB error", err)
+		return
+	}
+
+	return self, true
+}
+
+// validField returns if a field is no longer than the maximum and, if required, not empty, trimming its whitespace.
+func validField(field *string, max int, required bool) bool {
+	*field = strings.TrimSpace(*field)
+	return (*field != "" || !required) && utf8.RuneCountInString(*field) <= max
+}
+
+// Settings is the response for a GET request to the account settings page.
+func Settings(w http.ResponseWriter, r *http.Request) {
+	uuid, loggedIn := context.GetOk(r, "uuid")
+
+	variables := models.TemplateVariables{
+		LoggedIn: loggedIn,
+	}
+
+	if loggedIn {
+		self, err := store.Users.GetUserFromUUID(uuid.(string))
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting user from DB error", err)
+			return
+		}
+
+		csrfSecret, err := r.Cookie("csrfSecret")
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting CSRF Secret cookie error", err)
+			return
+		}
+
+		variables.Self = self
+		variables.CsrfSecret = csrfSecret.Value
+	}
+
+	t, err := template.ParseFiles("templates/user/settings.html", "templates/nested.html") // Parse the HTML pages.
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template parsing error", err)
+		return
+	}
+
+	err = t.Execute(w, variables)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Template execution error", err)
+	}
+}
+
+// EditProfile is the handler for a user changing their username, names and description.
+func EditProfile(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeSettingsRequest(w, r, "edit_profile")
+	if !ok {
+		return
+	}
+
+	if !validField(&data.Username, models.MaxUsernameLength, true) ||
+		!validField(&data.Fname, models.MaxNameLength, false) ||
+		!validField(&data.Lname, models.MaxNameLength, false) ||
+		!validField(&data.Description, models.MaxBioLength, false) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	err := store.Users.EditSelf(context.Get(r, "uuid").(string), data.Username, data.Fname, data.Lname, data.Description)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Editing user error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// EditPassword is the handler for a user changing their password, which logs them out everywhere else.
+func EditPassword(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeSettingsRequest(w, r, "edit_password")
+	if !ok {
+		return
+	}
+
+	self, ok := requestSelf(w, r)
+	if !ok {
+		return
+	}
+
+	if !helpers.CheckPassword(data.Password, self.Password) {
+		// They must know their current password to change it.
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if data.NewPassword == "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	hash, err := helpers.HashPassword(data.NewPassword)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Hashing password error", err)
+		return
+	}
+
+	err = store.Users.EditPassword(self.UUID, hash)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Editing password error", err)
+		return
+	}
+
+	// Log out every other session then give this one new tokens.
+	err = store.Tokens.DeAuthUser(self.UUID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Deauthorising user error", err)
+		return
+	}
+
+	authTokenString, refreshTokenString, csrfSecret, err := myJWT.CreateNewTokens(self.UUID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Creating tokens error", err)
+		return
+	}
+
+	middleware.WriteNewAuth(w, r, authTokenString, refreshTokenString, csrfSecret)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// EditEmail is the handler for a user changing their email, which only changes once the new address is verified.
+func EditEmail(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeSettingsRequest(w, r, "edit_email")
+	if !ok {
+		return
+	}
+
+	self, ok := requestSelf(w, r)
+	if !ok {
+		return
+	}
+
+	if !changes.Attempt(self.UUID) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	if !helpers.CheckPassword(data.Password, self.Password) {
+		// They must know their password to change their email.
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	data.Email = strings.TrimSpace(data.Email)
+	if !helpers.CheckEmail(data.Email) {
+		// Email is invalid, return not acceptable.
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	exists, err := store.Users.UserExistsFromEmail(data.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Checking if user exists error", err)
+		return
+	} else if exists {
+		w.WriteHeader(http.StatusConflict)
+		return // A user already exists with email.
+	}
+
+	code, err := store.Verifications.AddEmailVerification(self.UUID, data.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Creating email verification error", err)
+		return
+	}
+
+	err = email.ChangeEmail(code, self.Username, data.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Queueing change email error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// EditPicture is the handler for a user uploading a new profile picture.
+func EditPicture(w http.ResponseWriter, r *http.Request) {
+	// Decline requests larger than the maximum image size with 1MB left for the rest of the form.
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Uploads.MaxBytes+1024*1024)
+	err := r.ParseMultipartForm(5 * 1024 * 1024) // Parse multipart form, use total 5MB of RAM.
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Parsing multipart form error", err)
+		return
+	}
+
+	// Secure our request with reCAPTCHA v2 and v3.
+	if !captcha.V3(r.FormValue("captchaV2"), r.FormValue("captcha"), helpers.IP(r), "edit_picture") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	files := r.MultipartForm.File["picture"]
+	if len(files) != 1 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	self, ok := requestSelf(w, r)
+	if !ok {
+		return
+	}
+
+	extension, err := upload.ProfilePicture(files[0], self.UUID)
+	if err != nil {
+		switch err {
+		case upload.ErrNotImage, upload.ErrUnsupportedImage:
+			// They are trying to upload a file that we think isn't an image or can't handle.
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		case upload.ErrTooLarge:
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		case upload.ErrTooManyPixels:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Uploading profile picture error", err)
+		return
+	}
+
+	err = store.Users.EditProfilePicture(self.UUID, extension)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Editing profile picture error", err)
+		return
+	}
+
+	// The new picture replaced the old one unless it has a different extension.
+	if self.HasProfilePicture() && self.ImageExtension != extension {
+		err = upload.RemoveProfilePicture(self.UUID, self.ImageExtension)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Removing old profile picture error", err)
+		}
+	}
+
+	self.ImageExtension = extension
+	helpers.JSONResponse(pictureResponse{
+		ProfilePicture: self.ProfilePicture(),
+	}, w)
+}
@@ -1,16 +1,40 @@
 package user
 
 import (
+	"encoding/json"
 	"html/template"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/VolticFroogo/Animal-Pictures/captcha"
+	"github.com/VolticFroogo/Animal-Pictures/config"
 	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/email"
 	"github.com/VolticFroogo/Animal-Pictures/helpers"
 	"github.com/VolticFroogo/Animal-Pictures/models"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 )
 
+var (
+	store    = db.SQLStores()
+	settings = config.Default()
+	// guesses limits how many wrong verification codes each IP can try.
+	guesses = helpers.NewLimiter(settings.Codes.MaxAttempts, settings.Codes.AttemptPeriod.Duration)
+	// changes limits how many email changes each user can ask for.
+	changes = helpers.NewLimiter(settings.Codes.MaxAttempts, settings.Codes.AttemptPeriod.Duration)
+)
+
+// Init sets the stores and configuration used by the handlers.
+func Init(stores db.Stores, config config.Config) {
+	store = stores
+	settings = config
+	guesses = helpers.NewLimiter(config.Codes.MaxAttempts, config.Codes.AttemptPeriod.Duration)
+	changes = helpers.NewLimiter(config.Codes.MaxAttempts, config.Codes.AttemptPeriod.Duration)
+}
+
 // Page is the response for a GET request to a user's page.
 func Page(w http.ResponseWriter, r *http.Request) {
 	uuid, loggedIn := context.GetOk(r, "uuid")
@@ -20,7 +44,7 @@ func Page(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if loggedIn {
-		self, err := db.GetUserFromUUID(uuid.(string))
+		self, err := store.Users.GetUserFromUUID(uuid.(string))
 		if err != nil {
 			helpers.ThrowErr(w, r, "Getting user from DB error", err)
 			return
@@ -38,7 +62,7 @@ func Page(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 
-	user, err := db.GetUserFromUUID(vars["uuid"])
+	user, err := store.Users.GetUserFromUUID(vars["uuid"])
 	if err != nil {
 		helpers.ThrowErr(w, r, "Getting user from DB error", err)
 		return
@@ -48,6 +72,14 @@ func Page(w http.ResponseWriter, r *http.Request) {
 
 	var t *template.Template
 
+	if user.Creation != 0 {
+		variables.Sort, variables.Pagination, variables.Posts, variables.Stats, err = profile(r, user.UUID)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Getting user's posts error", err)
+			return
+		}
+	}
+
 	if user.Creation == 0 {
 		t, err = template.ParseFiles("templates/user/not-found.html", "templates/nested.html") // Parse the HTML pages.
 		if err != nil {
@@ -68,26 +100,218 @@ func Page(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Verify is the response for when a user clicks the verify button after registering their account.
+type profileResponse struct {
+	User  models.User
+	Stats models.UserStats
+	Posts []models.Post
+	More  bool
+}
+
+// profile returns the page of a user's posts given by the sort and page query parameters and their stats.
+// Invalid sorts are treated as new.
+func profile(r *http.Request, uuid string) (sort string, pagination models.Pagination, posts []models.Post, stats models.UserStats, err error) {
+	sort = r.URL.Query().Get("sort")
+	if sort != models.SortHot && sort != models.SortTop {
+		sort = models.SortNew
+	}
+
+	pagination.Page = helpers.Page(r.URL.Query().Get("page"))
+
+	posts, pagination.More, err = store.Posts.GetUserPosts(uuid, sort, pagination.Page)
+	if err != nil {
+		return
+	}
+
+	stats, err = store.Users.GetUserStats(uuid)
+	return
+}
+
+// PageJSON is the response for a GET request to a user's page as JSON.
+func PageJSON(w http.ResponseWriter, r *http.Request) {
+	user, err := store.Users.GetUserFromUUID(mux.Vars(r)["uuid"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Getting user from DB error", err)
+		return
+	}
+
+	if user.Creation == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	response := profileResponse{
+		User:  user,
+		Posts: []models.Post{},
+	}
+
+	_, pagination, posts, stats, err := profile(r, user.UUID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Getting user's posts error", err)
+		return
+	}
+
+	if posts != nil {
+		response.Posts = posts
+	}
+
+	response.Stats, response.More = stats, pagination.More
+	helpers.JSONResponse(response, w)
+}
+
+// loginRedirect redirects to the login page which shows the message of a code.
+func loginRedirect(w http.ResponseWriter, r *http.Request, code string) {
+	link, err := helpers.URL("login", url.Values{"code": {code}})
+	if err != nil {
+		helpers.ThrowErr(w, r, "Building login URL error", err)
+		return
+	}
+
+	http.Redirect(w, r, link, http.StatusTemporaryRedirect)
+}
+
+// Verify is the response for when a user clicks the verify button after registering their account or changing their email.
 func Verify(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	uuid, _, err := db.GetEmailVerification(vars["code"])
+	ip := helpers.IP(r)
+	if !guesses.Allowed(ip) {
+		loginRedirect(w, r, "5")
+		return
+	}
+
+	uuid, address, err := store.Verifications.GetEmailVerification(vars["code"], settings.Codes.TTL.Duration)
 	if err != nil {
 		helpers.ThrowErr(w, r, "Getting email verification error", err)
 		return
 	}
 
 	if uuid == "" {
-		http.Redirect(w, r, "https://ap.froogo.co.uk/login/?code=2", http.StatusTemporaryRedirect)
+		// The code is wrong, has expired or has already been used.
+		guesses.Attempt(ip)
+		loginRedirect(w, r, "2")
+		return
+	}
+
+	user, err := store.Users.GetUserFromUUID(uuid)
+	if err != nil {
+		helpers.ThrowErr(w, r, "Getting user from DB error", err)
+		return
+	}
+
+	if address != user.Email {
+		// The user is changing their email, check nobody took the address since they asked.
+		exists, err := store.Users.UserExistsFromEmail(address)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Checking if user exists error", err)
+			return
+		} else if exists {
+			loginRedirect(w, r, "4")
+			return
+		}
+
+		err = store.Users.EditSelfEmail(uuid, address)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Editing email error", err)
+			return
+		}
+	}
+
+	if user.Privilege == models.PrivUnverified {
+		err = store.Users.EditPrivilege(uuid, models.PrivUser)
+		if err != nil {
+			helpers.ThrowErr(w, r, "Editing privilege error", err)
+			return
+		}
+	}
+
+	loginRedirect(w, r, "1")
+}
+
+// resendRequest is a request for another verification email for the account with an email address.
+type resendRequest struct {
+	Email              string
+	Captcha, CaptchaV2 string
+}
+
+// decodeResendRequest decodes a request for another verification email and checks its reCAPTCHA, writing the failure status if it returns false.
+func decodeResendRequest(w http.ResponseWriter, r *http.Request) (data resendRequest, ok bool) {
+	err := json.NewDecoder(r.Body).Decode(&data) // Decode response to struct.
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "JSON decoding error", err)
+		return
+	}
+
+	// Secure our request with reCAPTCHA v2 and v3.
+	if !captcha.V3(data.CaptchaV2, data.Captcha, helpers.IP(r), "resend_verification") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	return data, true
+}
+
+// resendResponse tells the user how long they must wait between verification emails.
+type resendResponse struct {
+	Hours int
+}
+
+// resent replies to a request for another verification email, the same whether or not one was sent.
+func resent(w http.ResponseWriter) {
+	helpers.JSONResponse(resendResponse{
+		Hours: int(models.EmailAntiSpamTime / time.Hour),
+	}, w)
+}
+
+// Resend is the handler for an unverified user asking for another verification email.
+func Resend(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeResendRequest(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := store.Users.GetUserFromEmail(strings.TrimSpace(data.Email))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Getting user error", err)
+		return
+	}
+
+	if user.UUID == "" || user.Privilege != models.PrivUnverified {
+		// Even though we aren't sending an email we can't reveal if a user exists so we say that we MAY have sent an email.
+		resent(w)
+		return
+	}
+
+	// Check if we have sent a verification email within the last X amount of time.
+	// If we have we won't send them an email to prevent spam.
+	_, _, creation, err := store.Verifications.GetEmailVerificationFromUser(user.UUID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Getting previous email verification error", err)
+		return
+	} else if creation != 0 && time.Unix(creation, 0).Add(models.EmailAntiSpamTime).After(time.Now()) {
+		// Even though we aren't sending an email we can't reveal if a user exists so we say that we MAY have sent an email.
+		resent(w)
+		return
+	}
+
+	// Adding a verification replaces the old one so only the newest link works.
+	code, err := store.Verifications.AddEmailVerification(user.UUID, user.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Creating email verification error", err)
 		return
 	}
 
-	err = db.EditPrivilege(uuid, models.PrivUser)
+	err = email.Register(code, user.Username, user.Email)
 	if err != nil {
-		helpers.ThrowErr(w, r, "Editing privilege error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		helpers.ThrowErr(w, r, "Queueing registration email error", err)
 		return
 	}
 
-	http.Redirect(w, r, "https://ap.froogo.co.uk/login/?code=1", http.StatusTemporaryRedirect)
+	resent(w)
 }
@@ -0,0 +1,247 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
+	"github.com/VolticFroogo/Animal-Pictures/internal/handlertest"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"github.com/gorilla/mux"
+)
+
+func TestMain(m *testing.M) {
+	router := mux.NewRouter()
+	router.Handle("/verify/{code}", http.NotFoundHandler()).Name("verify")
+	router.PathPrefix("/login").Handler(http.NotFoundHandler()).Name("login")
+	helpers.InitURLs(router, "")
+
+	handlertest.Main(m)
+}
+
+// setup uses stores and a new empty mailer for a test.
+func setup(stores db.Stores) *handlertest.Outbox {
+	Init(stores, config.Default())
+	return handlertest.Mail()
+}
+
+// newCode adds an email verification, failing the test if it can't.
+func newCode(t *testing.T, userUUID, address string) string {
+	code, err := store.Verifications.AddEmailVerification(userUUID, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+func TestVerify(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		setup(stores)
+
+		unverified := handlertest.NewUser(t, store.Users, "new@example.com", "hash", models.PrivUnverified)
+		registered := newCode(t, unverified, "new@example.com")
+
+		verified := handlertest.NewUser(t, store.Users, "old@example.com", "hash", models.PrivModerator)
+		changed := newCode(t, verified, "changed@example.com")
+
+		handlertest.NewUser(t, store.Users, "taken@example.com", "hash", models.PrivUser)
+		late := handlertest.NewUser(t, store.Users, "late@example.com", "hash", models.PrivUser)
+		taken := newCode(t, late, "taken@example.com")
+
+		// The cases run in order, so codes which were used once are gone.
+		cases := []struct {
+			name     string
+			code     string
+			redirect string
+		}{
+			{"register", registered, "/login?code=1"},
+			{"used twice", registered, "/login?code=2"},
+			{"wrong code", "wrong", "/login?code=2"},
+			{"change email", changed, "/login?code=1"},
+			{"change to taken email", taken, "/login?code=4"},
+		}
+
+		for _, c := range cases {
+			recorder := handlertest.Serve(Verify, "/verify/{code}", http.MethodGet, "/verify/"+c.code, "", "")
+			if location := recorder.Header().Get("Location"); location != c.redirect {
+				t.Errorf("%v: redirected to %q, want %q", c.name, location, c.redirect)
+			}
+		}
+
+		if user, _ := store.Users.GetUserFromUUID(unverified); user.Privilege != models.PrivUser {
+			t.Errorf("registered user has privilege %v, want %v", user.Privilege, models.PrivUser)
+		}
+
+		// Changing email mustn't change the privilege of a user who was already verified.
+		if user, _ := store.Users.GetUserFromUUID(verified); user.Email != "changed@example.com" || user.Privilege != models.PrivModerator {
+			t.Errorf("user who changed email has email %q and privilege %v", user.Email, user.Privilege)
+		}
+	})
+}
+
+func TestVerifyExpired(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		setup(stores)
+
+		uuid := handlertest.NewUser(t, store.Users, "new@example.com", "hash", models.PrivUnverified)
+		code := newCode(t, uuid, "new@example.com")
+
+		settings.Codes.TTL.Duration = -time.Second
+		recorder := handlertest.Serve(Verify, "/verify/{code}", http.MethodGet, "/verify/"+code, "", "")
+		if location := recorder.Header().Get("Location"); location != "/login?code=2" {
+			t.Errorf("expired code redirected to %q", location)
+		}
+
+		if user, _ := store.Users.GetUserFromUUID(uuid); user.Privilege != models.PrivUnverified {
+			t.Error("expired code verified the user")
+		}
+	})
+}
+
+func TestVerifyLimit(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		setup(stores)
+
+		uuid := handlertest.NewUser(t, store.Users, "new@example.com", "hash", models.PrivUnverified)
+		code := newCode(t, uuid, "new@example.com")
+
+		for i := 0; i < settings.Codes.MaxAttempts; i++ {
+			handlertest.Serve(Verify, "/verify/{code}", http.MethodGet, "/verify/wrong", "", "")
+		}
+
+		// Once an IP has guessed too many times even the right code is refused.
+		recorder := handlertest.Serve(Verify, "/verify/{code}", http.MethodGet, "/verify/"+code, "", "")
+		if location := recorder.Header().Get("Location"); location != "/login?code=5" {
+			t.Errorf("limited request redirected to %q", location)
+		}
+	})
+}
+
+func TestResend(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		mail := setup(stores)
+
+		handlertest.NewUser(t, store.Users, "new@example.com", "hash", models.PrivUnverified)
+		handlertest.NewUser(t, store.Users, "old@example.com", "hash", models.PrivUser)
+
+		// The cases run in order, so the second request for the same account is throttled.
+		cases := []struct {
+			name   string
+			body   string
+			status int
+			sent   int
+		}{
+			{"failed captcha", `{"Email":"new@example.com"}`, http.StatusBadRequest, 0},
+			{"unknown email", `{"Email":"nobody@example.com","Captcha":"ok"}`, http.StatusOK, 0},
+			{"verified user", `{"Email":"old@example.com","Captcha":"ok"}`, http.StatusOK, 0},
+			{"unverified user", `{"Email":"new@example.com","Captcha":"ok"}`, http.StatusOK, 1},
+			{"sent too recently", `{"Email":"new@example.com","Captcha":"ok"}`, http.StatusOK, 1},
+		}
+
+		want := fmt.Sprintf(`{"Hours":%v}`, int(models.EmailAntiSpamTime/time.Hour))
+
+		for _, c := range cases {
+			recorder := handlertest.Serve(Resend, "/verify/resend", http.MethodPost, "/verify/resend", c.body, "")
+			if recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+			}
+
+			// Every reply is the same so they don't reveal which accounts exist.
+			if recorder.Code == http.StatusOK && recorder.Body.String() != want {
+				t.Errorf("%v: got body %q, want %q", c.name, recorder.Body.String(), want)
+			}
+
+			if len(mail.Sent) != c.sent {
+				t.Errorf("%v: %v emails have been sent, want %v", c.name, len(mail.Sent), c.sent)
+			}
+		}
+
+		if len(mail.Sent) > 0 && !strings.Contains(mail.Sent[0].Text, "/verify/") {
+			t.Errorf("verification email doesn't link to /verify/: %q", mail.Sent[0].Text)
+		}
+	})
+}
+
+func TestEditProfile(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		setup(stores)
+
+		uuid := handlertest.NewUser(t, store.Users, "user@example.com", "hash", models.PrivUser)
+
+		cases := []struct {
+			name     string
+			body     string
+			status   int
+			username string
+		}{
+			{"failed captcha", `{"Username":"cat"}`, http.StatusBadRequest, "user"},
+			{"empty username", `{"Username":"  ","Captcha":"ok"}`, http.StatusUnprocessableEntity, "user"},
+			{"long username", `{"Username":"` + strings.Repeat("a", models.MaxUsernameLength+1) + `","Captcha":"ok"}`, http.StatusUnprocessableEntity, "user"},
+			{"valid", `{"Username":" cat ","Fname":"Tom","Description":"Meow.","Captcha":"ok"}`, http.StatusOK, "cat"},
+		}
+
+		for _, c := range cases {
+			recorder := handlertest.Serve(EditProfile, "/settings/profile", http.MethodPost, "/settings/profile", c.body, uuid)
+			if recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+			}
+
+			if user, _ := store.Users.GetUserFromUUID(uuid); user.Username != c.username {
+				t.Errorf("%v: username is %q, want %q", c.name, user.Username, c.username)
+			}
+		}
+	})
+}
+
+func TestEditEmail(t *testing.T) {
+	handlertest.Stores(t, func(t *testing.T, stores db.Stores) {
+		mail := setup(stores)
+
+		password, err := helpers.HashPassword("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		uuid := handlertest.NewUser(t, store.Users, "user@example.com", password, models.PrivUser)
+		handlertest.NewUser(t, store.Users, "taken@example.com", "hash", models.PrivUser)
+
+		cases := []struct {
+			name   string
+			body   string
+			status int
+			sent   int
+		}{
+			{"wrong password", `{"Email":"new@example.com","Password":"wrong","Captcha":"ok"}`, http.StatusUnauthorized, 0},
+			{"invalid email", `{"Email":"new","Password":"password","Captcha":"ok"}`, http.StatusNotAcceptable, 0},
+			{"taken email", `{"Email":"taken@example.com","Password":"password","Captcha":"ok"}`, http.StatusConflict, 0},
+			{"valid", `{"Email":"new@example.com","Password":"password","Captcha":"ok"}`, http.StatusOK, 1},
+			{"too many attempts", `{"Email":"new@example.com","Password":"password","Captcha":"ok"}`, http.StatusTooManyRequests, 1},
+		}
+
+		// Only as many attempts as the last case needs to be refused are allowed.
+		settings.Codes.MaxAttempts = len(cases) - 1
+		Init(store, settings)
+
+		for _, c := range cases {
+			recorder := handlertest.Serve(EditEmail, "/settings/email", http.MethodPost, "/settings/email", c.body, uuid)
+			if recorder.Code != c.status {
+				t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+			}
+
+			if len(mail.Sent) != c.sent {
+				t.Errorf("%v: %v emails have been sent, want %v", c.name, len(mail.Sent), c.sent)
+			}
+		}
+
+		// The email only changes once the new address is verified.
+		if user, _ := store.Users.GetUserFromUUID(uuid); user.Email != "user@example.com" {
+			t.Errorf("email changed to %q before it was verified", user.Email)
+		}
+	})
+}
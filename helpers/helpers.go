@@ -1,12 +1,17 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"log"
-	"math/rand"
+	"net"
 	"net/http"
+	"strconv"
 
+	"github.com/VolticFroogo/Animal-Pictures/models"
 	"github.com/goware/emailx"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -19,6 +24,10 @@ type idResponse struct {
 	ID int
 }
 
+// codeBytes is how many random bytes are in verification and recovery codes.
+const codeBytes = 32
+
+// generateRandomBytes returns cryptographically secure random bytes.
 func generateRandomBytes(size int) ([]byte, error) {
 	bytes := make([]byte, size)
 	_, err := rand.Read(bytes)
@@ -36,6 +45,73 @@ func GenerateRandomString(size int) (string, error) {
 	return base64.URLEncoding.EncodeToString(b), err
 }
 
+// GenerateCode returns a random code for a link, such as an email verification or password recovery.
+func GenerateCode() (string, error) {
+	b, err := generateRandomBytes(codeBytes)
+	return base64.RawURLEncoding.EncodeToString(b), err
+}
+
+// HashCode hashes a code so it can be stored without being usable if it is read.
+// Codes are random enough that they don't need a slow hash like passwords.
+func HashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// trustedProxies are the ranges of the proxies trusted to set the CF-Connecting-IP header.
+var trustedProxies []*net.IPNet
+
+// InitProxies sets the ranges of the proxies trusted to set the CF-Connecting-IP header.
+func InitProxies(proxies []*net.IPNet) {
+	trustedProxies = proxies
+}
+
+// IP returns the IP address a request came from.
+// Cloudflare's header is only trusted from a trusted proxy, as anyone connecting directly could set it.
+func IP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if ip := r.Header.Get("CF-Connecting-IP"); ip != "" && trusted(host) {
+		return ip
+	}
+
+	return host
+}
+
+// trusted returns if an address is of a trusted proxy.
+func trusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, proxy := range trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Page parses the number of a page from a query parameter.
+// Invalid pages are treated as the first page and pages after MaxPage are clamped to it.
+func Page(value string) int {
+	page, err := strconv.Atoi(value)
+	if err != nil || page < 0 {
+		return 0
+	}
+
+	if page > models.MaxPage {
+		return models.MaxPage
+	}
+
+	return page
+}
+
 // HashPassword hashes a password.
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
@@ -56,10 +132,18 @@ func ThrowErr(w http.ResponseWriter, r *http.Request, errName string, err error)
 
 // JSONResponse sends a client a JSON response.
 func JSONResponse(data interface{}, w http.ResponseWriter) (err error) {
+	return JSONStatusResponse(data, http.StatusOK, w)
+}
+
+// JSONStatusResponse sends a client a JSON response with a status code.
+// Headers can't be set once the status is written so the content type is set first.
+func JSONStatusResponse(data interface{}, status int, w http.ResponseWriter) (err error) {
 	dataJSON, err := json.Marshal(data) // Encode response into JSON.
 	if err != nil {
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	w.Write(dataJSON) // Write JSON data to response writer.
 	return
 }
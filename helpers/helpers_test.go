@@ -0,0 +1,101 @@
+package helpers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+func TestJSONStatusResponse(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+	}{
+		{"ok", http.StatusOK},
+		{"conflict", http.StatusConflict},
+	}
+
+	for _, c := range cases {
+		recorder := httptest.NewRecorder()
+
+		err := JSONStatusResponse(map[string]int{"ID": 1}, c.status, recorder)
+		if err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+
+		if recorder.Code != c.status {
+			t.Errorf("%v: got status %v, want %v", c.name, recorder.Code, c.status)
+		}
+
+		if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("%v: got content type %q, want application/json", c.name, contentType)
+		}
+
+		if body := recorder.Body.String(); body != `{"ID":1}` {
+			t.Errorf("%v: got body %q", c.name, body)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	cases := []struct {
+		value string
+		page  int
+	}{
+		{"", 0},
+		{"cat", 0},
+		{"-3", 0},
+		{"2", 2},
+		{strconv.Itoa(models.MaxPage), models.MaxPage},
+		{strconv.Itoa(models.MaxPage + 1), models.MaxPage},
+		{"99999999999999999999", 0},
+	}
+
+	for _, c := range cases {
+		if page := Page(c.value); page != c.page {
+			t.Errorf("%q: got page %v, want %v", c.value, page, c.page)
+		}
+	}
+}
+
+func TestIP(t *testing.T) {
+	_, proxy, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	InitProxies([]*net.IPNet{proxy})
+	t.Cleanup(func() {
+		InitProxies(nil)
+	})
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		ip         string
+	}{
+		{"direct", "203.0.113.1:1234", "", "203.0.113.1"},
+		{"header from a stranger", "203.0.113.1:1234", "198.51.100.1", "203.0.113.1"},
+		{"header from a proxy", "10.1.2.3:1234", "198.51.100.1", "198.51.100.1"},
+		{"proxy without the header", "10.1.2.3:1234", "", "10.1.2.3"},
+		{"no port", "203.0.113.1", "198.51.100.1", "203.0.113.1"},
+		{"IPv6", "[2001:db8::1]:1234", "", "2001:db8::1"},
+	}
+
+	for _, c := range cases {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = c.remoteAddr
+		if c.header != "" {
+			request.Header.Set("CF-Connecting-IP", c.header)
+		}
+
+		if ip := IP(request); ip != c.ip {
+			t.Errorf("%v: got IP %v, want %v", c.name, ip, c.ip)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package helpers
+
+import (
+	"sync"
+	"time"
+)
+
+type window struct {
+	start    time.Time
+	attempts int
+}
+
+// Limiter counts attempts by a key, such as an IP or a user, and refuses more once there have been too many within a window.
+type Limiter struct {
+	max    int
+	period time.Duration
+
+	mutex   sync.Mutex
+	windows map[string]window
+	// swept is when the expired windows were last removed.
+	swept time.Time
+}
+
+// NewLimiter returns a limiter allowing max attempts by each key every period.
+func NewLimiter(max int, period time.Duration) *Limiter {
+	return &Limiter{
+		max:     max,
+		period:  period,
+		windows: make(map[string]window),
+	}
+}
+
+// Allowed returns if a key hasn't used all of its attempts in the current window.
+func (limiter *Limiter) Allowed(key string) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	return limiter.current(key).attempts < limiter.max
+}
+
+// Attempt counts an attempt by a key, returning if it was allowed.
+func (limiter *Limiter) Attempt(key string) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	current := limiter.current(key)
+	if current.attempts >= limiter.max {
+		return false
+	}
+
+	current.attempts++
+	limiter.windows[key] = current
+	return true
+}
+
+// current returns a key's window, starting a new one if it has expired, the mutex must be held.
+func (limiter *Limiter) current(key string) window {
+	now := time.Now()
+
+	// Expired windows are removed every period so the map doesn't grow forever.
+	if now.Sub(limiter.swept) >= limiter.period {
+		for other, w := range limiter.windows {
+			if now.Sub(w.start) >= limiter.period {
+				delete(limiter.windows, other)
+			}
+		}
+
+		limiter.swept = now
+	}
+
+	current, ok := limiter.windows[key]
+	if !ok || now.Sub(current.start) >= limiter.period {
+		current = window{start: now}
+	}
+
+	return current
+}
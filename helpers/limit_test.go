@@ -0,0 +1,60 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterMax(t *testing.T) {
+	limiter := NewLimiter(2, time.Hour)
+
+	for i, want := range []bool{true, true, false} {
+		if allowed := limiter.Allowed("a"); allowed != want {
+			t.Errorf("attempt %v: allowed is %v, want %v", i, allowed, want)
+		}
+
+		if attempted := limiter.Attempt("a"); attempted != want {
+			t.Errorf("attempt %v: counted is %v, want %v", i, attempted, want)
+		}
+	}
+
+	// Each key has attempts of its own.
+	if !limiter.Allowed("b") {
+		t.Error("another key was refused")
+	}
+}
+
+func TestLimiterWindowExpires(t *testing.T) {
+	const period = 50 * time.Millisecond
+	limiter := NewLimiter(1, period)
+
+	limiter.Attempt("a")
+	if limiter.Allowed("a") {
+		t.Fatal("attempt was allowed after using the only one")
+	}
+
+	time.Sleep(period)
+
+	if !limiter.Allowed("a") || !limiter.Attempt("a") {
+		t.Error("attempt was refused once the window expired")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	const period = 50 * time.Millisecond
+	limiter := NewLimiter(1, period)
+
+	limiter.Attempt("a")
+	limiter.Attempt("b")
+	time.Sleep(period)
+
+	// Any attempt after a period removes every expired window.
+	limiter.Attempt("c")
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if _, ok := limiter.windows["a"]; ok || len(limiter.windows) != 1 {
+		t.Errorf("windows after sweeping are %v, want only c", limiter.windows)
+	}
+}
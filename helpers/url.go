@@ -0,0 +1,41 @@
+package helpers
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrUnknownRoute is returned when building the URL of a route the router doesn't have.
+var ErrUnknownRoute = errors.New("unknown route")
+
+var (
+	routes  = mux.NewRouter()
+	baseURL string
+)
+
+// InitURLs sets the router and the base URL which absolute URLs are built from.
+func InitURLs(router *mux.Router, url string) {
+	routes = router
+	baseURL = url
+}
+
+// URL returns the absolute URL of a named route, pairs are the names and values of its variables.
+// The query is added to the URL if it isn't empty.
+func URL(name string, query url.Values, pairs ...string) (link string, err error) {
+	route := routes.Get(name)
+	if route == nil {
+		err = ErrUnknownRoute
+		return
+	}
+
+	path, err := route.URL(pairs...)
+	if err != nil {
+		return
+	}
+
+	path.RawQuery = query.Encode()
+	link = baseURL + path.String()
+	return
+}
@@ -0,0 +1,103 @@
+// Package handlertest has the fixtures shared by the tests of the handlers.
+package handlertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/captcha"
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/email"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// Outbox is a mailer which keeps the emails it is sent.
+type Outbox struct {
+	Sent []email.Message
+}
+
+// Send keeps an email.
+func (o *Outbox) Send(message email.Message) error {
+	o.Sent = append(o.Sent, message)
+	return nil
+}
+
+// Main prepares the handlers to be tested and then runs the tests, it is called by TestMain.
+// Templates and static pages are found relative to the root of the repository, so it is made the working directory.
+// Requests pass the reCAPTCHA if they send "ok" as their v3 token.
+func Main(m *testing.M) {
+	_, file, _, _ := runtime.Caller(0)
+	if err := os.Chdir(filepath.Join(filepath.Dir(file), "..", "..")); err != nil {
+		panic(err)
+	}
+
+	captcha.V3 = func(v2, v3, ip, action string) bool {
+		return v3 == "ok"
+	}
+
+	os.Exit(m.Run())
+}
+
+// Stores runs a test with new empty stores of each kind, in memory and in an SQLite database.
+func Stores(t *testing.T, test func(t *testing.T, stores db.Stores)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, db.NewMemoryStores())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		err := db.Open(config.DB{Type: db.SQLite, Path: ":memory:"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		if _, err := db.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, db.SQLStores())
+	})
+}
+
+// Mail uses a new empty mailer for a test.
+func Mail() *Outbox {
+	mail := &Outbox{}
+	email.Mail = mail
+	return mail
+}
+
+// Serve sends a request to a handler routed at a pattern, logged in as a user unless userUUID is empty.
+func Serve(handler http.HandlerFunc, pattern, method, target, body, userUUID string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if userUUID != "" {
+			context.Set(r, "uuid", userUUID)
+		}
+
+		handler(w, r)
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder
+}
+
+// NewUser adds a user named after their email address to a store, failing the test if it can't.
+func NewUser(t *testing.T, users db.UserStore, address, password string, privilege int) string {
+	uuid, err := users.NewUser(address, password, strings.Split(address, "@")[0], privilege)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return uuid
+}
@@ -3,38 +3,256 @@ package main
 import (
 	"log"
 	"math/rand"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/VolticFroogo/Animal-Pictures/captcha"
+	"github.com/VolticFroogo/Animal-Pictures/config"
 	"github.com/VolticFroogo/Animal-Pictures/db"
+	"github.com/VolticFroogo/Animal-Pictures/email"
 	"github.com/VolticFroogo/Animal-Pictures/handler"
+	"github.com/VolticFroogo/Animal-Pictures/helpers"
 	"github.com/VolticFroogo/Animal-Pictures/middleware/myJWT"
+	"github.com/VolticFroogo/Animal-Pictures/models"
 	"github.com/VolticFroogo/Animal-Pictures/upload"
 )
 
 func main() {
+	// Load the configuration from the config file, environment and flags.
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Printf("Error loading config: %v", err)
+		return
+	}
+
+	// Run a command instead of the website if one was given.
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			migrate(cfg, args[1:])
+		case "backfill-hashes":
+			backfillHashes(cfg)
+		case "rerank":
+			rerank(cfg)
+		default:
+			log.Printf("Unknown command: %v", args[0])
+		}
+
+		return
+	}
+
 	// Seed the randomiser to prevent repeated seeds and values.
 	rand.Seed(time.Now().UTC().UnixNano())
 
-	captcha.Init()
+	models.Ranking, err = models.NewRanker(cfg.Posts.Ranker, cfg.Posts.Gravity)
+	if err != nil {
+		log.Printf("Error choosing ranker: %v", err)
+		return
+	}
+
+	proxies, err := cfg.HTTP.Proxies()
+	if err != nil {
+		log.Printf("Error parsing trusted proxies: %v", err)
+		return
+	}
 
-	if err := upload.Init(); err != nil {
+	helpers.InitProxies(proxies)
+	captcha.Init(cfg.Captcha)
+
+	if err := email.Init(cfg.Email, cfg.HTTP.BaseURL); err != nil {
+		log.Printf("Error initialising mailer: %v", err)
+		return
+	}
+
+	if err := upload.Init(cfg.Storage, cfg.Uploads); err != nil {
 		log.Printf("Error initialising uploader: %v", err)
 		return
 	}
 
 	// Initialise the database.
-	if err := db.InitDB(); err != nil {
+	if err := db.InitDB(cfg.DB); err != nil {
 		log.Printf("Error initialising database: %v", err)
 		return
 	}
 
 	// Load up the RSA keys.
-	if err := myJWT.InitKeys(); err != nil {
+	if err := myJWT.InitKeys(cfg.JWT); err != nil {
 		log.Printf("Error initialising JWT keys: %v", err)
 		return
 	}
 
+	if models.Ranking.Decays() {
+		// Ratings which fall as posts age are recalculated as often as the hot posts are updated.
+		go func() {
+			for range time.Tick(models.HotPostsTickRate) {
+				if _, err := db.Rerank(); err != nil {
+					log.Printf("Error reranking posts: %v", err)
+				}
+			}
+		}()
+	}
+
+	if age := cfg.Codes.UnverifiedAge.Duration; age > 0 {
+		// Accounts which are never verified are deleted so their email addresses can be registered again.
+		go func() {
+			for range time.Tick(models.PurgeTickRate) {
+				if _, err := db.PurgeUnverifiedUsers(time.Now().Add(-age).Unix()); err != nil {
+					log.Printf("Error purging unverified users: %v", err)
+				}
+			}
+		}()
+	}
+
+	stores := db.SQLStores()
+	if cfg.Posts.HotCachePages > 0 {
+		cache := db.NewHotCache(stores.Posts, cfg.Posts.HotCachePages, cfg.Posts.HotCacheVoteSwing)
+		cache.Start()
+		stores.Posts = cache
+	}
+
+	// Emails are queued and sent in the background so a failing mailer doesn't fail requests.
+	queue := email.NewQueue(stores.Mail, email.Mail, cfg.Email.MaxAttempts, cfg.Email.Backoff.Duration)
+	queue.Start()
+	email.Mail = queue
+
+	// Bodies of dead emails are cleared once their links have expired and old emails are deleted.
+	go func() {
+		for range time.Tick(models.PurgeTickRate) {
+			now := time.Now()
+			if _, err := stores.Mail.PurgeMail(now.Add(-cfg.Codes.TTL.Duration).Unix(), now.Add(-models.MailKeepTime).Unix()); err != nil {
+				log.Printf("Error purging queued emails: %v", err)
+			}
+		}
+	}()
+
 	// Start the website handler.
-	handler.Start()
+	handler.Start(stores, cfg)
+}
+
+// migrate runs the migrate command: "migrate [up]" or "migrate down [steps]".
+func migrate(cfg config.Config, args []string) {
+	// Migrations which rate posts again use the configured ranker.
+	var err error
+	models.Ranking, err = models.NewRanker(cfg.Posts.Ranker, cfg.Posts.Gravity)
+	if err != nil {
+		log.Printf("Error choosing ranker: %v", err)
+		return
+	}
+
+	if err := db.Open(cfg.DB); err != nil {
+		log.Printf("Error opening database: %v", err)
+		return
+	}
+
+	direction := "up"
+	if len(args) > 0 {
+		direction = args[0]
+	}
+
+	switch direction {
+	case "up":
+		applied, err := db.Migrate()
+		if err != nil {
+			log.Printf("Error migrating database: %v", err)
+			return
+		}
+
+		log.Printf("Applied %v migrations.", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Printf("Invalid number of steps: %v", args[1])
+				return
+			}
+		}
+
+		reverted, err := db.Rollback(steps)
+		if err != nil {
+			log.Printf("Error rolling back database: %v", err)
+			return
+		}
+
+		log.Printf("Reverted %v migrations.", reverted)
+	case "status":
+		current, err := db.SchemaVersion()
+		if err != nil {
+			log.Printf("Error getting schema version: %v", err)
+			return
+		}
+
+		latest, err := db.LatestVersion()
+		if err != nil {
+			log.Printf("Error getting latest schema version: %v", err)
+			return
+		}
+
+		log.Printf("Database schema is at version %v, latest is %v.", current, latest)
+	default:
+		log.Printf("Unknown migrate direction: %v", direction)
+	}
+}
+
+// backfillHashes runs the backfill-hashes command, storing the hashes of images posted before they were hashed.
+func backfillHashes(cfg config.Config) {
+	if err := upload.Init(cfg.Storage, cfg.Uploads); err != nil {
+		log.Printf("Error initialising uploader: %v", err)
+		return
+	}
+
+	if err := db.InitDB(cfg.DB); err != nil {
+		log.Printf("Error initialising database: %v", err)
+		return
+	}
+
+	images, err := db.GetUnhashedImages()
+	if err != nil {
+		log.Printf("Error getting unhashed images: %v", err)
+		return
+	}
+
+	hashed := 0
+	for _, image := range images {
+		hash, err := upload.HashStored(image.Key)
+		if err != nil {
+			// Keep going so one broken image doesn't stop the rest being hashed.
+			log.Printf("Error hashing image %v of post %v: %v", image.Key, image.PostUUID, err)
+			continue
+		}
+
+		if err := db.SetImageHash(image.PostUUID, image.Key, hash); err != nil {
+			log.Printf("Error storing hash of image %v of post %v: %v", image.Key, image.PostUUID, err)
+			return
+		}
+
+		hashed++
+	}
+
+	log.Printf("Hashed %v of %v images.", hashed, len(images))
+}
+
+// rerank runs the rerank command, recalculating the rating of every post after the ranker is changed.
+func rerank(cfg config.Config) {
+	var err error
+	models.Ranking, err = models.NewRanker(cfg.Posts.Ranker, cfg.Posts.Gravity)
+	if err != nil {
+		log.Printf("Error choosing ranker: %v", err)
+		return
+	}
+
+	if err := db.InitDB(cfg.DB); err != nil {
+		log.Printf("Error initialising database: %v", err)
+		return
+	}
+
+	reranked, err := db.Rerank()
+	if err != nil {
+		log.Printf("Error reranking posts: %v", err)
+		return
+	}
+
+	log.Printf("Reranked %v posts with the %v ranker.", reranked, cfg.Posts.Ranker)
 }
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"time"
 
+	"github.com/VolticFroogo/Animal-Pictures/config"
 	"github.com/VolticFroogo/Animal-Pictures/db"
 	"github.com/VolticFroogo/Animal-Pictures/helpers"
 	"github.com/VolticFroogo/Animal-Pictures/models"
@@ -16,16 +17,12 @@ import (
 var (
 	signKey   *rsa.PrivateKey
 	verifyKey *rsa.PublicKey
-)
-
-const (
-	privKeyPath = "keys/app.rsa"
-	pubKeyPath  = "keys/app.rsa.pub"
+	tokens    db.TokenStore = db.SQL{}
 )
 
 // InitKeys defines the signing and verification RSA keys for JWT.
-func InitKeys() error {
-	signBytes, err := ioutil.ReadFile(privKeyPath)
+func InitKeys(config config.JWT) error {
+	signBytes, err := ioutil.ReadFile(config.PrivateKey)
 	if err != nil {
 		return err
 	}
@@ -35,7 +32,7 @@ func InitKeys() error {
 		return err
 	}
 
-	verifyBytes, err := ioutil.ReadFile(pubKeyPath)
+	verifyBytes, err := ioutil.ReadFile(config.PublicKey)
 	if err != nil {
 		return err
 	}
@@ -48,6 +45,11 @@ func InitKeys() error {
 	return nil
 }
 
+// Init sets the store refresh token JTIs are kept in.
+func Init(store db.TokenStore) {
+	tokens = store
+}
+
 // DeleteJTI deletes a JTI when given a refresh token.
 func DeleteJTI(tokenString string) (err error) {
 	token, _ := jwt.ParseWithClaims(tokenString, &models.TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
@@ -59,7 +61,7 @@ func DeleteJTI(tokenString string) (err error) {
 	})
 
 	tokenClaims, _ := token.Claims.(*models.TokenClaims)
-	err = db.DeleteJTI(tokenClaims.StandardClaims.Id)
+	err = tokens.DeleteJTI(tokenClaims.StandardClaims.Id)
 	return
 }
 
@@ -112,19 +114,19 @@ func CheckToken(tokenString, csrfSecret string, refresh, checkCsrf, deleteJTI bo
 	}
 
 	if refresh {
-		jti, err := db.GetJTI(tokenClaims.StandardClaims.Id)
+		jti, err := tokens.GetJTI(tokenClaims.StandardClaims.Id)
 		if err != nil {
 			return false, "", fmt.Errorf("getting jti error")
 		}
 
-		jtiValid, err := db.CheckJTI(jti)
+		jtiValid, err := tokens.CheckJTI(jti)
 		if err != nil {
 			return false, "", fmt.Errorf("checking jti error")
 		}
 
 		if jtiValid {
 			if deleteJTI {
-				err = db.DeleteJTI(tokenClaims.StandardClaims.Id) // There will be a new JTI created in it's place by the middleware.
+				err = tokens.DeleteJTI(tokenClaims.StandardClaims.Id) // There will be a new JTI created in it's place by the middleware.
 				if err != nil {
 					return true, tokenClaims.StandardClaims.Subject, err
 				}
@@ -163,7 +165,7 @@ func CreateNewTokens(uuid string) (authTokenString, refreshTokenString, csrfSecr
 
 func createRefreshTokenString(uuid, csrfSecret string) (refreshTokenString string, err error) {
 	refreshTokenExp := time.Now().Add(models.RefreshTokenValidTime).Unix()
-	refreshJti, err := db.StoreRefreshToken(uuid)
+	refreshJti, err := tokens.StoreRefreshToken(uuid)
 	if err != nil {
 		return
 	}
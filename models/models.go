@@ -1,8 +1,12 @@
 package models
 
 import (
+	"encoding/json"
 	"math"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	jwt "github.com/dgrijalva/jwt-go"
 )
@@ -20,10 +24,39 @@ const (
 	CaptchaScore = 0.5
 	// HotPostsTickRate is how often the hot posts page should be updated.
 	HotPostsTickRate = time.Minute // 1 minute.
+	// RisingPostsTime is how recently posts must have been made to be rising.
+	RisingPostsTime = time.Hour * 24 // 1 day.
 	// PostsPerPage is how many posts there are on a page.
 	PostsPerPage = 20
+	// MaxPage is the last page which can be asked for, so the offset of a page can't overflow.
+	MaxPage = 10000
+	// CommentsPerPage is how many top level comments there are on a page, their replies are always shown.
+	CommentsPerPage = 20
+	// MailPerPage is how many queued emails there are on a page of the admin view.
+	MailPerPage = 50
+	// MailTickRate is how often the queued emails are checked for ones which are due to be sent.
+	MailTickRate = time.Second * 10 // 10 seconds.
+	// MailKeepTime is how long sent and dead emails are kept in the queue before they are deleted.
+	MailKeepTime = time.Hour * 24 * 30 // 30 days.
+	// PurgeTickRate is how often accounts which were never verified are checked for ones old enough to be deleted.
+	PurgeTickRate = time.Hour // 1 hour.
+	// MaxCommentLength is the most characters a comment can have.
+	MaxCommentLength = 10000
+	// MaxTagLength is the most characters a tag name can have.
+	MaxTagLength = 32
+	// MaxUsernameLength is the most characters a username can have.
+	MaxUsernameLength = 64
+	// MaxNameLength is the most characters a first or last name can have.
+	MaxNameLength = 64
+	// MaxBioLength is the most characters a user's description can have.
+	MaxBioLength = 1000
 )
 
+// StorageURL converts a storage key into a public URL, it is replaced by the upload package once a backend is chosen.
+var StorageURL = func(key string) string {
+	return key
+}
+
 // Privileges
 const (
 	PrivUnverified = iota
@@ -32,6 +65,22 @@ const (
 	PrivAdmin
 )
 
+// Orderings of lists of posts.
+const (
+	SortHot           = "hot"
+	SortNew           = "new"
+	SortTop           = "top"
+	SortRising        = "rising"
+	SortControversial = "controversial"
+)
+
+// Votes a user can have on a post.
+const (
+	VoteNone = iota
+	VoteUp
+	VoteDown
+)
+
 // User is a user retrieved from a Database.
 type User struct {
 	Creation                                  int64
@@ -53,7 +102,14 @@ func (user User) HasProfilePicture() bool {
 
 // ProfilePicture returns the URL of a user's profile picture.
 func (user User) ProfilePicture() string {
-	return "https://s3.eu-west-2.amazonaws.com/froogo-ap/user/" + user.UUID + user.ImageExtension
+	return StorageURL("user/" + user.UUID + user.ImageExtension)
+}
+
+// UserStats are the totals of a user's activity.
+type UserStats struct {
+	Posts int
+	// Karma is the score of every post and comment the user has made.
+	Karma int
 }
 
 // TokenClaims are the claims in a token.
@@ -62,16 +118,93 @@ type TokenClaims struct {
 	CSRF string `json:"csrf"`
 }
 
+// Names of the resized variants of images.
+const (
+	VariantThumbnail = "thumbnail"
+	VariantFeed      = "feed"
+	VariantFull      = "full"
+)
+
+// Variant is a resized copy of an image.
+type Variant struct {
+	Name          string
+	Key           string
+	Width, Height int
+}
+
+// Image is an image in a post.
+type Image struct {
+	// Key is the file name of the image in the post directory of storage.
+	Key           string
+	Caption, Alt  string `json:",omitempty"`
+	Width, Height int    `json:",omitempty"`
+	// Variants are the resized copies of the image, smallest first.
+	// Images smaller than a variant's width don't have it.
+	Variants []Variant `json:",omitempty"`
+	// Hash is the perceptual hash of the image, it is stored in its own table.
+	Hash uint64 `json:"-"`
+}
+
+// SimilarImage is an image of a post which looks like another image.
+type SimilarImage struct {
+	PostUUID, Key string
+	// Distance is the number of bits which differ between the images' hashes, 0 is identical.
+	Distance int
+}
+
+// UnmarshalJSON reads an image, posts made before captions stored their images as just file names.
+func (image *Image) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*image = Image{}
+		return json.Unmarshal(data, &image.Key)
+	}
+
+	type plain Image
+	return json.Unmarshal(data, (*plain)(image))
+}
+
+// URL returns the URL of an image.
+func (image Image) URL() string {
+	return StorageURL("post/" + image.Key)
+}
+
+// VariantURL returns the URL of a variant of an image.
+// Images without the variant are already smaller than it so the original is returned instead.
+func (image Image) VariantURL(name string) string {
+	for _, variant := range image.Variants {
+		if variant.Name == name {
+			return StorageURL("post/" + variant.Key)
+		}
+	}
+
+	return image.URL()
+}
+
+// SrcSet returns the srcset attribute of an image listing every variant and the original.
+func (image Image) SrcSet() string {
+	var sources []string
+	for _, variant := range image.Variants {
+		sources = append(sources, StorageURL("post/"+variant.Key)+" "+strconv.Itoa(variant.Width)+"w")
+	}
+
+	if image.Width == 0 {
+		// Images uploaded before variants don't know their width.
+		return strings.Join(sources, ", ")
+	}
+
+	return strings.Join(append(sources, image.URL()+" "+strconv.Itoa(image.Width)+"w"), ", ")
+}
+
 // Post is the struct for posts.
 type Post struct {
 	Owner                    User
 	UUID, Title, Description string
-	Images                   []string
+	Images                   []Image
 	Creation                 int64
-	Votes                    map[string]bool `json:"-"`
 	Upvotes, Downvotes       int
 	Rating                   float64
-	Vote                     int `json:"-"`
+	Vote                     int   `json:"-"`
+	Tags                     []Tag `json:",omitempty"`
 }
 
 // GetCreation is a template function used to return a human readable date from the creation unix timestamp.
@@ -79,24 +212,154 @@ func (post Post) GetCreation() string {
 	return time.Unix(post.Creation, 0).Format("Monday, 2 January 2006")
 }
 
+// ImageURL returns the URL of the post's first image.
+func (post Post) ImageURL() string {
+	if len(post.Images) == 0 {
+		return ""
+	}
+
+	return post.Images[0].URL()
+}
+
+// ThumbnailURL returns the URL of the thumbnail of the post's first image.
+func (post Post) ThumbnailURL() string {
+	if len(post.Images) == 0 {
+		return ""
+	}
+
+	return post.Images[0].VariantURL(VariantThumbnail)
+}
+
 // Score returns the overall score from votes of a post.
 func (post Post) Score() int {
 	return post.Upvotes - post.Downvotes
 }
 
-// GetRating gets the rating of a post.
+// GetRating gets the rating of a post using the configured ranker.
 func (post Post) GetRating() float64 {
-	order := math.Log10(math.Max(math.Abs(float64(post.Score())), float64(1)))
+	return Ranking.Rate(post)
+}
+
+// GetControversy gets how evenly split the votes of a post are, weighted by how many votes it has.
+// Posts with only upvotes or only downvotes aren't controversial at all.
+func (post Post) GetControversy() float64 {
+	if post.Upvotes <= 0 || post.Downvotes <= 0 {
+		return 0
+	}
+
+	magnitude := float64(post.Upvotes + post.Downvotes)
+	balance := float64(post.Downvotes) / float64(post.Upvotes)
+	if post.Upvotes < post.Downvotes {
+		balance = float64(post.Upvotes) / float64(post.Downvotes)
+	}
+
+	return math.Pow(magnitude, balance)
+}
 
-	var sign float64
-	if post.Score() > 0 {
-		sign = 1
-	} else if post.Score() < 0 {
-		sign = -1
+// Kinds of tags.
+const (
+	TagSpecies = "species"
+	TagBreed   = "breed"
+	TagLabel   = "label"
+)
+
+// Tag is a label of posts, such as the species or breed of the animal pictured.
+type Tag struct {
+	ID         int64 `json:"-"`
+	Name, Kind string
+	// AliasOf is the ID of the tag this is another name for, 0 if it isn't an alias.
+	AliasOf int64 `json:"-"`
+	// Posts is the number of posts with the tag.
+	Posts int `json:",omitempty"`
+}
+
+// TagName normalises a tag name to lower case words of letters and digits in any script joined by hyphens, returning an empty string if nothing is left.
+func TagName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	name = strings.Join(words, "-")
+	if runes := []rune(name); len(runes) > MaxTagLength {
+		name = strings.TrimRight(string(runes[:MaxTagLength]), "-")
 	}
 
-	seconds := post.Creation - 1550144333
-	return sign*order + float64(seconds/45000)
+	return name
+}
+
+// States of queued emails.
+const (
+	MailPending = "pending"
+	MailSent    = "sent"
+	MailDead    = "dead"
+)
+
+// Mail is an email queued to be sent.
+type Mail struct {
+	ID                      int64
+	To, Subject, HTML, Text string
+	State                   string
+	// Attempts is how many times sending it has failed.
+	Attempts int
+	// NextAttempt is when it should next be sent, as a unix timestamp.
+	NextAttempt int64
+	LastError   string
+	Creation    int64
+}
+
+// GetCreation is a template function used to return a human readable time from the creation unix timestamp.
+func (mail Mail) GetCreation() string {
+	return time.Unix(mail.Creation, 0).Format("2 Jan 2006 15:04:05")
+}
+
+// GetNextAttempt is a template function used to return a human readable time from the next attempt unix timestamp.
+func (mail Mail) GetNextAttempt() string {
+	return time.Unix(mail.NextAttempt, 0).Format("2 Jan 2006 15:04:05")
+}
+
+// Comment is a comment on a post, replies are nested under the comment they reply to.
+type Comment struct {
+	ID, ParentID       int64
+	PostUUID           string
+	Owner              User
+	Body               string
+	Creation, Edited   int64
+	Deleted            bool
+	Upvotes, Downvotes int
+	Vote               int       `json:"-"`
+	Replies            []Comment `json:",omitempty"`
+}
+
+// GetCreation is a template function used to return a human readable date from the creation unix timestamp.
+func (comment Comment) GetCreation() string {
+	return time.Unix(comment.Creation, 0).Format("Monday, 2 January 2006")
+}
+
+// Score returns the overall score from votes of a comment.
+func (comment Comment) Score() int {
+	return comment.Upvotes - comment.Downvotes
+}
+
+// Pagination is the position of a page in a list.
+type Pagination struct {
+	Page int
+	// More is whether there is a page after this one.
+	More bool
+}
+
+// Previous returns the number of the previous page.
+func (pagination Pagination) Previous() int {
+	return pagination.Page - 1
+}
+
+// Next returns the number of the next page.
+func (pagination Pagination) Next() int {
+	return pagination.Page + 1
+}
+
+// ValidPage returns if a page can have anything on it, pages before the first or after MaxPage are always empty.
+func ValidPage(page int) bool {
+	return page >= 0 && page <= MaxPage
 }
 
 // TemplateVariables is the struct used when executing a template.
@@ -107,6 +370,12 @@ type TemplateVariables struct {
 	LoggedIn   bool
 	Post       Post
 	Posts      []Post
+	Tag        Tag
+	Comments   []Comment
+	Pagination Pagination
+	// Sort is the ordering of the posts, such as hot or new, and Range the time range of top posts.
+	Sort, Range string
+	Stats       UserStats
 }
 
 // AJAXData is the struct used with the AJAX middleware.
@@ -135,5 +404,7 @@ type ResponseWithIDInt struct {
 
 // EmailTemplateVariables is the struct for template variables used when sending emails.
 type EmailTemplateVariables struct {
-	Code, Username string
+	Code, Username, BaseURL string
+	// Link is the URL the email asks the user to visit.
+	Link string
 }
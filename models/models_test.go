@@ -0,0 +1,29 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTagName(t *testing.T) {
+	cases := []struct {
+		name, want string
+	}{
+		{"Golden Retriever", "golden-retriever"},
+		{"  --cat!!  ", "cat"},
+		{"Chat Noir", "chat-noir"},
+		{"Fenêtre Éclair", "fenêtre-éclair"},
+		{"柴犬", "柴犬"},
+		{"Кот 2", "кот-2"},
+		{"!?", ""},
+		{strings.Repeat("é", MaxTagLength+5), strings.Repeat("é", MaxTagLength)},
+		// A word cut off at the limit doesn't leave a trailing hyphen.
+		{strings.Repeat("a", MaxTagLength-1) + " b", strings.Repeat("a", MaxTagLength-1)},
+	}
+
+	for _, c := range cases {
+		if got := TagName(c.name); got != c.want {
+			t.Errorf("%q: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
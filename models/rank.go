@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Names of the ranking algorithms.
+const (
+	RankerReddit  = "reddit"
+	RankerWilson  = "wilson"
+	RankerGravity = "gravity"
+)
+
+// ErrUnknownRanker is returned when a ranking algorithm doesn't exist.
+var ErrUnknownRanker = errors.New("unknown ranking algorithm")
+
+// Ranker rates posts for the hot posts, posts with higher ratings are hotter.
+type Ranker interface {
+	Rate(post Post) float64
+	// Decays returns whether ratings fall as posts age, so they must be recalculated regularly instead of only on votes.
+	Decays() bool
+}
+
+// Ranking is the ranker used to rate posts, it is replaced once the configuration is loaded.
+var Ranking Ranker = Reddit{}
+
+// NewRanker returns a ranker given its name, gravity is only used by the gravity ranker.
+func NewRanker(name string, gravity float64) (Ranker, error) {
+	switch name {
+	case RankerReddit:
+		return Reddit{}, nil
+	case RankerWilson:
+		return Wilson{}, nil
+	case RankerGravity:
+		return Gravity{Gravity: gravity}, nil
+	}
+
+	return nil, ErrUnknownRanker
+}
+
+// Reddit rates posts by the order of magnitude of their score plus their age, so every 12.5 hours is worth 10 times the votes.
+type Reddit struct{}
+
+// Rate returns the rating of a post.
+func (Reddit) Rate(post Post) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(post.Score())), float64(1)))
+
+	var sign float64
+	if post.Score() > 0 {
+		sign = 1
+	} else if post.Score() < 0 {
+		sign = -1
+	}
+
+	seconds := post.Creation - 1550144333
+	return sign*order + float64(seconds)/45000
+}
+
+// Decays returns false as newer posts are rated higher instead.
+func (Reddit) Decays() bool {
+	return false
+}
+
+// Wilson rates posts by the lower bound of the Wilson score interval of their upvotes, ignoring their age.
+// Posts with few votes are rated lower until it is more certain how many people like them.
+type Wilson struct{}
+
+// wilsonZ is the z-score of the 95% confidence interval.
+const wilsonZ = 1.96
+
+// Rate returns the rating of a post.
+func (Wilson) Rate(post Post) float64 {
+	n := float64(post.Upvotes + post.Downvotes)
+	if n == 0 {
+		return 0
+	}
+
+	p := float64(post.Upvotes) / n
+	return (p + wilsonZ*wilsonZ/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+wilsonZ*wilsonZ/(4*n))/n)) / (1 + wilsonZ*wilsonZ/n)
+}
+
+// Decays returns false as the age of posts isn't used.
+func (Wilson) Decays() bool {
+	return false
+}
+
+// Gravity rates posts by their score divided by their age in hours raised to the power of the gravity, like Hacker News.
+// Higher gravities make posts fall faster.
+type Gravity struct {
+	Gravity float64
+}
+
+// Rate returns the rating of a post.
+func (ranker Gravity) Rate(post Post) float64 {
+	hours := math.Max(float64(time.Now().Unix()-post.Creation)/3600, 0)
+	return float64(post.Score()-1) / math.Pow(hours+2, ranker.Gravity)
+}
+
+// Decays returns true as ratings fall as posts age.
+func (Gravity) Decays() bool {
+	return true
+}
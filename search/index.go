@@ -0,0 +1,222 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// Weights of a term appearing in each field of a post, matches in short fields say more about a post.
+const (
+	titleWeight       = 3
+	tagWeight         = 2
+	usernameWeight    = 2
+	descriptionWeight = 1
+)
+
+// document is an indexed post with the weighted frequency of every term in it.
+type document struct {
+	post  models.Post
+	terms map[string]float64
+}
+
+// Index is an in-memory inverted index of posts, users and tags, used when the database has no full-text search.
+type Index struct {
+	mutex sync.RWMutex
+	// documents are the indexed posts and postings lists the indices of the documents each term is in.
+	documents []document
+	postings  map[string][]int
+	users     []models.User
+	tags      []models.Tag
+}
+
+// NewIndex returns a new empty index.
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string][]int),
+	}
+}
+
+// tokens splits text into lower case words.
+func tokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Load replaces everything in the index, posts should have their tags.
+func (index *Index) Load(posts []models.Post, users []models.User, tags []models.Tag) {
+	documents := make([]document, len(posts))
+	postings := make(map[string][]int)
+
+	for i, post := range posts {
+		terms := make(map[string]float64)
+
+		add := func(text string, weight float64) {
+			for _, term := range tokens(text) {
+				terms[term] += weight
+			}
+		}
+
+		add(post.Title, titleWeight)
+		add(post.Description, descriptionWeight)
+		add(post.Owner.Username, usernameWeight)
+		for _, tag := range post.Tags {
+			add(tag.Name, tagWeight)
+		}
+
+		for term := range terms {
+			postings[term] = append(postings[term], i)
+		}
+
+		documents[i] = document{
+			post:  post,
+			terms: terms,
+		}
+	}
+
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	index.documents = documents
+	index.postings = postings
+	index.users = users
+	index.tags = tags
+}
+
+// matches returns if a post passes a query's filters.
+func (query Query) matches(post models.Post) bool {
+	return post.Creation >= query.Since &&
+		(query.MinScore == NoMinScore || post.Score() >= query.MinScore) &&
+		(query.Author == "" || strings.EqualFold(post.Owner.Username, query.Author))
+}
+
+// matchingTerms returns how many of the terms are words in the text.
+func matchingTerms(text string, terms []string) (matching int) {
+	words := tokens(text)
+	for _, term := range terms {
+		for _, word := range words {
+			if word == term {
+				matching++
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// Search returns the posts, users and tags matching a query.
+// Posts are scored by the weighted frequency of each term times how rare the term is (TF-IDF).
+func (index *Index) Search(query Query) (results Results, err error) {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	terms := tokens(query.Text)
+
+	type hit struct {
+		post      models.Post
+		relevance float64
+	}
+
+	var hits []hit
+	if len(terms) == 0 {
+		// Without any text every post is only filtered.
+		for _, document := range index.documents {
+			if query.matches(document.post) {
+				hits = append(hits, hit{post: document.post})
+			}
+		}
+	} else {
+		relevance := make(map[int]float64)
+		for _, term := range terms {
+			postings := index.postings[term]
+			if len(postings) == 0 {
+				continue
+			}
+
+			idf := math.Log(1 + float64(len(index.documents))/float64(len(postings)))
+			for _, i := range postings {
+				relevance[i] += index.documents[i].terms[term] * idf
+			}
+		}
+
+		for i, score := range relevance {
+			if post := index.documents[i].post; query.matches(post) {
+				hits = append(hits, hit{post: post, relevance: score})
+			}
+		}
+	}
+
+	byRelevance := query.Order == OrderRelevance && len(terms) != 0
+	sort.Slice(hits, func(i, j int) bool {
+		if byRelevance && hits[i].relevance != hits[j].relevance {
+			return hits[i].relevance > hits[j].relevance
+		}
+
+		if hits[i].post.Rating != hits[j].post.Rating {
+			return hits[i].post.Rating > hits[j].post.Rating
+		}
+
+		return hits[i].post.Creation > hits[j].post.Creation
+	})
+
+	// Pages after the last are empty, checked before multiplying so a huge page can't overflow.
+	start := len(hits)
+	if query.Page >= 0 && query.Page <= len(hits)/models.PostsPerPage {
+		start = query.Page * models.PostsPerPage
+	}
+
+	end := start + models.PostsPerPage
+	if end > len(hits) {
+		end = len(hits)
+	}
+
+	for _, hit := range hits[start:end] {
+		results.Posts = append(results.Posts, hit.post)
+	}
+
+	results.More = len(hits) > end
+
+	if len(terms) == 0 {
+		return
+	}
+
+	for _, user := range index.users {
+		if matchingTerms(user.Username, terms) > 0 {
+			results.Users = append(results.Users, user)
+		}
+	}
+
+	sort.Slice(results.Users, func(i, j int) bool {
+		return results.Users[i].Username < results.Users[j].Username
+	})
+
+	for _, tag := range index.tags {
+		if matchingTerms(tag.Name, terms) > 0 {
+			results.Tags = append(results.Tags, tag)
+		}
+	}
+
+	sort.Slice(results.Tags, func(i, j int) bool {
+		if results.Tags[i].Posts != results.Tags[j].Posts {
+			return results.Tags[i].Posts > results.Tags[j].Posts
+		}
+
+		return results.Tags[i].Name < results.Tags[j].Name
+	})
+
+	if len(results.Users) > Limit {
+		results.Users = results.Users[:Limit]
+	}
+
+	if len(results.Tags) > Limit {
+		results.Tags = results.Tags[:Limit]
+	}
+
+	return
+}
@@ -0,0 +1,141 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// uuids returns the UUIDs of posts in order.
+func uuids(posts []models.Post) (uuids []string) {
+	for _, post := range posts {
+		uuids = append(uuids, post.UUID)
+	}
+
+	return
+}
+
+// testPosts are indexed by the tests, from lowest to highest rating.
+var testPosts = []models.Post{
+	{UUID: "title", Title: "Sleepy cat", Owner: models.User{Username: "alice"}, Creation: 100, Upvotes: 5, Rating: 1},
+	{UUID: "description", Title: "Sofa", Description: "A cat on a sofa.", Owner: models.User{Username: "bob"}, Creation: 200, Upvotes: 1, Rating: 2},
+	{UUID: "tag", Title: "Garden", Owner: models.User{Username: "alice"}, Tags: []models.Tag{{Name: "cat"}}, Creation: 300, Downvotes: 2, Rating: 3},
+	{UUID: "rare", Title: "Fluffy", Owner: models.User{Username: "carol"}, Creation: 400, Rating: 4},
+	{UUID: "dog", Title: "Dog", Owner: models.User{Username: "Catherine"}, Creation: 500, Upvotes: 9, Rating: 5},
+}
+
+func TestIndexSearch(t *testing.T) {
+	index := NewIndex()
+	index.Load(testPosts, nil, nil)
+
+	cases := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		// A term in the title counts for more than in a tag, which counts for more than in the description.
+		{"relevance", Query{Text: "cat", MinScore: NoMinScore, Order: OrderRelevance}, []string{"title", "tag", "description"}},
+		// A rare term counts for more than a common one.
+		{"rare term", Query{Text: "fluffy cat", MinScore: NoMinScore, Order: OrderRelevance}, []string{"rare", "title", "tag", "description"}},
+		{"username", Query{Text: "catherine", MinScore: NoMinScore, Order: OrderRelevance}, []string{"dog"}},
+		{"rating", Query{Text: "cat", MinScore: NoMinScore, Order: OrderRating}, []string{"tag", "description", "title"}},
+		{"no text", Query{MinScore: NoMinScore, Order: OrderRelevance}, []string{"dog", "rare", "tag", "description", "title"}},
+		{"since", Query{Text: "cat", Since: 200, MinScore: NoMinScore, Order: OrderRelevance}, []string{"tag", "description"}},
+		{"min score", Query{Text: "cat", MinScore: 1, Order: OrderRelevance}, []string{"title", "description"}},
+		{"author", Query{Text: "cat", MinScore: NoMinScore, Author: "ALICE", Order: OrderRelevance}, []string{"title", "tag"}},
+		{"no match", Query{Text: "hamster", MinScore: NoMinScore, Order: OrderRelevance}, nil},
+	}
+
+	for _, c := range cases {
+		results, err := index.Search(c.query)
+		if err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+
+		if got := uuids(results.Posts); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: got posts %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestIndexPages(t *testing.T) {
+	var posts []models.Post
+	for i := 0; i < models.PostsPerPage*2+5; i++ {
+		posts = append(posts, models.Post{UUID: fmt.Sprint(i), Title: "Cat", Creation: int64(i)})
+	}
+
+	index := NewIndex()
+	index.Load(posts, nil, nil)
+
+	cases := []struct {
+		page  int
+		posts int
+		more  bool
+	}{
+		{0, models.PostsPerPage, true},
+		{1, models.PostsPerPage, true},
+		{2, 5, false},
+		{3, 0, false},
+		{-1, 0, false},
+		// Pages too large to multiply are past the end too.
+		{math.MaxInt64 / 2, 0, false},
+	}
+
+	for _, c := range cases {
+		results, err := index.Search(Query{Text: "cat", MinScore: NoMinScore, Order: OrderRelevance, Page: c.page})
+		if err != nil {
+			t.Fatalf("page %v: %v", c.page, err)
+		}
+
+		if len(results.Posts) != c.posts || results.More != c.more {
+			t.Errorf("page %v: got %v posts and more %v, want %v and %v", c.page, len(results.Posts), results.More, c.posts, c.more)
+		}
+	}
+
+	// The newest posts are first when they are as relevant and rated as each other.
+	if results, _ := index.Search(Query{Text: "cat", MinScore: NoMinScore, Order: OrderRelevance}); results.Posts[0].UUID != fmt.Sprint(len(posts)-1) {
+		t.Errorf("first post is %v, want the newest", results.Posts[0].UUID)
+	}
+}
+
+func TestIndexUsersAndTags(t *testing.T) {
+	var users []models.User
+	for i := 0; i < Limit+2; i++ {
+		users = append(users, models.User{Username: fmt.Sprintf("cat-%02d", Limit+2-i)})
+	}
+
+	users = append(users, models.User{Username: "dog"})
+
+	tags := []models.Tag{{Name: "cat", Posts: 1}, {Name: "cat-toy", Posts: 3}, {Name: "big-cat", Posts: 3}, {Name: "dog", Posts: 9}}
+
+	index := NewIndex()
+	index.Load(nil, users, tags)
+
+	results, err := index.Search(Query{Text: "cat", MinScore: NoMinScore, Order: OrderRelevance})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Users are sorted by username and limited.
+	if len(results.Users) != Limit || results.Users[0].Username != "cat-01" || results.Users[Limit-1].Username != fmt.Sprintf("cat-%02d", Limit) {
+		t.Errorf("got users %+v, want the first %v cats by username", results.Users, Limit)
+	}
+
+	// Tags are sorted by their posts and then their name.
+	var names []string
+	for _, tag := range results.Tags {
+		names = append(names, tag.Name)
+	}
+
+	if want := []string{"big-cat", "cat-toy", "cat"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got tags %q, want %q", names, want)
+	}
+
+	// Users and tags only match text.
+	if results, _ := index.Search(Query{MinScore: NoMinScore, Order: OrderRelevance}); len(results.Users) != 0 || len(results.Tags) != 0 {
+		t.Errorf("searching without text found users %+v and tags %+v", results.Users, results.Tags)
+	}
+}
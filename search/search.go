@@ -0,0 +1,57 @@
+package search
+
+import (
+	"math"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// Orders results can be sorted in.
+const (
+	// OrderRelevance sorts posts by how well they match the query.
+	OrderRelevance = "relevance"
+	// OrderRating sorts posts by their hot rating.
+	OrderRating = "rating"
+)
+
+// NoMinScore is the minimum score of a query which doesn't filter by score.
+const NoMinScore = math.MinInt32
+
+// Limit is the most users or tags returned alongside the posts.
+const Limit = 10
+
+// Ranges are the time ranges posts can be filtered to, keyed by their query parameter.
+var Ranges = map[string]time.Duration{
+	"day":   time.Hour * 24,
+	"week":  time.Hour * 24 * 7,
+	"month": time.Hour * 24 * 30,
+	"year":  time.Hour * 24 * 365,
+}
+
+// Query is a search and its filters.
+type Query struct {
+	Text string
+	// Since is the unix time posts must be made after, 0 doesn't filter.
+	Since int64
+	// MinScore is the lowest score posts can have, NoMinScore doesn't filter.
+	MinScore int
+	// Author is the username posts must be made by, empty doesn't filter.
+	Author string
+	Order  string
+	Page   int
+}
+
+// Results are what matched a query, users and tags only match its text.
+type Results struct {
+	Posts []models.Post
+	Users []models.User `json:",omitempty"`
+	Tags  []models.Tag  `json:",omitempty"`
+	// More is whether there is another page of posts.
+	More bool
+}
+
+// Searcher searches posts, users and tags.
+type Searcher interface {
+	Search(query Query) (Results, error)
+}
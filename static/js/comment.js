@@ -0,0 +1,156 @@
+// sendComment sends a comment request secured with reCAPTCHA v3, asking for reCAPTCHA v2 if we aren't trusted.
+var sendComment = function(method, url, data, action, title, success) {
+    var send = function(captcha, captchaV2) {
+        $.ajax({
+            url: url,
+            type: method,
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify($.extend({}, data, {
+                Captcha: captcha,
+                CaptchaV2: captchaV2
+            })),
+            statusCode: {
+                200: function(rRaw) { // OK.
+                    success(JSON.parse(rRaw));
+                },
+                400: function() { // Bad Request (we aren't trusted; fill in reCAPTCHA v2).
+                    if (captchaV2 !== "") {
+                        toastr["error"]("You failed the reCAPTCHA.", title);
+                        return;
+                    }
+
+                    retry = function(token) {
+                        send("", token);
+                    };
+
+                    toastr["warning"]("Our system suspects you of being a bot, please complete the reCAPTCHA.", "Anti-Bot Verification");
+                    $("#recaptcha-modal").modal("show");
+                },
+                403: function() { // Forbidden (not our comment).
+                    toastr["error"]("You can only change your own comments.", title);
+                },
+                410: function() { // Gone (post or comment deleted).
+                    toastr["error"]("This has been deleted.", title);
+                },
+                422: function() { // Unprocessable entity (empty or too long comment).
+                    toastr["error"]("Comments must be between 1 and 10000 characters.", title);
+                },
+                500: function() { // Internal server error.
+                    toastr["error"]("Internal server error.", title);
+                }
+            }
+        });
+    };
+
+    grecaptcha.execute("6Lfyi5AUAAAAAJhGIO45QyuAD7L_yqIq5s0Kc6NN", {action: action}).then(function(token) {
+        send(token, "");
+    });
+};
+
+var commentURL = function(comment) {
+    return window.location.pathname + "/comments/" + comment.data("id");
+};
+
+var requireLogin = function() {
+    if (!LoggedIn) {
+        window.location.replace(window.location.origin + "/login/?redirect=" + window.location.pathname);
+    }
+
+    return LoggedIn;
+};
+
+var voteComment = function(comment, upvote) {
+    if (!requireLogin()) {
+        return;
+    }
+
+    sendComment("POST", commentURL(comment) + "/vote", {Upvote: upvote}, "vote", "Vote Failed", function(r) {
+        // Voting the same way twice removes the vote.
+        var status = upvote ? 1 : 2;
+        if (comment.data("vote") === status) {
+            status = 0;
+        }
+
+        comment.data("vote", status);
+        comment.find("> .comment-actions .comment-upvote").toggleClass("current-vote", status === 1);
+        comment.find("> .comment-actions .comment-downvote").toggleClass("current-vote", status === 2);
+        comment.find("> .comment-meta .comment-score").text(r.Score);
+    });
+};
+
+$(document).ready(function(){
+    // Owners can edit and delete their comments, moderators can delete any comment.
+    $(".comment").each(function() {
+        if (LoggedIn && ($(this).attr("data-owner") === SelfUUID || SelfPrivilege >= 2)) {
+            $(this).find("> .comment-actions .comment-owner-actions").prop("hidden", false);
+        }
+
+        if ($(this).attr("data-owner") !== SelfUUID) {
+            $(this).find("> .comment-actions .comment-edit").remove();
+        }
+    });
+
+    $(document).on("submit", ".comment-form", function(event) {
+        event.preventDefault();
+
+        var form = $(this);
+        sendComment("POST", window.location.pathname + "/comments", {
+            Body: form.find(".comment-input").val(),
+            ParentID: form.data("parent")
+        }, "comment", "Comment Failed", function() {
+            window.location.reload();
+        });
+    });
+
+    $(document).on("click", ".comment-upvote", function() {
+        voteComment($(this).closest(".comment"), true);
+    });
+
+    $(document).on("click", ".comment-downvote", function() {
+        voteComment($(this).closest(".comment"), false);
+    });
+
+    $(document).on("click", ".comment-reply", function() {
+        if (!requireLogin()) {
+            return;
+        }
+
+        var comment = $(this).closest(".comment");
+        if (comment.find("> .comment-form").length > 0) {
+            return;
+        }
+
+        var form = $(".comment-form").first().clone();
+        form.attr("data-parent", comment.data("id"));
+        form.find(".comment-input").val("").attr("placeholder", "Write a reply...");
+        form.find("button").text("Reply");
+        form.insertAfter(comment.find("> .comment-actions"));
+    });
+
+    $(document).on("click", ".comment-edit", function() {
+        var comment = $(this).closest(".comment");
+        var body = comment.find("> .comment-body");
+
+        var text = window.prompt("Edit your comment:", body.text());
+        if (text === null) {
+            return;
+        }
+
+        sendComment("PUT", commentURL(comment), {Body: text}, "comment_edit", "Edit Failed", function() {
+            body.text(text.trim());
+        });
+    });
+
+    $(document).on("click", ".comment-delete", function() {
+        var comment = $(this).closest(".comment");
+
+        if (!window.confirm("Are you sure you want to delete this comment?")) {
+            return;
+        }
+
+        sendComment("DELETE", commentURL(comment), {}, "comment_delete", "Delete Failed", function() {
+            comment.find("> .comment-meta").text("[deleted]").addClass("text-muted");
+            comment.find("> .comment-body, > .comment-actions").remove();
+        });
+    });
+});
@@ -18,6 +18,9 @@ var recaptchaCallback = function() {
             400: function() { // Bad request (failed recaptcha).
                 toastr["error"]("You have failed the reCAPTCHA, please try again.", "Email Send Failed");
             },
+            429: function() { // Too many requests.
+                toastr["error"]("Too many attempts, please try again later.", "Email Send Failed");
+            },
             500: function() { // Internal server error.
                 toastr["error"]("Internal server error.", "Email Send Failed");
             }
@@ -52,6 +55,9 @@ $(document).ready(function(){
                         toastr["warning"]("Our system suspects you of being a bot, please complete the reCAPTCHA.", "Anti-Bot Verification");
                         $("#recaptcha-modal").modal("show");
                     },
+                    429: function() { // Too many requests.
+                        toastr["error"]("Too many attempts, please try again later.", "Email Send Failed");
+                    },
                     500: function() { // Internal server error.
                         toastr["error"]("Internal server error.", "Email Send Failed");
                     }
@@ -0,0 +1,66 @@
+// loading is whether the next page of posts is being loaded.
+var loading = false;
+
+// postElement returns the paragraph showing a post in the feed.
+var postElement = function(post) {
+    var element = $("<p>");
+    var link = "/post/" + encodeURIComponent(post.UUID);
+
+    if (post.ThumbnailURL) {
+        element.append($("<a>").attr("href", link).append($("<img>").addClass("thumbnail").attr("src", post.ThumbnailURL).attr("alt", post.Title)), " ");
+    }
+
+    element.append("Score: " + post.Score + " - ", $("<a>").attr("href", link).text(post.Title));
+    element.append(document.createTextNode(" - " + post.Description + " - by "));
+    element.append($("<a>").attr("href", "/user/" + encodeURIComponent(post.Owner.UUID)).text(post.Owner.Username));
+
+    return element;
+};
+
+// loadMore appends the next page of posts to the feed.
+var loadMore = function() {
+    if (loading || NextPage === 0) {
+        return;
+    }
+
+    loading = true;
+
+    $.ajax({
+        url: FeedURL + NextPage,
+        type: "GET",
+        statusCode: {
+            200: function(rRaw) { // OK.
+                var r = JSON.parse(rRaw);
+
+                for (var i = 0; i < r.Posts.length; i++) {
+                    $("#posts").append(postElement(r.Posts[i]));
+                }
+
+                NextPage = r.More ? NextPage + 1 : 0;
+                loading = false;
+
+                // Keep loading if the feed still doesn't reach the bottom of the window.
+                $(window).scroll();
+            },
+            500: function() { // Internal server error.
+                toastr["error"]("Internal server error.", "Loading Posts Failed");
+            }
+        }
+    });
+};
+
+$(document).ready(function(){
+    toastr.options.progressBar = true;
+
+    // Posts are loaded while scrolling instead of following the next page link.
+    $("#next-page").remove();
+
+    $(window).scroll(function() {
+        if ($(window).scrollTop() + $(window).height() > $(document).height() - 200) {
+            loadMore();
+        }
+    });
+
+    // Load more straight away if the page is too short to scroll.
+    $(window).scroll();
+});
@@ -1,7 +1,52 @@
+// resending is set when the v2 reCAPTCHA was asked for by resending a verification email rather than logging in.
+var resending = false;
+
+// resendVerification asks for another verification email to be sent to the email address entered.
+var resendVerification = function(captcha, captchaV2) {
+    $.ajax({
+        url: "/verify/resend",
+        type: "POST",
+        contentType: "application/json; charset=utf-8",
+        data: JSON.stringify({
+            Email: $("#email").val(),
+            Captcha: captcha,
+            CaptchaV2: captchaV2
+        }),
+        dataType: "json",
+        statusCode: {
+            200: function(data) { // OK (we may have sent an email).
+                toastr["success"]("If that account hasn't been verified and we haven't sent it a verification email in the last " + data.Hours + " hours, we have sent an email to it.");
+            },
+            400: function() { // Bad Request (we aren't trusted; fill in reCAPTCHA v2).
+                if (captchaV2 !== "") {
+                    toastr["error"]("You have failed the reCAPTCHA, please try again.", "Email Send Failed");
+                    return;
+                }
+
+                resending = true;
+                toastr["warning"]("Our system suspects you of being a bot, please complete the reCAPTCHA.", "Anti-Bot Verification");
+                $("#recaptcha-modal").modal("show");
+            },
+            500: function() { // Internal server error.
+                toastr["error"]("Internal server error.", "Email Send Failed");
+            }
+        }
+    });
+};
+
 var recaptchaCallback = function() {
     // User has completed v2 reCAPTCHA to prove they're not a robot.
     toastr["info"]("reCAPTCHA completed, trying again.");
 
+    if (resending) {
+        resending = false;
+        resendVerification("", grecaptcha.getResponse());
+
+        $("#recaptcha-modal").modal("hide");
+        grecaptcha.reset(); // Reset the reCAPTCHA.
+        return;
+    }
+
     $.ajax({
         url: "/login",
         type: "POST",
@@ -29,7 +74,8 @@ var recaptchaCallback = function() {
                 toastr["error"]("Invalid login credentials.", "Login Failed");
             },
             403: function() { // Forbidden (email not verified).
-                toastr["error"]("You haven't verified your email yet, please check your inbox (even spam folder) to complete the registration process.", "Login Failed");
+                toastr["error"]("You haven't verified your email yet, please check your inbox (even spam folder) to complete the registration process or send another verification email.", "Login Failed");
+                $("#resend-button").show();
             },
             500: function() { // Internal server error.
                 toastr["error"]("Internal server error.", "Login Failed");
@@ -55,15 +101,32 @@ $(document).ready(function(){
             toastr["info"]("Successfully verified email, you may now log in.");
             break;
         case "2":
-            // User has clicked on the verify link but was already verified previously.
-            toastr["warning"]("You were already verified before attempting to verify again.");
+            // User has clicked on a verify link which is wrong, has expired or was already used.
+            toastr["warning"]("That verification link is invalid, has expired or has already been used.");
             break;
         case "3":
             // User has just reset their password.
             toastr["info"]("Successfully reset password, you may now log in.");
             break;
+        case "4":
+            // User has clicked on the link to change their email but the address was taken since.
+            toastr["error"]("Another account has started using that email, your email hasn't been changed.");
+            break;
+        case "5":
+            // User has tried too many wrong verification links.
+            toastr["error"]("Too many verification attempts, please try again later.");
+            break;
     }
 
+    $("#resend-button").click(function(event){
+        event.preventDefault();
+        toastr["info"]("Sending verification email.");
+
+        grecaptcha.execute("6Lfyi5AUAAAAAJhGIO45QyuAD7L_yqIq5s0Kc6NN", {action: "resend_verification"}).then(function(token) {
+            resendVerification(token, "");
+        });
+    });
+
     $("#login-button").click(function(){
         toastr["info"]("Logging in.");
 
@@ -96,7 +159,8 @@ $(document).ready(function(){
                         toastr["error"]("Invalid login credentials.", "Login Failed");
                     },
                     403: function() { // Forbidden (email not verified).
-                        toastr["error"]("You haven't verified your email yet, please check your inbox (even spam folder) to complete the registration process.", "Login Failed");
+                        toastr["error"]("You haven't verified your email yet, please check your inbox (even spam folder) to complete the registration process or send another verification email.", "Login Failed");
+                        $("#resend-button").show();
                     },
                     500: function() { // Internal server error.
                         toastr["error"]("Internal server error.", "Login Failed");
@@ -19,6 +19,12 @@ var recaptchaCallback = function() {
             400: function() { // Bad request (failed recaptcha).
                 toastr["error"]("You have failed the reCAPTCHA, please try again.", "Password Recovery Failed");
             },
+            410: function() { // Gone (the code is wrong, has expired or has already been used).
+                toastr["error"]("This recovery link is invalid or has expired, please request a new one.", "Password Recovery Failed");
+            },
+            429: function() { // Too many requests.
+                toastr["error"]("Too many attempts, please try again later.", "Password Recovery Failed");
+            },
             500: function() { // Internal server error.
                 toastr["error"]("Internal server error.", "Password Recovery Failed");
             }
@@ -59,6 +65,12 @@ $(document).ready(function(){
                         toastr["warning"]("Our system suspects you of being a bot, please complete the reCAPTCHA.", "Anti-Bot Verification");
                         $("#recaptcha-modal").modal("show");
                     },
+                    410: function() { // Gone (the code is wrong, has expired or has already been used).
+                        toastr["error"]("This recovery link is invalid or has expired, please request a new one.", "Password Recovery Failed");
+                    },
+                    429: function() { // Too many requests.
+                        toastr["error"]("Too many attempts, please try again later.", "Password Recovery Failed");
+                    },
                     500: function() { // Internal server error.
                         toastr["error"]("Internal server error.", "Password Recovery Failed");
                     }
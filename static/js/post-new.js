@@ -25,10 +25,16 @@ var recaptchaCallback = function() {
                 $("#recaptcha-modal").modal("show");
             },
             413: function() { // Request entity too large (the image we attempted to upload was rejected for being too big).
-                toastr["error"]("You can not upload an image over 5MB.", "Post Creation Failed");
+                toastr["error"]("An image you have selected is too large.", "Post Creation Failed");
             },
-            415: function() { // Request entity too large (the image we attempted to upload was rejected for being too big).
-                toastr["error"]("The file you have selected is not an image.", "Post Creation Failed");
+            422: function() { // Unprocessable entity (no images, too many images or tags, or an image is too big in pixels).
+                toastr["error"]("You have selected too many images or tags, or an image is too big in pixels.", "Post Creation Failed");
+            },
+            409: function(xhr) { // Conflict (an image looks like one which has already been posted).
+                duplicateCallback(JSON.parse(xhr.responseText));
+            },
+            415: function() { // Unsupported media type (a file we attempted to upload is not an image we support).
+                toastr["error"]("A file you have selected is not a supported image.", "Post Creation Failed");
             },
             500: function() { // Internal server error.
                 toastr["error"]("Internal server error.", "Post Creation Failed");
@@ -40,19 +46,75 @@ var recaptchaCallback = function() {
     grecaptcha.reset(); // Reset the reCAPTCHA.
 };
 
+var duplicateCallback = function(r) {
+    var links = $.map(r.Duplicates, function(uuid) {
+        return "<a href=\"/post/" + uuid + "\">" + uuid + "</a>";
+    }).join(", ");
+
+    if (r.Rejected) {
+        toastr["error"]("An image you have selected has already been posted: " + links + ".", "Post Creation Failed");
+        return;
+    }
+
+    // Let them post it anyway if they confirm it isn't a repost.
+    toastr["warning"]("An image you have selected looks like one already posted: " + links + ". <a id=\"duplicate-confirm\" href=\"javascript:void(0);\">Post anyway</a>", "Possible Repost");
+    $("#duplicate-confirm").click(function() {
+        $("#duplicate").val("confirm");
+        $("#submit-button").click();
+    });
+};
+
 $(document).ready(function(){
     toastr.options.progressBar = true;
 
+    // Suggest existing tags for the tag being typed (the last one in a comma separated list).
+    $(".tag-input").on("input", function() {
+        var input = $(this);
+        var values = input.val().split(",");
+        var current = values.pop().trim();
+
+        if (current === "") {
+            return;
+        }
+
+        $.getJSON("/tags", {q: current}, function(tags) {
+            var suggestions = $("#tag-suggestions");
+            suggestions.empty();
+
+            $.each(tags, function(i, tag) {
+                var value = values.concat([tag.Name]).join(", ");
+                suggestions.append($("<option>").attr("value", value).text(tag.Kind));
+            });
+        });
+    });
+
     $("#image-button").click(function(event){
         event.preventDefault();
         $("#image").trigger("click");
     });
 
+    $("#image").change(function(){
+        // Add a caption and alt text input for every image in the order they will be uploaded.
+        var details = $("#image-details");
+        details.empty();
+
+        // New images haven't been confirmed as not being reposts.
+        $("#duplicate").val("");
+
+        $.each(this.files, function(i, file) {
+            var group = $("<div class=\"form-group\"></div>");
+            group.append($("<label></label>").text((i + 1) + ". " + file.name));
+            group.append($("<input class=\"form-control\" name=\"caption\" placeholder=\"Caption (optional)\">"));
+            group.append($("<input class=\"form-control\" name=\"alt\" placeholder=\"Description for screen readers (optional)\">"));
+            details.append(group);
+        });
+    });
+
     $("#submit-button").click(function(event){
         event.preventDefault();
 
         if (typeof $("#image")[0].files[0] === "undefined") {
-            toastr["error"]("You need to select an image...");
+            toastr["error"]("You need to select at least one image...");
             return;
         }
 
@@ -81,10 +143,16 @@ $(document).ready(function(){
                         $("#recaptcha-modal").modal("show");
                     },
                     413: function() { // Request entity too large (the image we attempted to upload was rejected for being too big).
-                        toastr["error"]("You can not upload an image over 5MB.", "Post Creation Failed");
+                        toastr["error"]("An image you have selected is too large.", "Post Creation Failed");
+                    },
+                    422: function() { // Unprocessable entity (no images, too many images or tags, or an image is too big in pixels).
+                        toastr["error"]("You have selected too many images or tags, or an image is too big in pixels.", "Post Creation Failed");
+                    },
+                    409: function(xhr) { // Conflict (an image looks like one which has already been posted).
+                        duplicateCallback(JSON.parse(xhr.responseText));
                     },
-                    415: function() { // Request entity too large (the image we attempted to upload was rejected for being too big).
-                        toastr["error"]("The file you have selected is not an image.", "Post Creation Failed");
+                    415: function() { // Unsupported media type (a file we attempted to upload is not an image we support).
+                        toastr["error"]("A file you have selected is not a supported image.", "Post Creation Failed");
                     },
                     500: function() { // Internal server error.
                         toastr["error"]("Internal server error.", "Post Creation Failed");
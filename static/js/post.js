@@ -1,10 +1,19 @@
 var vote = false;
 
+// retry is set to resend a request other than a vote once the v2 reCAPTCHA has been completed.
+var retry = null;
+
 var recaptchaCallback = function() {
     // User has completed v2 reCAPTCHA to prove they're not a robot.
     toastr["info"]("reCAPTCHA completed, trying again.");
 
-    sendVote(vote, true)
+    if (retry !== null) {
+        var request = retry;
+        retry = null;
+        request(grecaptcha.getResponse());
+    } else {
+        sendVote(vote, true)
+    }
 
     $("#recaptcha-modal").modal("hide");
     grecaptcha.reset(); // Reset the reCAPTCHA.
@@ -0,0 +1,171 @@
+// retry is set to resend the last request once the v2 reCAPTCHA has been completed.
+var retry = null;
+
+var recaptchaCallback = function() {
+    // User has completed v2 reCAPTCHA to prove they're not a robot.
+    toastr["info"]("reCAPTCHA completed, trying again.");
+
+    if (retry !== null) {
+        var request = retry;
+        retry = null;
+        request(grecaptcha.getResponse());
+    }
+
+    $("#recaptcha-modal").modal("hide");
+    grecaptcha.reset(); // Reset the reCAPTCHA.
+};
+
+// sendSettings sends a settings request secured with reCAPTCHA v3, asking for reCAPTCHA v2 if we aren't trusted.
+// Data is either an object sent as JSON or a FormData sent as a multipart form.
+var sendSettings = function(url, data, action, title, statusCodes, success) {
+    var send = function(captcha, captchaV2) {
+        var request = {
+            url: url,
+            type: "POST",
+            statusCode: $.extend({
+                200: function(rRaw) { // OK.
+                    success(rRaw);
+                },
+                400: function() { // Bad Request (we aren't trusted; fill in reCAPTCHA v2).
+                    if (captchaV2 !== "") {
+                        toastr["error"]("You failed the reCAPTCHA.", title);
+                        return;
+                    }
+
+                    retry = function(token) {
+                        send("", token);
+                    };
+
+                    toastr["warning"]("Our system suspects you of being a bot, please complete the reCAPTCHA.", "Anti-Bot Verification");
+                    $("#recaptcha-modal").modal("show");
+                },
+                401: function() { // Unauthorized (wrong current password).
+                    toastr["error"]("Your current password is wrong.", title);
+                },
+                500: function() { // Internal server error.
+                    toastr["error"]("Internal server error.", title);
+                }
+            }, statusCodes)
+        };
+
+        if (data instanceof FormData) {
+            var formData = new FormData();
+            data.forEach(function(value, key) {
+                formData.append(key, value);
+            });
+
+            formData.append("captcha", captcha);
+            formData.append("captchaV2", captchaV2);
+
+            $.extend(request, {
+                data: formData,
+                cache: false,
+                contentType: false,
+                processData: false
+            });
+        } else {
+            $.extend(request, {
+                contentType: "application/json; charset=utf-8",
+                data: JSON.stringify($.extend({}, data, {
+                    Captcha: captcha,
+                    CaptchaV2: captchaV2
+                }))
+            });
+        }
+
+        $.ajax(request);
+    };
+
+    grecaptcha.execute("6Lfyi5AUAAAAAJhGIO45QyuAD7L_yqIq5s0Kc6NN", {action: action}).then(function(token) {
+        send(token, "");
+    });
+};
+
+$(document).ready(function(){
+    toastr.options.progressBar = true;
+
+    $("#profile-button").click(function(event){
+        event.preventDefault();
+
+        sendSettings("/settings/profile", {
+            Username: $("#username").val(),
+            Fname: $("#fname").val(),
+            Lname: $("#lname").val(),
+            Description: $("#description").val()
+        }, "edit_profile", "Saving Profile Failed", {
+            422: function() { // Unprocessable entity (empty username or a field is too long).
+                toastr["error"]("You need a username and your names must be at most 64 characters and your bio at most 1000.", "Saving Profile Failed");
+            }
+        }, function() {
+            toastr["success"]("Saved your profile.");
+        });
+    });
+
+    $("#picture-button").click(function(event){
+        event.preventDefault();
+        $("#picture").trigger("click");
+    });
+
+    $("#picture").change(function(){
+        if (typeof this.files[0] === "undefined") {
+            return;
+        }
+
+        toastr["info"]("Uploading profile picture.");
+
+        sendSettings("/settings/picture", new FormData($("#picture-form")[0]), "edit_picture", "Uploading Picture Failed", {
+            413: function() { // Request entity too large (the picture was rejected for being too big).
+                toastr["error"]("The picture you have selected is too large.", "Uploading Picture Failed");
+            },
+            415: function() { // Unsupported media type (the file is not an image we support).
+                toastr["error"]("The file you have selected is not a supported image.", "Uploading Picture Failed");
+            },
+            422: function() { // Unprocessable entity (the picture is too big in pixels).
+                toastr["error"]("The picture you have selected is too big in pixels.", "Uploading Picture Failed");
+            }
+        }, function(rRaw) {
+            var r = JSON.parse(rRaw);
+
+            // Add the time so the browser doesn't show a cached old picture at the same URL.
+            $("#picture-preview").attr("src", r.ProfilePicture + "?" + Date.now()).prop("hidden", false);
+            toastr["success"]("Uploaded your profile picture.");
+        });
+    });
+
+    $("#email-button").click(function(event){
+        event.preventDefault();
+
+        sendSettings("/settings/email", {
+            Email: $("#email").val(),
+            Password: $("#email-password").val()
+        }, "edit_email", "Changing Email Failed", {
+            406: function() { // Not acceptable (invalid email).
+                toastr["error"]("That email is invalid.", "Changing Email Failed");
+            },
+            409: function() { // Conflict (email already used).
+                toastr["error"]("Another account already uses that email.", "Changing Email Failed");
+            },
+            429: function() { // Too many requests.
+                toastr["error"]("Too many attempts, please try again later.", "Changing Email Failed");
+            }
+        }, function() {
+            toastr["info"]("Please check your new email's inbox (even spam folder) to finish changing your email.");
+        });
+    });
+
+    $("#password-button").click(function(event){
+        event.preventDefault();
+
+        sendSettings("/settings/password", {
+            Password: $("#password").val(),
+            NewPassword: $("#new-password").val()
+        }, "edit_password", "Changing Password Failed", {
+            422: function() { // Unprocessable entity (empty new password).
+                toastr["error"]("You need to enter a new password.", "Changing Password Failed");
+            }
+        }, function() {
+            $("#password, #new-password").val("");
+            toastr["success"]("Changed your password, you have been logged out everywhere else.");
+        });
+    });
+});
@@ -0,0 +1,57 @@
+// sendMerge sends a moderator's merge request secured with reCAPTCHA v3.
+var sendMerge = function(url, tag, success) {
+    grecaptcha.execute("6Lfyi5AUAAAAAJhGIO45QyuAD7L_yqIq5s0Kc6NN", {action: "tag_merge"}).then(function(token) {
+        $.ajax({
+            url: url,
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            data: JSON.stringify({
+                Tag: tag,
+                Captcha: token
+            }),
+            statusCode: {
+                200: success,
+                400: function() { // Bad Request (we aren't trusted).
+                    toastr["error"]("You failed the reCAPTCHA.", "Merge Failed");
+                },
+                403: function() { // Forbidden (not a moderator).
+                    toastr["error"]("Only moderators can merge tags.", "Merge Failed");
+                },
+                404: function() { // Not found (the tag to merge into doesn't exist).
+                    toastr["error"]("That tag doesn't exist.", "Merge Failed");
+                },
+                409: function() { // Conflict (the tags are already the same).
+                    toastr["error"]("Those tags are already the same tag.", "Merge Failed");
+                },
+                422: function() { // Unprocessable entity (invalid tag name).
+                    toastr["error"]("That isn't a valid tag name.", "Merge Failed");
+                },
+                500: function() { // Internal server error.
+                    toastr["error"]("Internal server error.", "Merge Failed");
+                }
+            }
+        });
+    });
+};
+
+$(document).ready(function(){
+    toastr.options.progressBar = true;
+
+    $("#merge-form").submit(function(event) {
+        event.preventDefault();
+
+        var into = $("#merge-tag").val();
+        sendMerge("/tag/" + TagName + "/merge", into, function() {
+            window.location.replace(window.location.origin + "/tag/" + encodeURIComponent(into));
+        });
+    });
+
+    $("#alias-form").submit(function(event) {
+        event.preventDefault();
+
+        sendMerge("/tag/" + TagName + "/aliases", $("#alias-tag").val(), function() {
+            toastr["success"]("The alias has been added.");
+            $("#alias-tag").val("");
+        });
+    });
+});
@@ -0,0 +1,55 @@
+package upload
+
+import (
+	"image"
+	"io/ioutil"
+
+	"golang.org/x/image/draw"
+)
+
+// Hash returns the difference hash (dHash) of an image.
+// Every bit is whether a pixel is darker than the one to its right in a 9x8 greyscale copy of the image,
+// so similar looking images have hashes which differ by few bits.
+func Hash(img image.Image) (hash uint64) {
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y < small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+
+	return
+}
+
+// HashStored returns the hash of an image of a post already in storage.
+// Images uploaded before they were sanitized still have their EXIF orientation, so they are turned upright first like new uploads.
+func HashStored(key string) (hash uint64, err error) {
+	body, err := Store.Get("post/" + key)
+	if err != nil {
+		return
+	}
+
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return
+	}
+
+	decoding <- struct{}{}
+	defer func() {
+		<-decoding
+	}()
+
+	decoded, _, err := decodeUpright(data)
+	if err != nil {
+		return
+	}
+
+	return Hash(decoded), nil
+}
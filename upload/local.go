@@ -0,0 +1,90 @@
+package upload
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores uploads in a directory on the local filesystem.
+type Local struct {
+	root, prefix string
+}
+
+// NewLocal creates a new local storage backend rooted at a directory and served from a URL prefix.
+func NewLocal(root, prefix string) (store *Local, err error) {
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		return
+	}
+
+	store = &Local{
+		root:   root,
+		prefix: prefix,
+	}
+	return
+}
+
+// path converts a key into a path inside of the root directory.
+func (store *Local) path(key string) string {
+	// Cleaning the key as an absolute path stops it from escaping the root.
+	return filepath.Join(store.root, filepath.FromSlash(filepath.Clean("/"+key)))
+}
+
+// Put writes a file to disk.
+func (store *Local) Put(key, contentType string, body io.Reader) (err error) {
+	path := store.path(key)
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	_, err = io.Copy(file, body)
+	return
+}
+
+// Get opens a file on disk.
+func (store *Local) Get(key string) (body io.ReadCloser, err error) {
+	body, err = os.Open(store.path(key))
+	if os.IsNotExist(err) {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+// Delete removes a file from disk.
+func (store *Local) Delete(key string) (err error) {
+	err = os.Remove(store.path(key))
+	if os.IsNotExist(err) {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+// URL returns the URL the router serves a file from.
+func (store *Local) URL(key string) string {
+	return store.prefix + key
+}
+
+// ServeHTTP serves the uploads directory, it should be mounted on the prefix.
+func (store *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/") {
+		// Don't list the contents of directories.
+		http.NotFound(w, r)
+		return
+	}
+
+	http.StripPrefix(store.prefix, http.FileServer(http.Dir(store.root))).ServeHTTP(w, r)
+}
@@ -0,0 +1,100 @@
+package upload
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryFile struct {
+	contentType string
+	data        []byte
+	modified    time.Time
+}
+
+// Memory stores uploads in memory, it is intended for development and tests.
+type Memory struct {
+	prefix string
+	mutex  sync.RWMutex
+	files  map[string]memoryFile
+}
+
+// NewMemory creates a new empty in-memory storage backend served from a URL prefix.
+func NewMemory(prefix string) *Memory {
+	return &Memory{
+		prefix: prefix,
+		files:  make(map[string]memoryFile),
+	}
+}
+
+// Put stores a file in memory.
+func (store *Memory) Put(key, contentType string, body io.Reader) (err error) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.files[key] = memoryFile{
+		contentType: contentType,
+		data:        data,
+		modified:    time.Now(),
+	}
+	return
+}
+
+// Get returns a file from memory.
+func (store *Memory) Get(key string) (body io.ReadCloser, err error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	file, ok := store.files[key]
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+
+	body = ioutil.NopCloser(bytes.NewReader(file.data))
+	return
+}
+
+// Delete removes a file from memory.
+func (store *Memory) Delete(key string) (err error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.files[key]; !ok {
+		return ErrNotFound
+	}
+
+	delete(store.files, key)
+	return
+}
+
+// URL returns the URL the router serves a file from.
+func (store *Memory) URL(key string) string {
+	return store.prefix + key
+}
+
+// ServeHTTP serves files from memory, it should be mounted on the prefix.
+func (store *Memory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, store.prefix)
+
+	store.mutex.RLock()
+	file, ok := store.files[key]
+	store.mutex.RUnlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", file.contentType)
+	http.ServeContent(w, r, key, file.modified, bytes.NewReader(file.data))
+}
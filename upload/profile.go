@@ -0,0 +1,46 @@
+package upload
+
+import (
+	"bytes"
+	"mime/multipart"
+)
+
+// profilePictureWidth is the widest profile pictures are stored, larger pictures are shrunk.
+const profilePictureWidth = 256
+
+// ProfilePicture uploads a user's profile picture, returning its file extension.
+// Profile pictures are always still images, JPEGs stay JPEGs and anything else becomes a PNG.
+func ProfilePicture(file *multipart.FileHeader, userUUID string) (extension string, err error) {
+	decoding <- struct{}{}
+	defer func() {
+		<-decoding
+	}()
+
+	_, decoded, format, err := read(file)
+	if err != nil {
+		return
+	}
+
+	if decoded.Bounds().Dx() > profilePictureWidth {
+		decoded = resize(decoded, profilePictureWidth)
+	}
+
+	// Re-encode the picture so its metadata isn't publicly stored, anything which isn't a JPEG may be transparent so becomes a PNG.
+	encoded, err := encode(decoded, format, originalQuality)
+	if err != nil {
+		return
+	}
+
+	contentType, extension, err := sniff(encoded)
+	if err != nil {
+		return
+	}
+
+	err = Store.Put("user/"+userUUID+extension, contentType, bytes.NewReader(encoded))
+	return
+}
+
+// RemoveProfilePicture deletes a user's profile picture given its file extension.
+func RemoveProfilePicture(userUUID, extension string) error {
+	return Store.Delete("user/" + userUUID + extension)
+}
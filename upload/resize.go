@@ -0,0 +1,111 @@
+package upload
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif" // Registers the GIF decoder.
+	"image/jpeg"
+	"image/png"
+	"strconv"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Registers the WebP decoder.
+)
+
+// Size is a width images are resized to when they are uploaded.
+type Size struct {
+	Name  string
+	Width int
+}
+
+// Sizes are the variants generated for every uploaded image, smallest first.
+var Sizes = []Size{
+	{Name: models.VariantThumbnail, Width: 320},
+	{Name: models.VariantFeed, Width: 640},
+	{Name: models.VariantFull, Width: 1280},
+}
+
+// variantQuality is the quality resized JPEGs are encoded with.
+const variantQuality = 85
+
+// decodeConfig decodes the dimensions of an image without decoding the whole image.
+func decodeConfig(data []byte) (config image.Config, format string, err error) {
+	config, format, err = image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		err = ErrNotImage
+	}
+
+	return
+}
+
+// decode decodes an image, formats which can't be decoded can't be resized so aren't accepted.
+func decode(data []byte) (img image.Image, format string, err error) {
+	img, format, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		err = ErrNotImage
+	}
+
+	return
+}
+
+// resize scales an image down to a width, keeping its aspect ratio.
+func resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
+
+// encode encodes an image as a JPEG of a quality if the original was one, or as a PNG otherwise.
+// PNGs, GIFs and WebPs can be transparent and JPEGs can't, so they are never turned into JPEGs.
+func encode(img image.Image, format string, quality int) (data []byte, err error) {
+	var buffer bytes.Buffer
+
+	if format == "jpeg" {
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: quality})
+		return buffer.Bytes(), err
+	}
+
+	err = png.Encode(&buffer, img)
+	return buffer.Bytes(), err
+}
+
+// variants encodes every size smaller than the original image to be stored under "post/<id>_<width><ext>".
+func variants(prepared *Prepared, id string, img image.Image, format string) (err error) {
+	for _, size := range Sizes {
+		if size.Width >= img.Bounds().Dx() {
+			// Never scale images up, the original is used instead.
+			break
+		}
+
+		resized := resize(img, size.Width)
+
+		data, err := encode(resized, format, variantQuality)
+		if err != nil {
+			return err
+		}
+
+		contentType, extension, err := sniff(data)
+		if err != nil {
+			return err
+		}
+
+		variant := models.Variant{
+			Name:   size.Name,
+			Key:    id + "_" + strconv.Itoa(size.Width) + extension,
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+		}
+
+		prepared.Variants = append(prepared.Variants, variant)
+		prepared.files = append(prepared.files, encoded{variant.Key, contentType, data})
+	}
+
+	return
+}
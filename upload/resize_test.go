@@ -0,0 +1,137 @@
+package upload
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// transparentImage returns an image as wide as the largest variant whose left half is transparent.
+func transparentImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 1600, 800))
+	for y := 0; y < 800; y++ {
+		for x := 800; x < 1600; x++ {
+			img.Set(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	return img
+}
+
+func TestVariantFormats(t *testing.T) {
+	src := transparentImage()
+
+	// GIFs have a palette whose first colour is transparent.
+	paletted := image.NewPaletted(src.Bounds(), color.Palette{color.Transparent, color.NRGBA{R: 200, G: 100, B: 50, A: 255}})
+	for y := 0; y < 800; y++ {
+		for x := 800; x < 1600; x++ {
+			paletted.SetColorIndex(x, y, 1)
+		}
+	}
+
+	var jpegData, pngData, gifData bytes.Buffer
+	for _, err := range []error{
+		jpeg.Encode(&jpegData, src, nil),
+		png.Encode(&pngData, src),
+		gif.Encode(&gifData, paletted, nil),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name      string
+		data      []byte
+		extension string
+		alpha     bool
+	}{
+		{"jpeg", jpegData.Bytes(), ".jpg", false},
+		{"png", pngData.Bytes(), ".png", true},
+		{"gif", gifData.Bytes(), ".png", true},
+	}
+
+	for _, c := range cases {
+		Store = NewMemory("/uploads/")
+
+		img, format, err := decode(c.data)
+		if err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+
+		var prepared Prepared
+		if err := variants(&prepared, "id", img, format); err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+
+		if _, err := Put([]Prepared{prepared}); err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+
+		stored := prepared.Variants
+
+		if len(stored) != len(Sizes) {
+			t.Fatalf("%v: got %v variants, want %v", c.name, len(stored), len(Sizes))
+		}
+
+		for _, variant := range stored {
+			if !strings.HasSuffix(variant.Key, c.extension) {
+				t.Errorf("%v: variant %v is %v, want %v", c.name, variant.Name, variant.Key, c.extension)
+				continue
+			}
+
+			if !c.alpha {
+				continue
+			}
+
+			resized := readStored(t, "post/"+variant.Key)
+			if _, _, _, a := resized.At(0, 0).RGBA(); a != 0 {
+				t.Errorf("%v: variant %v lost its transparency", c.name, variant.Name)
+			}
+		}
+	}
+}
+
+// readStored decodes an image from the storage backend, failing the test if it can't.
+func readStored(t *testing.T, key string) image.Image {
+	body, err := Store.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, _, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+func TestVariantsNotScaledUp(t *testing.T) {
+	// Only the sizes smaller than the original image are generated.
+	var prepared Prepared
+	if err := variants(&prepared, "id", image.NewNRGBA(image.Rect(0, 0, 500, 500)), "png"); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := prepared.Variants
+
+	if len(stored) != 1 || stored[0].Name != models.VariantThumbnail {
+		t.Errorf("got variants %+v, want only the thumbnail", stored)
+	}
+}
@@ -0,0 +1,80 @@
+package upload
+
+import (
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3 stores uploads in an Amazon S3 bucket.
+type S3 struct {
+	bucket, region string
+	client         *s3.S3
+	uploader       *s3manager.Uploader
+}
+
+// NewS3 creates a new S3 storage backend for a bucket in a region.
+func NewS3(bucket, region string) (store *S3, err error) {
+	session, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return
+	}
+
+	store = &S3{
+		bucket:   bucket,
+		region:   region,
+		client:   s3.New(session),
+		uploader: s3manager.NewUploader(session),
+	}
+	return
+}
+
+// Put uploads a file to S3.
+func (store *S3) Put(key, contentType string, body io.Reader) (err error) {
+	_, err = store.uploader.Upload(&s3manager.UploadInput{
+		Bucket:      aws.String(store.bucket),  // Bucket name to upload to.
+		Key:         aws.String(key),           // Directory to upload to.
+		Body:        body,                      // Body to upload.
+		ContentType: aws.String(contentType),   // Content type served back to browsers.
+		ACL:         aws.String("public-read"), // Set to public read (no key required to read).
+	})
+	return
+}
+
+// Get downloads a file from S3.
+func (store *S3) Get(key string) (body io.ReadCloser, err error) {
+	result, err := store.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aErr, ok := err.(awserr.Error); ok && aErr.Code() == s3.ErrCodeNoSuchKey {
+			err = ErrNotFound
+		}
+
+		return
+	}
+
+	body = result.Body
+	return
+}
+
+// Delete removes a file from S3.
+func (store *S3) Delete(key string) (err error) {
+	_, err = store.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	return
+}
+
+// URL returns the public URL of a file in S3.
+func (store *S3) URL(key string) string {
+	return "https://s3." + store.region + ".amazonaws.com/" + store.bucket + "/" + key
+}
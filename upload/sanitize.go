@@ -0,0 +1,98 @@
+package upload
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// originalQuality is the quality re-encoded original JPEGs are encoded with.
+const originalQuality = 92
+
+// sanitize re-encodes an image so none of its metadata (such as the GPS location in EXIF) is stored.
+// JPEGs are re-encoded as JPEGs, PNGs and GIFs keep their format and anything else becomes a PNG.
+func sanitize(data []byte, img image.Image, format string) (sanitized []byte, err error) {
+	switch format {
+	case "jpeg":
+		return encode(img, format, originalQuality)
+	case "gif":
+		// Decode every frame so animations are kept, the encoder only writes the frames and loop count.
+		var animation *gif.GIF
+		animation, err = gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			err = ErrNotImage
+			return
+		}
+
+		var buffer bytes.Buffer
+		err = gif.EncodeAll(&buffer, animation)
+		return buffer.Bytes(), err
+	}
+
+	return encode(img, "png", 0)
+}
+
+// orientation returns the EXIF orientation of an image, 1 (upright) if it has none.
+func orientation(data []byte) int {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 1
+	}
+
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+
+	value, err := tag.Int(0)
+	if err != nil || value < 1 || value > 8 {
+		return 1
+	}
+
+	return value
+}
+
+// orient rotates and flips an image so it is upright given its EXIF orientation.
+func orient(src image.Image, orientation int) image.Image {
+	if orientation == 1 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5 to 8 are rotated by 90 degrees so swap the width and height.
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if orientation >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < dst.Bounds().Dy(); y++ {
+		for x := 0; x < dst.Bounds().Dx(); x++ {
+			var sx, sy int
+
+			switch orientation {
+			case 2: // Flip horizontally.
+				sx, sy = w-1-x, y
+			case 3: // Rotate 180 degrees.
+				sx, sy = w-1-x, h-1-y
+			case 4: // Flip vertically.
+				sx, sy = x, h-1-y
+			case 5: // Transpose.
+				sx, sy = y, x
+			case 6: // Rotate 90 degrees clockwise.
+				sx, sy = y, h-1-x
+			case 7: // Transverse.
+				sx, sy = w-1-y, h-1-x
+			case 8: // Rotate 90 degrees counter-clockwise.
+				sx, sy = w-1-y, x
+			}
+
+			dst.Set(x, y, src.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
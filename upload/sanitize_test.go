@@ -0,0 +1,142 @@
+package upload
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// The fixtures are 40x20 JPEGs whose left half is red and right half is blue.
+// testdata/gps.jpg is tagged with a GPS location and testdata/rotated.jpg has an EXIF orientation of 6 (rotate 90 degrees clockwise).
+
+// fileHeader returns a fixture as if it had been uploaded in a multipart form.
+func fileHeader(t *testing.T, name string) *multipart.FileHeader {
+	data, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return formFile(t, name, data)
+}
+
+// formFile returns a file as if it had been uploaded in a multipart form.
+func formFile(t *testing.T, name string, data []byte) *multipart.FileHeader {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("image", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	part.Write(data)
+	writer.Close()
+
+	request, err := http.NewRequest(http.MethodPost, "/", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	err = request.ParseMultipartForm(int64(body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return request.MultipartForm.File["image"][0]
+}
+
+// uploadFixture uploads a fixture and returns the stored original.
+func uploadFixture(t *testing.T, name string) []byte {
+	Store = NewMemory("/uploads/")
+
+	uploaded, err := Image(fileHeader(t, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := Store.Get("post/" + uploaded.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestUploadStripsGPS(t *testing.T) {
+	original, err := ioutil.ReadFile("testdata/gps.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make sure the fixture really has a location to strip.
+	x, err := exif.Decode(bytes.NewReader(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := x.LatLong(); err != nil {
+		t.Fatalf("fixture has no GPS location: %v", err)
+	}
+
+	stored := uploadFixture(t, "gps.jpg")
+
+	if _, err := exif.Decode(bytes.NewReader(stored)); err == nil {
+		t.Error("stored image still has EXIF data")
+	}
+
+	if bytes.Contains(stored, []byte("Exif\x00\x00")) {
+		t.Error("stored image still has an EXIF segment")
+	}
+}
+
+func TestUploadAppliesOrientation(t *testing.T) {
+	stored := uploadFixture(t, "rotated.jpg")
+
+	if _, err := exif.Decode(bytes.NewReader(stored)); err == nil {
+		t.Error("stored image still has EXIF data, so viewers would rotate it again")
+	}
+
+	img, format, err := decode(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if format != "jpeg" {
+		t.Errorf("stored image is a %v, want jpeg", format)
+	}
+
+	// Rotating 90 degrees clockwise makes the image tall, with the red left half on top.
+	bounds := img.Bounds()
+	if bounds.Dx() != 20 || bounds.Dy() != 40 {
+		t.Fatalf("stored image is %vx%v, want 20x40", bounds.Dx(), bounds.Dy())
+	}
+
+	cases := []struct {
+		name string
+		x, y int
+		red  bool
+	}{
+		{"top", 10, 5, true},
+		{"bottom", 10, 35, false},
+	}
+
+	for _, c := range cases {
+		r, _, b, _ := img.At(c.x, c.y).RGBA()
+		if (r > b) != c.red {
+			t.Errorf("%v of the stored image has red %v and blue %v", c.name, r>>8, b>>8)
+		}
+	}
+}
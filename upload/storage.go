@@ -0,0 +1,65 @@
+package upload
+
+import (
+	"errors"
+	"io"
+
+	"github.com/VolticFroogo/Animal-Pictures/config"
+	"github.com/VolticFroogo/Animal-Pictures/models"
+)
+
+// Storage drivers.
+const (
+	DriverS3     = "s3"
+	DriverLocal  = "local"
+	DriverMemory = "memory"
+)
+
+// Define storage errors.
+var (
+	ErrNotFound      = errors.New("file not found in storage")
+	ErrUnknownDriver = errors.New("unknown storage driver")
+)
+
+// Storage is a backend which uploaded files are stored in.
+type Storage interface {
+	// Put stores the body under a key, replacing anything already there.
+	Put(key, contentType string, body io.Reader) error
+	// Get opens the file stored under a key, the caller must close it.
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the file stored under a key.
+	Delete(key string) error
+	// URL returns the public URL of a key.
+	URL(key string) string
+}
+
+var (
+	// Store is the storage backend chosen by Init.
+	Store Storage
+
+	// limits are the limits of uploaded images.
+	limits = config.Default().Uploads
+)
+
+// Init initialises the storage backend chosen by the configuration and the limits of uploaded images.
+func Init(config config.Storage, uploads config.Uploads) (err error) {
+	limits = uploads
+
+	switch config.Driver {
+	case DriverS3:
+		Store, err = NewS3(config.Bucket, config.Region)
+	case DriverLocal:
+		Store, err = NewLocal(config.Path, config.Prefix)
+	case DriverMemory:
+		Store = NewMemory(config.Prefix)
+	default:
+		err = ErrUnknownDriver
+	}
+
+	if err != nil {
+		return
+	}
+
+	models.StorageURL = Store.URL
+	return
+}
@@ -1,89 +1,268 @@
 package upload
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
+	"image"
+	"io"
+	"io/ioutil"
 	"mime/multipart"
-	"net/url"
-	"path/filepath"
-	"strings"
+	"sync"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/VolticFroogo/Animal-Pictures/models"
 	"github.com/h2non/filetype"
 	"github.com/zemirco/uid"
 )
 
 // Define errors.
 var (
-	ErrNotImage = errors.New("file is not an image")
+	ErrNotImage         = errors.New("file is not an image")
+	ErrUnsupportedImage = errors.New("image format is not supported")
+	ErrTooLarge         = errors.New("image file is too large")
+	ErrTooManyPixels    = errors.New("image dimensions are too large")
 )
 
-var (
-	uploader *s3manager.Uploader
-)
+// supported are the MIME types of images which can be decoded, resized and re-encoded.
+var supported = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// maxDecoding is the most images decoded at once, as a decoded image takes far more memory than its file.
+const maxDecoding = 2
 
-// Init initialises the uploader.
-func Init() (err error) {
-	session, err := session.NewSession(&aws.Config{
-		Region: aws.String("eu-west-2"),
-	})
+// decoding holds a value for every image being decoded, sending to it waits for a turn.
+var decoding = make(chan struct{}, maxDecoding)
+
+// check reads an uploaded image and checks it against the limits from its header, without decoding it.
+func check(file *multipart.FileHeader) (data []byte, imageConfig image.Config, err error) {
+	if file.Size > limits.MaxBytes {
+		err = ErrTooLarge
+		return
+	}
+
+	// Open the image file.
+	opened, err := file.Open()
 	if err != nil {
 		return
 	}
 
-	uploader = s3manager.NewUploader(session)
+	// Close it once this function returns.
+	defer opened.Close()
+
+	// Read the whole image (it has to be decoded to be resized) but stop after the limit.
+	data, err = ioutil.ReadAll(io.LimitReader(opened, limits.MaxBytes+1))
+	if err != nil {
+		return
+	}
+
+	if int64(len(data)) > limits.MaxBytes {
+		err = ErrTooLarge
+		return
+	}
+
+	// Check the file is an image we can handle from its contents, never trusting its name.
+	kind, err := filetype.Match(data)
+	if err != nil || kind.MIME.Type != "image" {
+		err = ErrNotImage
+		return
+	}
+
+	if !supported[kind.MIME.Value] {
+		err = ErrUnsupportedImage
+		return
+	}
+
+	// Check the dimensions before decoding so huge images are never allocated.
+	imageConfig, _, err = decodeConfig(data)
+	if err != nil {
+		return
+	}
+
+	if imageConfig.Width > limits.MaxWidth || imageConfig.Height > limits.MaxHeight || imageConfig.Width*imageConfig.Height > limits.MaxPixels {
+		err = ErrTooManyPixels
+	}
+
 	return
 }
 
-// Image uploads an image to Amazon S3.
-func Image(file *multipart.FileHeader) (location string, err error) {
-	// Open the image file.
-	image, err := file.Open()
-	// Close it once this function returns.
-	defer image.Close()
+// decodeUpright decodes a checked image, JPEGs are rotated upright since their EXIF orientation is lost when re-encoding.
+func decodeUpright(data []byte) (decoded image.Image, format string, err error) {
+	decoded, format, err = decode(data)
 	if err != nil {
 		return
 	}
 
-	// Create a new reader from the image file.
-	reader := bufio.NewReader(image)
+	if format == "jpeg" {
+		decoded = orient(decoded, orientation(data))
+	}
+
+	return
+}
 
-	// Read from the reader into a byte array.
-	byteData := make([]byte, reader.Size())
-	_, err = reader.Read(byteData)
+// read reads and decodes an uploaded image, checking it against the limits.
+// The caller must have a turn to decode.
+func read(file *multipart.FileHeader) (data []byte, decoded image.Image, format string, err error) {
+	data, _, err = check(file)
 	if err != nil {
 		return
 	}
 
-	// Check if the file isn't an image.
-	if !filetype.IsImage(byteData) {
-		err = ErrNotImage
+	decoded, format, err = decodeUpright(data)
+	return
+}
+
+// Prepared is an image which has been checked, sanitized and resized, ready to be stored by Put.
+type Prepared struct {
+	models.Image
+	// files are the encoded original and variants.
+	files []encoded
+}
+
+// encoded is an encoded image to be stored under a key in the post directory.
+type encoded struct {
+	key, contentType string
+	data             []byte
+}
+
+// Image uploads an image and its resized variants to the storage backend.
+func Image(file *multipart.FileHeader) (uploaded models.Image, err error) {
+	prepared, err := Prepare([]*multipart.FileHeader{file})
+	if err != nil {
 		return
 	}
 
-	imageID := uid.New(32)
-	fileName := imageID + filepath.Ext(file.Filename)
-
-	// Upload file to S3
-	result, err := uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String("froogo-ap"),        // Bucket name to upload to.
-		Key:    aws.String("post/" + fileName), // Directory to upload to.
-		Body:   bytes.NewReader(byteData),      // Body to upload (just bytes).
-		ACL:    aws.String("public-read"),      // Set to public read (no key required to read).
-	})
+	images, err := Put(prepared)
 	if err != nil {
 		return
 	}
 
-	url, err := url.Parse(result.Location)
+	return images[0], nil
+}
+
+// prepare decodes a checked image, then encodes it without its metadata and its resized variants once it has a turn to decode.
+func prepare(data []byte) (prepared Prepared, err error) {
+	decoding <- struct{}{}
+	defer func() {
+		<-decoding
+	}()
+
+	decoded, format, err := decodeUpright(data)
+	if err != nil {
+		return
+	}
+
+	// Re-encode the image so its metadata isn't publicly stored.
+	sanitized, err := sanitize(data, decoded, format)
+	if err != nil {
+		return
+	}
+
+	contentType, extension, err := sniff(sanitized)
+	if err != nil {
+		return
+	}
+
+	imageID := uid.New(32)
+	prepared.Key = imageID + extension
+	prepared.Width = decoded.Bounds().Dx()
+	prepared.Height = decoded.Bounds().Dy()
+	prepared.Hash = Hash(decoded)
+	prepared.files = []encoded{{prepared.Key, contentType, sanitized}}
+
+	err = variants(&prepared, imageID, decoded, format)
+	return
+}
+
+// sniff returns the content type and file extension of an encoded image from its contents.
+func sniff(data []byte) (contentType, extension string, err error) {
+	kind, err := filetype.Match(data)
 	if err != nil {
 		return
 	}
-	urlSplit := strings.Split(url.Path, "/")
 
-	location = urlSplit[len(urlSplit)-1]
+	if kind == filetype.Unknown {
+		err = ErrNotImage
+		return
+	}
+
+	return kind.MIME.Value, "." + kind.Extension, nil
+}
+
+// Remove deletes an image and its variants from the storage backend.
+func Remove(image models.Image) {
+	Store.Delete("post/" + image.Key)
+
+	for _, variant := range image.Variants {
+		Store.Delete("post/" + variant.Key)
+	}
+}
+
+// Prepare prepares images concurrently and returns them in the same order as the files, nothing is stored until they are Put.
+// Every file is checked first, including the pixels of all of them together, so nothing is decoded for a request over the limits.
+func Prepare(files []*multipart.FileHeader) (prepared []Prepared, err error) {
+	data := make([][]byte, len(files))
+
+	pixels := 0
+	for i, file := range files {
+		var imageConfig image.Config
+		data[i], imageConfig, err = check(file)
+		if err != nil {
+			return nil, err
+		}
+
+		pixels += imageConfig.Width * imageConfig.Height
+	}
+
+	if pixels > limits.MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	prepared = make([]Prepared, len(files))
+	errs := make([]error, len(files))
+
+	var wg sync.WaitGroup
+	for i := range data {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			prepared[i], errs[i] = prepare(data[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, prepareErr := range errs {
+		if prepareErr != nil {
+			return nil, prepareErr
+		}
+	}
+
+	return
+}
+
+// Put stores prepared images with their variants and returns them in the same order.
+// If any file fails to be stored every image is deleted again.
+func Put(prepared []Prepared) (images []models.Image, err error) {
+	images = make([]models.Image, len(prepared))
+	for i := range prepared {
+		images[i] = prepared[i].Image
+	}
+
+	for _, image := range prepared {
+		for _, file := range image.files {
+			err = Store.Put("post/"+file.key, file.contentType, bytes.NewReader(file.data))
+			if err != nil {
+				for _, image := range images {
+					Remove(image)
+				}
+
+				return nil, err
+			}
+		}
+	}
+
 	return
 }
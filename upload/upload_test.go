@@ -0,0 +1,182 @@
+package upload
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"mime/multipart"
+	"testing"
+	"time"
+
+	"github.com/VolticFroogo/Animal-Pictures/config"
+)
+
+// setLimits uses the default limits changed by a function for a test.
+func setLimits(t *testing.T, change func(uploads *config.Uploads)) {
+	old := limits
+	limits = config.Default().Uploads
+	change(&limits)
+
+	t.Cleanup(func() {
+		limits = old
+	})
+}
+
+func TestImageLimits(t *testing.T) {
+	jpeg, err := ioutil.ReadFile("testdata/gps.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fixture is 40x20, so 800 pixels.
+	cases := []struct {
+		name   string
+		data   []byte
+		change func(uploads *config.Uploads)
+		err    error
+	}{
+		{"text", []byte("This is not an image."), func(uploads *config.Uploads) {}, ErrNotImage},
+		{"bitmap", append([]byte("BM"), make([]byte, 64)...), func(uploads *config.Uploads) {}, ErrUnsupportedImage},
+		{"too many bytes", jpeg, func(uploads *config.Uploads) { uploads.MaxBytes = int64(len(jpeg) - 1) }, ErrTooLarge},
+		{"too wide", jpeg, func(uploads *config.Uploads) { uploads.MaxWidth = 39 }, ErrTooManyPixels},
+		{"too tall", jpeg, func(uploads *config.Uploads) { uploads.MaxHeight = 19 }, ErrTooManyPixels},
+		{"too many pixels", jpeg, func(uploads *config.Uploads) { uploads.MaxPixels = 799 }, ErrTooManyPixels},
+		{"at the limits", jpeg, func(uploads *config.Uploads) {
+			uploads.MaxBytes, uploads.MaxWidth, uploads.MaxHeight, uploads.MaxPixels = int64(len(jpeg)), 40, 20, 800
+		}, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setLimits(t, c.change)
+			Store = NewMemory("/uploads/")
+
+			if _, err := Image(formFile(t, "upload", c.data)); err != c.err {
+				t.Errorf("got error %v, want %v", err, c.err)
+			}
+		})
+	}
+}
+
+func TestPreparePixelsPerRequest(t *testing.T) {
+	// Each image is within the limit but both together aren't.
+	setLimits(t, func(uploads *config.Uploads) { uploads.MaxPixels = 1000 })
+	memory := NewMemory("/uploads/")
+	Store = memory
+
+	files := []*multipart.FileHeader{fileHeader(t, "gps.jpg"), fileHeader(t, "rotated.jpg")}
+	if _, err := Prepare(files); err != ErrTooManyPixels {
+		t.Fatalf("got error %v, want %v", err, ErrTooManyPixels)
+	}
+
+	limits.MaxPixels = 1600
+	prepared, err := Prepare(files)
+	if err != nil || len(prepared) != len(files) {
+		t.Fatalf("got %v images and error %v at the limit", len(prepared), err)
+	}
+
+	// Nothing is stored until the prepared images are put.
+	if len(memory.files) != 0 {
+		t.Errorf("%v files were stored before putting them", len(memory.files))
+	}
+
+	images, err := Put(prepared)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, image := range images {
+		if _, ok := memory.files["post/"+image.Key]; !ok {
+			t.Errorf("image %v wasn't stored", image.Key)
+		}
+	}
+}
+
+func TestPrepareWaitsToDecode(t *testing.T) {
+	Store = NewMemory("/uploads/")
+
+	// Take every turn to decode so the upload has to wait.
+	for i := 0; i < maxDecoding; i++ {
+		decoding <- struct{}{}
+	}
+
+	files := []*multipart.FileHeader{fileHeader(t, "gps.jpg")}
+	done := make(chan error)
+	go func() {
+		_, err := Prepare(files)
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("image was decoded while every turn was taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for i := 0; i < maxDecoding; i++ {
+		<-decoding
+	}
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+// exifSegment returns the APP1 segment holding the EXIF of a JPEG.
+func exifSegment(t *testing.T, data []byte) []byte {
+	for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+		length := int(data[i+2])<<8 | int(data[i+3])
+		if data[i+1] == 0xe1 {
+			return data[i : i+2+length]
+		}
+
+		i += 2 + length
+	}
+
+	t.Fatal("JPEG has no EXIF")
+	return nil
+}
+
+func TestHashStoredOrientation(t *testing.T) {
+	Store = NewMemory("/uploads/")
+
+	// The image gets lighter from left to right but is turned so it gets lighter from top to bottom, which hashes differently.
+	gradient := image.NewGray(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			gradient.SetGray(x, y, color.Gray{Y: uint8(x * 6)})
+		}
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, gradient, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := ioutil.ReadFile("testdata/rotated.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Images uploaded before they were sanitized are stored with their EXIF orientation.
+	data := append(append(append([]byte{}, encoded.Bytes()[:2]...), exifSegment(t, rotated)...), encoded.Bytes()[2:]...)
+	if err := Store.Put("post/old.jpg", "image/jpeg", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := HashStored("old.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prepared, err := Prepare([]*multipart.FileHeader{formFile(t, "old.jpg", data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != prepared[0].Hash || hash == Hash(gradient) {
+		t.Errorf("stored image hashed to %x, want %x like a new upload instead of %x", hash, prepared[0].Hash, Hash(gradient))
+	}
+}